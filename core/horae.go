@@ -7,20 +7,31 @@ import (
 	"github.com/kieranbroadfoot/horae/eirene"
 	"github.com/kieranbroadfoot/horae/eunomia"
 	"github.com/kieranbroadfoot/horae/types"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var isRunning bool
+var isDraining bool
+
+// how long draining may overrun its timeout (to release queues and leave the cluster) before the node exits anyway
+const drainGracePeriod = 15 * time.Second
 
 func StartServer() {
 	types.InitConfig()
 	log.WithFields(log.Fields{"cluster": types.Configuration.ClusterName}).Info("Starting horae server")
 
 	// Create core node type
-	node := types.Node{UUID: GenerateUUID(), Cluster: types.Configuration.ClusterName}
+	node := types.Node{UUID: GenerateUUID(), Cluster: types.Configuration.ClusterName, Version: types.Version, Started: time.Now()}
 
 	eunomia.InitETCD(types.Configuration.ETCDAddress)
 	types.InitDAO(types.Configuration.CassandraAddress, types.Configuration.ClusterName)
+	if err := types.InitTracing(node); err != nil {
+		log.WithFields(log.Fields{"reason": err}).Fatal("Unable to init tracing")
+	}
 
 	// Signal failure to core core
 	coreFailureCh := make(chan bool)
@@ -30,31 +41,81 @@ func StartServer() {
 	eunomiaToEireneCh := make(chan types.EireneStrategyAction)
 	// signal action requests to Eunomia
 	allToEunomiaCh := make(chan types.EunomiaRequest)
+	// signal a request to drain the node (with the time allowed for running tasks and actions to finish)
+	drainCh := make(chan time.Duration, 1)
+	// signal the node has drained (successfully or not) and may exit
+	drainedCh := make(chan bool)
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGTERM, os.Interrupt)
+	exitCode := 0
 
 	// Start etcd Manager
-	go eirene.StartEirene(node, types.Configuration.StaticPort, eireneToCore, coreFailureCh, allToEunomiaCh, eunomiaToEireneCh)
+	go eirene.StartEirene(node, types.Configuration.StaticPort, eireneToCore, coreFailureCh, drainCh, allToEunomiaCh, eunomiaToEireneCh)
 
 	for {
 		select {
 		case <-coreFailureCh:
 			log.Print("Received error state. Shutting down")
-			os.Exit(1)
+			if !isRunning {
+				os.Exit(1)
+			}
+			// release our queues without waiting for running tasks
+			exitCode = 1
+			startDrain(node, 0, drainedCh)
+		case received := <-signalCh:
+			log.WithFields(log.Fields{"signal": received}).Info("Received signal. Shutting down")
+			if !isRunning {
+				os.Exit(0)
+			}
+			startDrain(node, time.Duration(types.Configuration.DrainTimeout)*time.Second, drainedCh)
+		case timeout := <-drainCh:
+			startDrain(node, timeout, drainedCh)
+		case <-drainedCh:
+			log.WithFields(log.Fields{"code": exitCode}).Info("Node drained. Exiting")
+			os.Exit(exitCode)
 		case node = <-eireneToCore:
 			if !isRunning {
 				log.WithFields(log.Fields{"UUID": node.UUID, "cluster": node.Cluster, "IP": node.Address, "port": node.Port}).Info("Node generated")
+				// the public URL is read by eunomia and dike so it is set before either starts
+				if types.Configuration.PublicURL == "" {
+					// no load balancer or other stable address was given.  actions call back to this node
+					types.Configuration.PublicURL = "http://" + net.JoinHostPort(node.Address, node.Port) + "/"
+				}
+				log.WithFields(log.Fields{"url": types.Configuration.PublicURL}).Info("Setting Public URL")
 				// Start API Server
 				go eunomia.StartEunomia(node, coreFailureCh, eunomiaToEireneCh, allToEunomiaCh)
 				// Start Queue Manager
 				go dike.StartDike(node, coreFailureCh, allToEunomiaCh)
 				isRunning = true
-			} else {
-				// received an updated Node object from eirene, store and update configuration
-				types.Configuration.MasterURI = node.MasterURI
 			}
 		}
 	}
 }
 
+// startDrain drains the node (see dike.Drain), leaves the cluster and signals once done.  If draining has not finished
+// shortly after the timeout (e.g. etcd is unreachable) the node is considered drained anyway.
+func startDrain(node types.Node, timeout time.Duration, drainedCh chan bool) {
+	if isDraining {
+		return
+	}
+	isDraining = true
+	deadline := time.Now().Add(timeout)
+	done := make(chan bool, 1)
+	go func() {
+		dike.Drain(deadline)
+		eunomia.LeaveCluster(node)
+		done <- true
+	}()
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(timeout + drainGracePeriod):
+			log.Warn("Unable to finish draining the node")
+		}
+		drainedCh <- true
+	}()
+}
+
 func GenerateUUID() gocql.UUID {
 	return gocql.TimeUUID()
 }
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kieranbroadfoot/horae/types"
+	"os"
+)
+
+// StartReindex runs the "reindex-tags" subcommand.  The tags of every object are added to the tag index, which is
+// only needed once for tags set before the index existed.
+func StartReindex(args []string) {
+	flags := flag.NewFlagSet("reindex-tags", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Printf("Usage of horae reindex-tags:\n\nAdds the tags of every task, queue and action to the tag index used by selectors.\n\n")
+		flags.PrintDefaults()
+	}
+	types.AddStoreFlags(flags)
+	types.InitStoreConfig(flags, args)
+
+	types.InitDAO(types.Configuration.CassandraAddress, types.Configuration.ClusterName)
+	count, err := types.RebuildTagIndex()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Reindexing failed: "+err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("Indexed %d tags\n", count)
+}
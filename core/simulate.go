@@ -0,0 +1,102 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/kieranbroadfoot/horae/dike"
+	"github.com/kieranbroadfoot/horae/types"
+	"os"
+	"strings"
+	"time"
+)
+
+// overrideFlags collects repeated -window flags of the form "<path or queue uuid>=<window>"
+type overrideFlags []types.WindowOverride
+
+func (o *overrideFlags) String() string {
+	return fmt.Sprintf("%v", *o)
+}
+
+func (o *overrideFlags) Set(value string) error {
+	elements := strings.SplitN(value, "=", 2)
+	if len(elements) != 2 || elements[0] == "" {
+		return errors.New("expected <path or queue uuid>=<window>")
+	}
+	if strings.HasPrefix(elements[0], "/") {
+		*o = append(*o, types.WindowOverride{Path: elements[0], Window: elements[1]})
+	} else {
+		*o = append(*o, types.WindowOverride{Queue: elements[0], Window: elements[1]})
+	}
+	return nil
+}
+
+// StartSimulation runs the "simulate" subcommand.  The queues and pending tasks are read from the store and the
+// resulting timeline is written to stdout.
+func StartSimulation(args []string) {
+	var from, to string
+	var asJSON bool
+	var overrides overrideFlags
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Printf("Usage of horae simulate:\n\nReplays the windows of operation and containment of all queues over a time range and reports when each queue\nopens and closes and when each pending task would fire.  Nothing is executed.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&from, "from", "", "The start of the simulation (RFC3339). Defaults to now")
+	flags.StringVar(&to, "to", "", "The end of the simulation (RFC3339). Defaults to 7 days after the start")
+	flags.Var(&overrides, "window", "Override a window of operation, e.g. -window \"/apps=always except 00:00 - 23:59 on 24/10/2026\" (may be repeated)")
+	flags.BoolVar(&asJSON, "json", false, "Write the simulation as json")
+	types.AddStoreFlags(flags)
+	types.InitStoreConfig(flags, args)
+
+	request := types.SimulationRequest{Overrides: overrides}
+	for _, value := range []struct {
+		input  string
+		output *time.Time
+	}{{from, &request.From}, {to, &request.To}} {
+		if value.input != "" {
+			parsed, err := time.Parse(time.RFC3339, value.input)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid time %q (expected RFC3339, e.g. 2026-10-24T00:00:00Z)\n", value.input)
+				os.Exit(2)
+			}
+			*value.output = parsed
+		}
+	}
+
+	types.InitDAO(types.Configuration.CassandraAddress, types.Configuration.ClusterName)
+	simulation, err := dike.Simulate(request)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Simulation failed: "+err.Error())
+		os.Exit(1)
+	}
+	if asJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(simulation); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Printf("Simulating %s to %s\n\n", simulation.From.Format(time.RFC3339), simulation.To.Format(time.RFC3339))
+	for _, event := range simulation.Timeline {
+		fmt.Printf("%s  %-10s  %s\n", event.Time.Format(time.RFC3339), event.Type, event.Description)
+	}
+	if len(simulation.Overrides) > 0 {
+		fmt.Printf("\nTasks delayed by the overridden windows:\n")
+		delayed := 0
+		for _, task := range simulation.Tasks {
+			if task.Delayed {
+				delayed++
+				fireAt := "never"
+				if task.FireAt != nil {
+					fireAt = task.FireAt.Format(time.RFC3339)
+				}
+				fmt.Printf("  %s (queue %s) fires %s rather than %s\n", task.UUID, task.Queue, fireAt, task.BaselineFireAt.Format(time.RFC3339))
+			}
+		}
+		if delayed == 0 {
+			fmt.Printf("  none\n")
+		}
+	}
+}
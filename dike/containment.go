@@ -0,0 +1,288 @@
+package dike
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"path"
+	"strings"
+	"sync"
+)
+
+// containment tracks the queues of this node by path so each queue manager can determine if its queue is contained,
+// i.e. if the queues found along its paths are open.
+//
+// Queue managers record when the window of their queue opens and closes (on every node, whether or not they own the
+// queue) and are notified when a change may affect the containment of their own queue.  A queue is contained along a
+// path if, at every parent of that path holding queues, at least one of those queues is open: its window is open and
+// it is itself contained.  The root ("/") is always open.  A queue with several paths is contained along all of them
+// (all-paths, the default) or along any one of them (any-path).
+type containment struct {
+	mutex  sync.RWMutex
+	root   *pathNode
+	queues map[gocql.UUID]*containedQueue
+}
+
+type containedQueue struct {
+	paths      []string
+	mode       string
+	windowOpen bool
+	notify     chan bool
+}
+
+type pathNode struct {
+	children map[string]*pathNode
+	queues   []gocql.UUID
+}
+
+var containmentTree = newContainment()
+
+func newContainment() *containment {
+	return &containment{root: newPathNode(), queues: map[gocql.UUID]*containedQueue{}}
+}
+
+func newPathNode() *pathNode {
+	return &pathNode{children: map[string]*pathNode{}}
+}
+
+// add records the queue.  notify (if given) receives a value whenever the containment of the queue may have changed;
+// it should be buffered as notifications are dropped rather than block.
+func (c *containment) add(queue *types.Queue, notify chan bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.addLocked(queue, &containedQueue{notify: notify})
+}
+
+// update records changes to the paths or containment mode of a known queue
+func (c *containment) update(queue *types.Queue) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if entry, ok := c.queues[queue.UUID]; ok {
+		c.addLocked(queue, &containedQueue{notify: entry.notify, windowOpen: entry.windowOpen})
+	}
+}
+
+func (c *containment) remove(uuid gocql.UUID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.removeLocked(uuid)
+}
+
+// setWindowOpen records whether the window of the queue is open, notifying the queues whose containment depends on it
+func (c *containment) setWindowOpen(uuid gocql.UUID, open bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if entry, ok := c.queues[uuid]; ok && entry.windowOpen != open {
+		entry.windowOpen = open
+		c.notifyAffected(uuid)
+	}
+}
+
+// isContained determines if the queue may run, ignoring its own window
+func (c *containment) isContained(uuid gocql.UUID) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.contained(uuid, map[gocql.UUID]bool{})
+}
+
+// isOpen determines if the window of the queue is open and it is contained
+func (c *containment) isOpen(uuid gocql.UUID) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.open(uuid, map[gocql.UUID]bool{})
+}
+
+func (c *containment) open(uuid gocql.UUID, visiting map[gocql.UUID]bool) bool {
+	entry, ok := c.queues[uuid]
+	if !ok || !entry.windowOpen {
+		return false
+	}
+	if visiting[uuid] {
+		// a queue with nested paths (e.g. /a and /a/b) contains itself; only its own window applies
+		return true
+	}
+	visiting[uuid] = true
+	defer delete(visiting, uuid)
+	return c.contained(uuid, visiting)
+}
+
+func (c *containment) contained(uuid gocql.UUID, visiting map[gocql.UUID]bool) bool {
+	entry, ok := c.queues[uuid]
+	if !ok || len(entry.paths) == 0 {
+		// a queue without paths is only contained by the root
+		return true
+	}
+	for _, p := range entry.paths {
+		contained := c.containedAlong(p, visiting)
+		if contained && entry.mode == types.QueueContainmentAny {
+			return true
+		}
+		if !contained && entry.mode != types.QueueContainmentAny {
+			return false
+		}
+	}
+	return entry.mode != types.QueueContainmentAny
+}
+
+// containedAlong determines if a queue at thepath is contained by the queues at each of its parents
+func (c *containment) containedAlong(thepath string, visiting map[gocql.UUID]bool) bool {
+	for parent := path.Dir(path.Clean(thepath)); parent != "/" && parent != "."; parent = path.Dir(parent) {
+		node := c.node(parent, false)
+		if node == nil || len(node.queues) == 0 {
+			// there was no queue that exists at this path. that's ok. keep going
+			continue
+		}
+		anyOpen := false
+		for _, q := range node.queues {
+			if c.open(q, visiting) {
+				anyOpen = true
+				break
+			}
+		}
+		if !anyOpen {
+			return false
+		}
+	}
+	return true
+}
+
+// notifyAffected notifies every queue found beneath the paths of the given queue, and beneath the paths of those
+// queues in turn, as their containment may depend upon it
+func (c *containment) notifyAffected(uuid gocql.UUID) {
+	affected := map[gocql.UUID]bool{}
+	pending := []gocql.UUID{uuid}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		entry, ok := c.queues[current]
+		if !ok {
+			continue
+		}
+		for _, p := range entry.paths {
+			node := c.node(p, false)
+			if node == nil {
+				continue
+			}
+			for _, below := range node.descendants() {
+				if !affected[below] && below != uuid {
+					affected[below] = true
+					pending = append(pending, below)
+				}
+			}
+		}
+	}
+	for q := range affected {
+		if entry, ok := c.queues[q]; ok && entry.notify != nil {
+			select {
+			case entry.notify <- true:
+			default:
+				// a notification is already waiting
+			}
+		}
+	}
+}
+
+func (c *containment) addLocked(queue *types.Queue, entry *containedQueue) {
+	c.removeLocked(queue.UUID)
+	entry.paths = queue.OurPaths
+	entry.mode = queue.Containment
+	c.queues[queue.UUID] = entry
+	for _, p := range entry.paths {
+		node := c.node(p, true)
+		node.queues = append(node.queues, queue.UUID)
+	}
+	c.notifyAffected(queue.UUID)
+}
+
+func (c *containment) removeLocked(uuid gocql.UUID) {
+	entry, ok := c.queues[uuid]
+	if !ok {
+		return
+	}
+	c.notifyAffected(uuid)
+	for _, p := range entry.paths {
+		if node := c.node(p, false); node != nil {
+			for idx, q := range node.queues {
+				if q == uuid {
+					node.queues = append(node.queues[:idx], node.queues[idx+1:]...)
+					break
+				}
+			}
+		}
+	}
+	delete(c.queues, uuid)
+}
+
+// node returns the node for thepath, optionally creating it (and its parents)
+func (c *containment) node(thepath string, create bool) *pathNode {
+	node := c.root
+	for _, element := range strings.Split(strings.Trim(path.Clean(thepath), "/"), "/") {
+		if element == "" {
+			continue
+		}
+		child, ok := node.children[element]
+		if !ok {
+			if !create {
+				return nil
+			}
+			child = newPathNode()
+			node.children[element] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// descendants returns the queues strictly beneath the node
+func (n *pathNode) descendants() []gocql.UUID {
+	queues := []gocql.UUID{}
+	for _, child := range n.children {
+		queues = append(queues, child.queues...)
+		queues = append(queues, child.descendants()...)
+	}
+	return queues
+}
+
+// blockers returns, for each path along which the queue is not contained, the parent closest to the root at which no
+// queue is open.  It is empty if the queue is contained.
+func (c *containment) blockers(uuid gocql.UUID) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	blocked := []string{}
+	if c.contained(uuid, map[gocql.UUID]bool{}) {
+		return blocked
+	}
+	for _, p := range c.queues[uuid].paths {
+		blocker := ""
+		for parent := path.Dir(path.Clean(p)); parent != "/" && parent != "."; parent = path.Dir(parent) {
+			node := c.node(parent, false)
+			if node == nil || len(node.queues) == 0 {
+				continue
+			}
+			anyOpen := false
+			for _, q := range node.queues {
+				if c.open(q, map[gocql.UUID]bool{uuid: true}) {
+					anyOpen = true
+					break
+				}
+			}
+			if !anyOpen {
+				blocker = parent
+			}
+		}
+		if blocker != "" {
+			blocked = append(blocked, blocker)
+		}
+	}
+	return blocked
+}
+
+// queuesAt returns the queues found at thepath
+func (c *containment) queuesAt(thepath string) []gocql.UUID {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	node := c.node(thepath, false)
+	if node == nil {
+		return []gocql.UUID{}
+	}
+	return append([]gocql.UUID{}, node.queues...)
+}
@@ -0,0 +1,247 @@
+package dike
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"testing"
+)
+
+type containmentQueue struct {
+	name  string
+	paths []string
+	mode  string
+	open  bool
+}
+
+// buildContainment records the queues in a new containment tree, returning them by name
+func buildContainment(queues []containmentQueue) (*containment, map[string]*types.Queue) {
+	c := newContainment()
+	byName := map[string]*types.Queue{}
+	for _, q := range queues {
+		queue := &types.Queue{UUID: gocql.TimeUUID(), Name: q.name, OurPaths: q.paths, Containment: q.mode}
+		c.add(queue, make(chan bool, 1))
+		c.setWindowOpen(queue.UUID, q.open)
+		byName[q.name] = queue
+	}
+	return c, byName
+}
+
+func TestContainmentIsContained(t *testing.T) {
+	tests := []struct {
+		name     string
+		queues   []containmentQueue
+		expected bool
+	}{
+		{"without paths", []containmentQueue{
+			{"q", nil, "", true},
+		}, true},
+		{"at the root", []containmentQueue{
+			{"q", []string{"/q"}, "", true},
+		}, true},
+		{"open parent", []containmentQueue{
+			{"parent", []string{"/a"}, "", true},
+			{"q", []string{"/a/q"}, "", true},
+		}, true},
+		{"closed parent", []containmentQueue{
+			{"parent", []string{"/a"}, "", false},
+			{"q", []string{"/a/q"}, "", true},
+		}, false},
+		{"one of several parents open", []containmentQueue{
+			{"first", []string{"/a"}, "", false},
+			{"second", []string{"/a"}, "", true},
+			{"q", []string{"/a/q"}, "", true},
+		}, true},
+		{"parent further up the path", []containmentQueue{
+			{"parent", []string{"/a"}, "", false},
+			{"q", []string{"/a/b/c/q"}, "", true},
+		}, false},
+		{"nested parents open", []containmentQueue{
+			{"grandparent", []string{"/a"}, "", true},
+			{"parent", []string{"/a/b"}, "", true},
+			{"q", []string{"/a/b/q"}, "", true},
+		}, true},
+		{"nested parent closed", []containmentQueue{
+			{"grandparent", []string{"/a"}, "", true},
+			{"parent", []string{"/a/b"}, "", false},
+			{"q", []string{"/a/b/q"}, "", true},
+		}, false},
+		{"open parent of a closed grandparent", []containmentQueue{
+			{"grandparent", []string{"/a"}, "", false},
+			{"parent", []string{"/a/b"}, "", true},
+			{"q", []string{"/a/b/q"}, "", true},
+		}, false},
+		{"all paths with one path closed", []containmentQueue{
+			{"a", []string{"/a"}, "", true},
+			{"b", []string{"/b"}, "", false},
+			{"q", []string{"/a/q", "/b/q"}, types.QueueContainmentAll, true},
+		}, false},
+		{"all paths open", []containmentQueue{
+			{"a", []string{"/a"}, "", true},
+			{"b", []string{"/b"}, "", true},
+			{"q", []string{"/a/q", "/b/q"}, types.QueueContainmentAll, true},
+		}, true},
+		{"any path with one path open", []containmentQueue{
+			{"a", []string{"/a"}, "", true},
+			{"b", []string{"/b"}, "", false},
+			{"q", []string{"/a/q", "/b/q"}, types.QueueContainmentAny, true},
+		}, true},
+		{"any path with only the last path open", []containmentQueue{
+			{"a", []string{"/a"}, "", false},
+			{"b", []string{"/b"}, "", false},
+			{"c", []string{"/c"}, "", true},
+			{"q", []string{"/a/q", "/b/q", "/c/q"}, types.QueueContainmentAny, true},
+		}, true},
+		{"all paths with only the last path open", []containmentQueue{
+			{"a", []string{"/a"}, "", false},
+			{"b", []string{"/b"}, "", false},
+			{"c", []string{"/c"}, "", true},
+			{"q", []string{"/a/q", "/b/q", "/c/q"}, "", true},
+		}, false},
+		{"any path with every path closed", []containmentQueue{
+			{"a", []string{"/a"}, "", false},
+			{"b", []string{"/b"}, "", false},
+			{"q", []string{"/a/q", "/b/q"}, types.QueueContainmentAny, true},
+		}, false},
+		{"nested paths of the same queue", []containmentQueue{
+			{"q", []string{"/a", "/a/b"}, "", true},
+		}, true},
+	}
+	for _, test := range tests {
+		c, queues := buildContainment(test.queues)
+		if contained := c.isContained(queues["q"].UUID); contained != test.expected {
+			t.Errorf("%s: expected contained to be %v", test.name, test.expected)
+		}
+		if open := c.isOpen(queues["q"].UUID); open != test.expected {
+			t.Errorf("%s: expected open to be %v", test.name, test.expected)
+		}
+	}
+}
+
+func TestContainmentUpdateAndRemove(t *testing.T) {
+	c, queues := buildContainment([]containmentQueue{
+		{"closed", []string{"/a"}, "", false},
+		{"open", []string{"/b"}, "", true},
+		{"q", []string{"/a/q"}, "", true},
+	})
+	q := queues["q"]
+	if c.isContained(q.UUID) {
+		t.Fatal("expected queue beneath a closed queue not to be contained")
+	}
+
+	// moving the queue beneath the open queue keeps its window
+	q.OurPaths = []string{"/b/q"}
+	c.update(q)
+	if !c.isContained(q.UUID) || !c.isOpen(q.UUID) {
+		t.Error("expected queue moved beneath an open queue to be open")
+	}
+	if len(c.queuesAt("/a/q")) != 0 || len(c.queuesAt("/b/q")) != 1 {
+		t.Error("expected the queue to be recorded at its new path only")
+	}
+
+	// with several paths the mode decides
+	q.OurPaths = []string{"/a/q", "/b/q"}
+	c.update(q)
+	if c.isContained(q.UUID) {
+		t.Error("expected queue to require all of its paths")
+	}
+	q.Containment = types.QueueContainmentAny
+	c.update(q)
+	if !c.isContained(q.UUID) {
+		t.Error("expected queue to require any of its paths")
+	}
+
+	// without the closed queue nothing blocks the queue
+	q.Containment = ""
+	c.update(q)
+	c.remove(queues["closed"].UUID)
+	if !c.isContained(q.UUID) {
+		t.Error("expected queue to be contained once the closed queue is removed")
+	}
+	c.remove(q.UUID)
+	if c.isOpen(q.UUID) || len(c.queuesAt("/b/q")) != 0 {
+		t.Error("expected a removed queue to be forgotten")
+	}
+}
+
+func TestContainmentSetWindowOpen(t *testing.T) {
+	c, queues := buildContainment([]containmentQueue{
+		{"parent", []string{"/a"}, "", false},
+		{"q", []string{"/a/q"}, "", false},
+	})
+	q := queues["q"]
+	c.setWindowOpen(queues["parent"].UUID, true)
+	if !c.isContained(q.UUID) || c.isOpen(q.UUID) {
+		t.Error("expected queue to be contained but closed")
+	}
+	c.setWindowOpen(q.UUID, true)
+	if !c.isOpen(q.UUID) {
+		t.Error("expected queue to be open")
+	}
+	c.setWindowOpen(queues["parent"].UUID, false)
+	if c.isContained(q.UUID) || c.isOpen(q.UUID) {
+		t.Error("expected queue to lose containment as its parent closes")
+	}
+	if blockers := c.blockers(q.UUID); len(blockers) != 1 || blockers[0] != "/a" {
+		t.Errorf("expected queue to be blocked at /a but was %v", blockers)
+	}
+}
+
+func TestContainmentNotifiesAffectedQueues(t *testing.T) {
+	c := newContainment()
+	notifications := map[string]chan bool{}
+	queues := map[string]*types.Queue{}
+	for _, q := range []containmentQueue{
+		{"a", []string{"/a"}, "", false},
+		{"b", []string{"/b"}, "", false},
+		{"child of a", []string{"/a/x"}, "", false},
+		{"child of b", []string{"/b/y"}, "", false},
+		{"grandchild of a", []string{"/a/x/z"}, "", false},
+		{"child of a and b", []string{"/a/w", "/b/w"}, "", false},
+		{"elsewhere", []string{"/c/q"}, "", false},
+	} {
+		queue := &types.Queue{UUID: gocql.TimeUUID(), Name: q.name, OurPaths: q.paths}
+		notifications[q.name] = make(chan bool, 1)
+		queues[q.name] = queue
+		c.add(queue, notifications[q.name])
+	}
+	notified := func() map[string]bool {
+		seen := map[string]bool{}
+		for name, notify := range notifications {
+			select {
+			case <-notify:
+				seen[name] = true
+			default:
+			}
+		}
+		return seen
+	}
+	notified()
+
+	tests := []struct {
+		name     string
+		queue    string
+		open     bool
+		expected []string
+	}{
+		{"parent opens", "a", true, []string{"child of a", "grandchild of a", "child of a and b"}},
+		{"parent is already open", "a", true, []string{}},
+		{"other parent opens", "b", true, []string{"child of b", "child of a and b"}},
+		{"child closes", "child of a", false, []string{}},
+		{"child opens", "child of a", true, []string{"grandchild of a"}},
+		{"parent closes", "a", false, []string{"child of a", "grandchild of a", "child of a and b"}},
+		{"leaf opens", "grandchild of a", true, []string{}},
+	}
+	for _, test := range tests {
+		c.setWindowOpen(queues[test.queue].UUID, test.open)
+		seen := notified()
+		if len(seen) != len(test.expected) {
+			t.Errorf("%s: expected %v to be notified but was %v", test.name, test.expected, seen)
+			continue
+		}
+		for _, name := range test.expected {
+			if !seen[name] {
+				t.Errorf("%s: expected %v to be notified but was %v", test.name, test.expected, seen)
+			}
+		}
+	}
+}
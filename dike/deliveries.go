@@ -0,0 +1,61 @@
+package dike
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/kieranbroadfoot/horae/types"
+	"time"
+)
+
+const (
+	// how often pending deliveries are checked for retries
+	deliveryCheckInterval = 15 * time.Second
+	// the time allowed for an attempt before the delivery is considered due again
+	deliveryLease = 2 * time.Minute
+	// a delivery overdue by this much has been abandoned by its node and may be claimed by another
+	deliveryAbandoned = 5 * time.Minute
+)
+
+// recordDeliveries returns the event recorder of the node.  Each delivery of an event published by this node is
+// recorded as the event is published, before it reaches etcd, and then attempted.
+func recordDeliveries(node types.Node) func(types.Event) {
+	return func(event types.Event) {
+		// every event is delivered by the node which published it
+		event.Node = node.UUID
+		for _, subscription := range types.MatchingSubscriptions(event) {
+			delivery, err := types.NewDelivery(subscription, event, node.UUID)
+			if err != nil {
+				log.WithFields(log.Fields{"subscription": subscription.UUID, "error": err}).Warn("Unable to record delivery")
+				continue
+			}
+			go delivery.Attempt(deliveryLease)
+		}
+	}
+}
+
+// deliverEvents retries the deliveries which are due, whether they failed on this node or were abandoned by another
+// (e.g. one which has stopped), until they succeed or are dead-lettered.
+func deliverEvents(node types.Node) {
+	log.Info("Event delivery started")
+	clock := types.GetClock()
+	timer := clock.NewTimer(deliveryCheckInterval)
+	for {
+		<-timer.C()
+		// pick up subscriptions changed on other nodes
+		types.RefreshSubscriptions()
+		now := clock.Now()
+		for _, delivery := range types.GetPendingDeliveries() {
+			if delivery.NextAttempt.After(now) {
+				continue
+			}
+			if delivery.Node != node.UUID {
+				if now.Sub(delivery.NextAttempt) < deliveryAbandoned || !delivery.Claim(node.UUID) {
+					continue
+				}
+				log.WithFields(log.Fields{"delivery": delivery.UUID}).Info("Claimed abandoned delivery")
+			}
+			retry := delivery
+			go retry.Attempt(deliveryLease)
+		}
+		timer = clock.NewTimer(deliveryCheckInterval)
+	}
+}
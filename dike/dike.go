@@ -3,18 +3,18 @@ package dike
 import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/kieranbroadfoot/horae/types"
-	"path"
 )
 
-var knownQueues []*types.Queue
-
 func StartDike(node types.Node, failure chan bool, toEunomia chan types.EunomiaRequest) {
 	log.Print("Starting Dike")
 
+	// deliveries are recorded as events are published so the recorder is set before any queue manager starts
+	types.SetEventRecorder(recordDeliveries(node))
+	go deliverEvents(node)
+
 	for _, queue := range types.GetQueues() {
 		savedQ := queue
-		knownQueues = append(knownQueues, &savedQ)
-		go queueManager(&savedQ, toEunomia)
+		go queueManager(node, &savedQ, toEunomia)
 	}
 
 	// monitor for updates (create/delete) in etcd
@@ -26,38 +26,13 @@ func StartDike(node types.Node, failure chan bool, toEunomia chan types.EunomiaR
 		case queueResponse := <-channelFromMonitor:
 			if queueResponse.Action == types.EunomiaActionCreate {
 				queue, err := types.GetQueue(queueResponse.UUID.String())
-				if err == nil {
-					knownQueues = append(knownQueues, &queue)
-					go queueManager(&queue, toEunomia)
+				if err == nil && !Draining() {
+					go queueManager(node, &queue, toEunomia)
 				}
 			} else if queueResponse.Action == types.EunomiaActionDelete {
-				for idx, b := range knownQueues {
-					if b.UUID == queueResponse.UUID {
-						knownQueues = append(knownQueues[:idx], knownQueues[idx+1:]...)
-					}
-				}
-			}
-		}
-	}
-}
-
-func shouldRun(thepath string) bool {
-	foundMatch := false
-	for _, q := range knownQueues {
-		if q.MatchesPath(thepath) {
-			foundMatch = true
-			if thepath == "/" {
-				return true
-			} else {
-				if q.IsRunning() {
-					return shouldRun(path.Dir(thepath))
-				}
+				// the deleted queue (and its paths) no longer contain other queues
+				containmentTree.remove(queueResponse.UUID)
 			}
 		}
 	}
-	if foundMatch == false {
-		// there was no queue that exists at this path. that's ok. keep going
-		return shouldRun(path.Dir(thepath))
-	}
-	return false
 }
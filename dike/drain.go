@@ -0,0 +1,55 @@
+package dike
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/kieranbroadfoot/horae/types"
+	"sync"
+	"time"
+)
+
+// how long Drain waits for the queue managers to release their queues
+const releaseTimeout = 5 * time.Second
+
+// closed when the node starts draining (queue managers stop claiming and executing queues) and when the queues are to
+// be released
+var (
+	stopping  = make(chan bool)
+	releasing = make(chan bool)
+	drainOnce sync.Once
+)
+
+// Draining determines if the node is draining
+func Draining() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain stops the node claiming queues and executing tasks, waits until the deadline for the tasks and actions being
+// executed to finish and then releases the queues it owns so other nodes take them over without waiting for the
+// ownership to expire.  Queues are released only once execution has finished so their tasks are not executed twice.
+func Drain(deadline time.Time) {
+	drainOnce.Do(func() {
+		drain(deadline, types.WaitForInFlight)
+	})
+}
+
+// drain drains the node, using waitForInFlight to wait for the work being executed
+func drain(deadline time.Time, waitForInFlight func(time.Time) bool) {
+	log.WithFields(log.Fields{"queues": len(OwnedQueues()), "inFlight": types.InFlight()}).Info("Draining node")
+	close(stopping)
+	if !waitForInFlight(deadline) {
+		log.WithFields(log.Fields{"inFlight": types.InFlight()}).Warn("Drain deadline passed, abandoning running tasks and actions")
+	}
+	close(releasing)
+	timeout := types.GetClock().NewTimer(releaseTimeout)
+	defer timeout.Stop()
+	select {
+	case <-allReleased():
+	case <-timeout.C():
+	}
+	log.WithFields(log.Fields{"unreleased": len(OwnedQueues())}).Info("Released queues")
+}
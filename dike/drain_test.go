@@ -0,0 +1,109 @@
+package dike
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useDrain starts the test with a node which is not draining, and a fake clock, restoring both once the test completes
+func useDrain(t *testing.T) *types.FakeClock {
+	previousStopping, previousReleasing, previousClock := stopping, releasing, types.GetClock()
+	stopping, releasing, drainOnce = make(chan bool), make(chan bool), sync.Once{}
+	clock := types.NewFakeClock(time.Date(2026, time.October, 12, 9, 0, 0, 0, time.UTC))
+	types.SetClock(clock)
+	t.Cleanup(func() {
+		stopping, releasing, drainOnce = previousStopping, previousReleasing, sync.Once{}
+		types.SetClock(previousClock)
+	})
+	return clock
+}
+
+func isClosed(ch chan bool) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestDrainWaitsForInFlightWorkThenReleases(t *testing.T) {
+	clock := useDrain(t)
+	queue := gocql.TimeUUID()
+	setOwned(queue, true)
+	defer setOwned(queue, false)
+
+	deadline := clock.Now().Add(time.Minute)
+	waiting := make(chan time.Time)
+	finished := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		drain(deadline, func(until time.Time) bool {
+			waiting <- until
+			<-finished
+			return true
+		})
+		close(done)
+	}()
+
+	if until := <-waiting; !until.Equal(deadline) {
+		t.Errorf("expected to wait for work until %v but was %v", deadline, until)
+	}
+	if !Draining() {
+		t.Error("expected the node to stop claiming queues before waiting for work")
+	}
+	if isClosed(releasing) {
+		t.Fatal("expected the queues not to be released while work is in flight")
+	}
+	close(finished)
+
+	// the queue manager releases its queue
+	select {
+	case <-releasing:
+	case <-time.After(time.Second):
+		t.Fatal("expected the queues to be released once the work finished")
+	}
+	if isClosed(done) {
+		t.Fatal("expected the drain to wait for the queues to be released")
+	}
+	setOwned(queue, false)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the drain to finish once the queues were released")
+	}
+}
+
+func TestDrainGivesUpWaitingForRelease(t *testing.T) {
+	clock := useDrain(t)
+	queue := gocql.TimeUUID()
+	setOwned(queue, true)
+	defer setOwned(queue, false)
+
+	done := make(chan bool)
+	go func() {
+		Drain(clock.Now().Add(time.Minute))
+		close(done)
+	}()
+	// nothing is in flight so only the release timeout is waited for
+	clock.BlockUntil(1)
+	if !isClosed(releasing) {
+		t.Error("expected the queues to be released")
+	}
+	clock.Advance(releaseTimeout - time.Second)
+	if isClosed(done) {
+		t.Fatal("expected the drain to wait for the release timeout")
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the drain to finish at the release timeout")
+	}
+	if len(OwnedQueues()) != 1 {
+		t.Errorf("expected the queue to remain unreleased but owned %v", OwnedQueues())
+	}
+}
@@ -0,0 +1,70 @@
+package dike
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"sort"
+	"sync"
+)
+
+// ownedQueues records the queues of which this node is master.  released is closed whenever the node owns no queues.
+var ownedQueues = struct {
+	sync.RWMutex
+	queues   map[gocql.UUID]bool
+	released chan bool
+}{queues: map[gocql.UUID]bool{}, released: closedChannel()}
+
+func closedChannel() chan bool {
+	ch := make(chan bool)
+	close(ch)
+	return ch
+}
+
+func setOwned(uuid gocql.UUID, owned bool) {
+	ownedQueues.Lock()
+	defer ownedQueues.Unlock()
+	if owned {
+		if len(ownedQueues.queues) == 0 {
+			ownedQueues.released = make(chan bool)
+		}
+		ownedQueues.queues[uuid] = true
+	} else if ownedQueues.queues[uuid] {
+		delete(ownedQueues.queues, uuid)
+		if len(ownedQueues.queues) == 0 {
+			close(ownedQueues.released)
+		}
+	}
+}
+
+// allReleased returns a channel which is closed once the node owns no queues
+func allReleased() <-chan bool {
+	ownedQueues.RLock()
+	defer ownedQueues.RUnlock()
+	return ownedQueues.released
+}
+
+// OwnedQueues returns the queues of which this node is currently master
+func OwnedQueues() []gocql.UUID {
+	ownedQueues.RLock()
+	defer ownedQueues.RUnlock()
+	queues := []gocql.UUID{}
+	for uuid := range ownedQueues.queues {
+		queues = append(queues, uuid)
+	}
+	sort.Sort(uuidsByString(queues))
+	return queues
+}
+
+// recordOwnership records a change in the ownership of the queue by this node in its history
+func recordOwnership(queue *types.Queue, node types.Node, event string, reason string) {
+	if err := types.RecordOwnershipChange(queue.UUID, node, event, reason); err != nil {
+		log.WithFields(log.Fields{"queue": queue.UUID, "event": event, "error": err}).Warn("Unable to record ownership change")
+	}
+}
+
+type uuidsByString []gocql.UUID
+
+func (u uuidsByString) Len() int           { return len(u) }
+func (u uuidsByString) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u uuidsByString) Less(i, j int) bool { return u[i].String() < u[j].String() }
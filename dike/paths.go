@@ -0,0 +1,116 @@
+package dike
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kieranbroadfoot/horae/types"
+	"path"
+	"sort"
+	"strings"
+)
+
+// PathTree loads the queues from the store and returns the hierarchy of paths at and beneath prefix, with the current
+// state and containment of each queue found there
+func PathTree(prefix string) (types.PathNode, error) {
+	return pathTree(types.GetQueues(), prefix)
+}
+
+func pathTree(queues []types.Queue, prefix string) (types.PathNode, error) {
+	if prefix == "" {
+		prefix = "/"
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		return types.PathNode{}, errors.New("The prefix must begin with /")
+	}
+	prefix = path.Clean(prefix)
+
+	// containment is evaluated over every queue, not just those beneath the prefix
+	sort.Sort(byName(queues))
+	tree := newContainment()
+	for idx := range queues {
+		q := &queues[idx]
+		tree.add(q, nil)
+		tree.setWindowOpen(q.UUID, q.LoadWindow() == nil && windowIsOpen(q))
+	}
+
+	nodes := map[string][]types.PathQueue{prefix: []types.PathQueue{}}
+	children := map[string]map[string]bool{}
+	for idx := range queues {
+		q := &queues[idx]
+		for _, p := range q.OurPaths {
+			p = path.Clean(p)
+			if prefix != "/" && p != prefix && !strings.HasPrefix(p, prefix+"/") {
+				continue
+			}
+			nodes[p] = append(nodes[p], describePathQueue(tree, queues, q))
+			for child := p; child != prefix && child != "."; child = path.Dir(child) {
+				parent := path.Dir(child)
+				if children[parent] == nil {
+					children[parent] = map[string]bool{}
+				}
+				children[parent][child] = true
+				if _, ok := nodes[parent]; !ok {
+					nodes[parent] = []types.PathQueue{}
+				}
+			}
+		}
+	}
+	return buildPathNode(prefix, nodes, children), nil
+}
+
+func buildPathNode(thepath string, nodes map[string][]types.PathQueue, children map[string]map[string]bool) types.PathNode {
+	node := types.PathNode{Path: thepath, Queues: nodes[thepath], Children: []types.PathNode{}}
+	paths := []string{}
+	for child := range children[thepath] {
+		paths = append(paths, child)
+	}
+	sort.Strings(paths)
+	for _, child := range paths {
+		node.Children = append(node.Children, buildPathNode(child, nodes, children))
+	}
+	return node
+}
+
+func describePathQueue(tree *containment, queues []types.Queue, q *types.Queue) types.PathQueue {
+	description := types.PathQueue{UUID: q.UUID, Name: q.Name, Status: q.Status, Containment: q.Containment, Contained: tree.isContained(q.UUID)}
+	if description.Containment == "" {
+		description.Containment = types.QueueContainmentAll
+	}
+	switch {
+	case tree.isOpen(q.UUID):
+		description.State = types.PathQueueOpen
+	case q.Window.GetNextStartTime().After(types.GetClock().Now()):
+		description.State = types.PathQueueClosed
+	default:
+		description.State = types.PathQueuePaused
+	}
+	for _, blocker := range tree.blockers(q.UUID) {
+		description.Blocked = append(description.Blocked, describeBlocker(tree, queues, blocker))
+	}
+	return description
+}
+
+// describeBlocker explains why the queues at thepath are closed, e.g. "parent /apps closed until 04:00 on 24/10/2026"
+func describeBlocker(tree *containment, queues []types.Queue, thepath string) string {
+	now := types.GetClock().Now()
+	var opens *types.Queue
+	for _, uuid := range tree.queuesAt(thepath) {
+		for idx := range queues {
+			q := &queues[idx]
+			if q.UUID == uuid && q.Window.Opens() && q.Window.GetNextStartTime().After(now) && (opens == nil || q.Window.GetNextStartTime().Before(opens.Window.GetNextStartTime())) {
+				opens = q
+			}
+		}
+	}
+	if opens == nil {
+		// the queues at the path never open (or are themselves blocked)
+		return fmt.Sprintf("parent %s closed", thepath)
+	}
+	return fmt.Sprintf("parent %s closed until %s", thepath, opens.Window.GetNextStartTime().Format("15:04 on 02/01/2006"))
+}
+
+type byName []types.Queue
+
+func (q byName) Len() int           { return len(q) }
+func (q byName) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q byName) Less(i, j int) bool { return q[i].Name < q[j].Name }
@@ -4,7 +4,6 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/kieranbroadfoot/horae/types"
 	"time"
-	"path"
 )
 
 const (
@@ -12,7 +11,7 @@ const (
 	ContinuingExecution   = false
 )
 
-func queueManager(queue *types.Queue, toEunomia chan types.EunomiaRequest) {
+func queueManager(node types.Node, queue *types.Queue, toEunomia chan types.EunomiaRequest) {
 	log.WithFields(log.Fields{"queue": queue.UUID}).Info("Queue manager started")
 
 	channelToMonitor := make(chan types.EunomiaQueueRequest)
@@ -22,6 +21,20 @@ func queueManager(queue *types.Queue, toEunomia chan types.EunomiaRequest) {
 	toEunomia <- types.EunomiaRequest{Action: types.EunomiaQueueMonitor, ChannelFromQueueManager: channelToMonitor, ChannelToQueueManager: channelFromMonitor, QueueUUID: queue.UUID}
 
 	queueMaster := false
+	// true while this node is executing the queue
+	executing := false
+	// true while this node claims the queue (from the pre state until the queue is released)
+	claimed := false
+	// once the node is draining the queue is neither claimed nor executed, and is released when the node is ready
+	draining := false
+	stopCh, releaseCh := stopping, releasing
+	defer func() {
+		if queueMaster {
+			setOwned(queue.UUID, false)
+			types.MetricQueuesOwned.Add(-1, node.UUID.String())
+			forgetQueueMetrics(queue)
+		}
+	}()
 
 	// Load window of operation
 	err := queue.LoadWindow()
@@ -29,84 +42,77 @@ func queueManager(queue *types.Queue, toEunomia chan types.EunomiaRequest) {
 		log.WithFields(log.Fields{"queue": queue.UUID}).Info("Queue failed to start (invalid window definition)")
 	}
 
+	// record the queue in the containment tree.  we are notified whenever a change to a containing queue may
+	// affect whether this queue can run
+	containmentChanged := make(chan bool, 1)
+	containmentTree.add(queue, containmentChanged)
+	defer containmentTree.remove(queue.UUID)
+	containmentTree.setWindowOpen(queue.UUID, err == nil && windowIsOpen(queue))
+
+	clock := types.GetClock()
 	state := "pre"
-	timer := time.NewTimer(queueTime(queue, "pre"))
+	timer := clock.NewTimer(queueTime(queue, "pre"))
+
+	// backpressure is checked whenever a task changes and periodically (as the oldest task ages) by the master
+	backpressure := types.Backpressure{}
+	// the settings the queue inherits only change when the queue or a queue along its paths changes, which is when
+	// the containment tree notifies us
+	effective := queue.Effective()
+	backpressureTimer := clock.NewTimer(types.BackpressureCheckInterval)
+	defer func() { backpressureTimer.Stop() }()
 
 	for {
 		select {
-		case <-timer.C:
+		case <-timer.C():
+			if draining {
+				break
+			}
 			switch state {
 			case "pre":
 				// claim master
 				channelToMonitor <- types.EunomiaQueueRequest{Action: types.EunomiaRequestBecomeMaster, QueueUUID: queue.UUID}
-				timer = time.NewTimer(queueTime(queue, "start"))
+				claimed = true
+				timer = clock.NewTimer(queueTime(queue, "start"))
 				state = "start"
 			case "start":
-				// start executing the queue - if we are not master we dont do anything
-				resetStart := false
+				// our window is open.  start executing the queue if it is contained - if we are not master we dont
+				// do anything.  if it is not contained we wait to be notified of a change in containment
+				containmentTree.setWindowOpen(queue.UUID, true)
 				if queueMaster {
-					willRun := false
-					if len(queue.OurPaths) == 0 {
-						// if the queue has no defined paths then check against the root queue only
-						// this is equivalent to always returning true but we may allow changes to the root queue in the future
-						willRun = shouldRun("/")
-					} else {
-						for _, p := range queue.OurPaths {
-							// each path of the queue.
-							willRun = shouldRun(path.Dir(p))
-						}
-					}
-					if willRun {
-						go queue.StartOrContinueExecution(StartingExecution)
+					types.MetricWindowTransitions.Inc(queue.UUID.String(), "open")
+					if containmentTree.isContained(queue.UUID) {
+						executing = true
+						queueTransition(queue, types.EventQueueOpened, "", "Window Opened")
+						go queue.StartOrContinueExecution(StartingExecution, queue.Transition)
+						reportOpen(queue, true)
 					} else {
-						// what to do if the queue is not currently contained but should be running
-						resetStart = true
-					}
-				}
-				if resetStart {
-					// let's try and restart the queue in 60 seconds. maybe one of the containing queues will
-					// start operations.  We'll give up if we are about to hit the end time for this window
-					endTime := queueTime(queue, "stop")
-					if endTime < 60 * time.Second {
-						// about to reach the end of our window.  jump to end state
-						state = "end"
-						timer = time.NewTimer(endTime)
-					} else {
-						timer = time.NewTimer(60 * time.Second)
-					}
-				} else {
-					state = "running"
-					timer = time.NewTimer(60 * time.Second)
-				}
-			case "running":
-				continueRunning := true
-				for _, p := range queue.OurPaths {
-					// check if queue is *still* contained
-					continueRunning = shouldRun(path.Dir(p))
-				}
-				if !continueRunning {
-					queue.StopExecution("Lost Containment")
-					// if we are no longer contained.  set state back to start.  we may be available again before we reach our end state
-					state = "start"
-					timer = time.NewTimer(60 * time.Second)
-				} else {
-					// continue running and check again for containment in 60 seconds
-					endTime := queueTime(queue, "stop")
-					if endTime < 60 * time.Second {
-						state = "end"
-						timer = time.NewTimer(queueTime(queue, "stop"))
-					} else {
-						state = "running"
-						timer = time.NewTimer(60 * time.Second)
+						log.WithFields(log.Fields{"queue": queue.UUID}).Info("Queue awaiting containment")
+						queueTransition(queue, types.EventQueuePaused, "", "Awaiting Containment")
 					}
 				}
+				state = "end"
+				timer = clock.NewTimer(queueTime(queue, "stop"))
 			case "end":
 				// release queue via eunomia
+				containmentTree.setWindowOpen(queue.UUID, false)
 				queue.StopExecution("Window Closed")
+				executing = false
+				if queueMaster {
+					queueTransition(queue, types.EventQueueClosed, "", "Window Closed")
+					types.MetricWindowTransitions.Inc(queue.UUID.String(), "closed")
+					reportOpen(queue, false)
+					// releasing the queue gives up ownership until it is claimed again before the next window
+					queueMaster = false
+					setOwned(queue.UUID, false)
+					types.MetricQueuesOwned.Add(-1, node.UUID.String())
+					forgetQueueMetrics(queue)
+					recordOwnership(queue, node, types.OwnershipReleased, "Window Closed")
+				}
 				channelToMonitor <- types.EunomiaQueueRequest{Action: types.EunomiaRequestReleaseMaster, QueueUUID: queue.UUID}
+				claimed = false
 				state = "pre"
-				timer = time.NewTimer(queueTime(queue, "pre"))
-				if queue.CountOfTasks() == 0 && queue.Status == types.QueueDeleting {
+				timer = clock.NewTimer(queueTime(queue, "pre"))
+				if queue.Status == types.QueueDeleting && queue.CountOfTasks() == 0 {
 					// no more tasks available in the queue, and queue in a deleting state.  set state to delete.
 					queue.Status = types.QueueDeleted
 					queue.CreateOrUpdate()
@@ -114,24 +120,82 @@ func queueManager(queue *types.Queue, toEunomia chan types.EunomiaRequest) {
 					return
 				}
 			}
+		case <-backpressureTimer.C():
+			if queueMaster {
+				backpressure.Check(effective)
+				reportDepth(queue)
+			}
+			backpressureTimer = clock.NewTimer(types.BackpressureCheckInterval)
+		case <-containmentChanged:
+			effective = queue.Effective()
+			// a containing queue opened or closed.  only relevant while our own window is open
+			if queueMaster && state == "end" {
+				contained := containmentTree.isContained(queue.UUID)
+				if contained && !executing {
+					executing = true
+					queueTransition(queue, types.EventQueueOpened, "", "Gained Containment")
+					go queue.StartOrContinueExecution(StartingExecution, queue.Transition)
+					reportOpen(queue, true)
+				} else if !contained && executing {
+					executing = false
+					queue.StopExecution("Lost Containment")
+					queueTransition(queue, types.EventQueuePaused, "", "Lost Containment")
+					reportOpen(queue, false)
+				}
+			}
+		case <-stopCh:
+			// the node is draining.  stop executing the queue but keep ownership until running tasks have finished
+			stopCh = nil
+			draining = true
+			timer.Stop()
+			queue.StopExecution("Node Draining")
+			executing = false
+			if queueMaster {
+				queueTransition(queue, types.EventQueueClosed, "", "Node Draining")
+				reportOpen(queue, false)
+			}
+		case <-releaseCh:
+			if claimed {
+				releaseQueue(queue, channelToMonitor, channelFromMonitor)
+			}
+			if queueMaster {
+				recordOwnership(queue, node, types.OwnershipReleased, "Node Draining")
+			}
+			log.WithFields(log.Fields{"queue": queue.UUID.String(), "reason": "node drained"}).Info("Queue manager shutting down")
+			return
 		case queueResponse := <-channelFromMonitor:
 			if queueResponse.Action == types.EunomiaResponseBecameQueueMaster {
-				if queueMaster != true {
+				if queueMaster != true && !draining {
 					log.WithFields(log.Fields{"queue": queue.UUID, "status": "master"}).Info("Changing queue status")
 					queueMaster = true
+					queueTransition(queue, types.EventQueueOwner, "master", "")
+					setOwned(queue.UUID, true)
+					types.MetricQueuesOwned.Add(1, node.UUID.String())
+					recordOwnership(queue, node, types.OwnershipAcquired, "")
+					reportOpen(queue, false)
+					reportDepth(queue)
 					state = "start"
-					timer = time.NewTimer(queueTime(queue, "start"))
+					timer.Stop()
+					timer = clock.NewTimer(queueTime(queue, "start"))
 				}
 			} else if queueResponse.Action == types.EunomiaResponseBecameQueueSlave {
 				if queueMaster != false {
 					log.WithFields(log.Fields{"queue": queue.UUID, "status": "slave"}).Info("Changing queue status")
 					queueMaster = false
+					queueTransition(queue, types.EventQueueOwner, "slave", "")
 					queue.StopExecution("Lost Ownership")
+					executing = false
+					setOwned(queue.UUID, false)
+					types.MetricQueuesOwned.Add(-1, node.UUID.String())
+					forgetQueueMetrics(queue)
+					recordOwnership(queue, node, types.OwnershipReleased, "Lost Ownership")
+					// the new master measures the queue afresh
+					backpressure = types.Backpressure{}
 				}
 			} else if queueResponse.Action == types.EunomiaActionCreate {
 				if queueResponse.Type == types.EunomiaTask {
 					if queueMaster == true {
-						queue.CheckBackpressure()
+						backpressure.Check(effective)
 					}
 					queue.UpdatedTask(types.EunomiaActionCreate, queueResponse.UUID.String())
 				}
@@ -139,17 +203,25 @@ func queueManager(queue *types.Queue, toEunomia chan types.EunomiaRequest) {
 				if queueResponse.Type == types.EunomiaQueue {
 					// reload queue from DB
 					q, err := types.GetQueue(queueResponse.UUID.String())
-					if err == nil {
+					if err == nil && q.LoadWindow() == nil {
 						queue = &q
+						effective = queue.Effective()
+						containmentTree.update(queue)
+						containmentTree.setWindowOpen(queue.UUID, windowIsOpen(queue))
 					}
 					// stop execution (we don't know precisely what changed so the best bet is to reset)
 					queue.StopExecution("Queue Updated")
+					executing = false
+					if queueMaster {
+						reportOpen(queue, false)
+					}
 					// reset timer to pre state
 					state = "pre"
-					timer = time.NewTimer(queueTime(queue, "pre"))
+					timer.Stop()
+					timer = clock.NewTimer(queueTime(queue, "pre"))
 				} else if queueResponse.Type == types.EunomiaTask {
 					if queueMaster == true {
-						queue.CheckBackpressure()
+						backpressure.Check(effective)
 					}
 					queue.UpdatedTask(types.EunomiaActionUpdate, queueResponse.UUID.String())
 				}
@@ -160,7 +232,7 @@ func queueManager(queue *types.Queue, toEunomia chan types.EunomiaRequest) {
 					return
 				} else if queueResponse.Type == types.EunomiaTask {
 					if queueMaster == true {
-						queue.CheckBackpressure()
+						backpressure.Check(effective)
 					}
 					queue.UpdatedTask(types.EunomiaActionDelete, queueResponse.UUID.String())
 				}
@@ -172,7 +244,7 @@ func queueManager(queue *types.Queue, toEunomia chan types.EunomiaRequest) {
 					queue.ReceivedCompletionForTask(queueResponse.UUID.String())
 					if queue.IsRunning() {
 						// only continue if the queue is still open for business
-						go queue.StartOrContinueExecution(ContinuingExecution)
+						go queue.StartOrContinueExecution(ContinuingExecution, queue.Transition)
 					}
 				}
 			}
@@ -180,8 +252,72 @@ func queueManager(queue *types.Queue, toEunomia chan types.EunomiaRequest) {
 	}
 }
 
+// releaseQueue asks the queue monitor to release the queue and waits until it has.  Responses from the monitor are
+// discarded in the meantime so neither waits on the other.
+func releaseQueue(queue *types.Queue, channelToMonitor chan types.EunomiaQueueRequest, channelFromMonitor chan types.EunomiaResponse) {
+	done := make(chan bool)
+	release := types.EunomiaQueueRequest{Action: types.EunomiaRequestReleaseMaster, QueueUUID: queue.UUID, Done: done}
+	for sent := false; !sent; {
+		select {
+		case channelToMonitor <- release:
+			sent = true
+		case <-channelFromMonitor:
+		}
+	}
+	<-done
+}
+
+// windowIsOpen determines if the window of operation of the queue is currently open
+func windowIsOpen(queue *types.Queue) bool {
+	return !queue.Window.GetNextStartTime().After(types.GetClock().Now())
+}
+
+// queueTransition publishes the event for a transition of the queue and traces it.  The span of the transition which
+// last opened the queue is kept on the queue so the execution of its tasks may be linked to the decision.
+func queueTransition(queue *types.Queue, eventType string, status string, reason string) {
+	span := types.StartSpan("dike "+eventType, types.SpanInternal, types.SpanContext{})
+	span.SetAttribute("horae.queue.uuid", queue.UUID.String())
+	span.SetAttribute("horae.queue.name", queue.Name)
+	if status != "" {
+		span.SetAttribute("horae.queue.status", status)
+	}
+	if reason != "" {
+		span.SetAttribute("horae.queue.reason", reason)
+	}
+	span.Finish()
+	if eventType == types.EventQueueOpened {
+		queue.Transition = span.Context
+	}
+	event := types.NewQueueEvent(eventType, *queue)
+	event.Status = status
+	event.Detail = reason
+	types.PublishEvent(event)
+}
+
+// reportOpen records whether a queue owned by this node is open
+func reportOpen(queue *types.Queue, open bool) {
+	value := 0.0
+	if open {
+		value = 1
+	}
+	types.MetricQueueOpen.Set(value, queue.UUID.String())
+}
+
+// reportDepth records the number of tasks waiting in and executing on a queue owned by this node
+func reportDepth(queue *types.Queue) {
+	types.MetricQueueTasks.Set(float64(queue.CountOfTasksWithStatus(types.TaskPending)), queue.UUID.String(), "pending")
+	types.MetricQueueTasks.Set(float64(queue.CountOfTasksWithStatus(types.TaskRunning)), queue.UUID.String(), "running")
+}
+
+// forgetQueueMetrics removes the gauges of a queue once this node no longer owns it
+func forgetQueueMetrics(queue *types.Queue) {
+	types.MetricQueueOpen.Delete(queue.UUID.String())
+	types.MetricQueueTasks.Delete(queue.UUID.String(), "pending")
+	types.MetricQueueTasks.Delete(queue.UUID.String(), "running")
+}
+
 func queueTime(queue *types.Queue, action string) (duration time.Duration) {
-	now := time.Now()
+	now := types.GetClock().Now()
 	start := queue.Window.GetNextStartTime()
 	if action == "pre" {
 		if now.Unix() == start.Unix() {
@@ -0,0 +1,80 @@
+package dike
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"testing"
+	"time"
+)
+
+// fakeMonitor stands in for the queue monitor of eunomia.  it passes on the requests of the queue manager but never
+// grants ownership so the queue manager remains a slave
+func fakeMonitor(toEunomia chan types.EunomiaRequest, requests chan string) {
+	request := <-toEunomia
+	for queueRequest := range request.ChannelFromQueueManager {
+		requests <- queueRequest.Action
+	}
+}
+
+// stepTo advances the clock to the target in steps of ten seconds.  before each step it waits for the queue manager
+// to set its window and backpressure timers again after handling the timers which fired
+func stepTo(clock *types.FakeClock, target time.Time) {
+	for clock.Now().Before(target) {
+		clock.BlockUntil(2)
+		clock.Advance(10 * time.Second)
+	}
+	clock.BlockUntil(2)
+}
+
+func expectRequest(t *testing.T, requests chan string, action string, at time.Time) {
+	select {
+	case request := <-requests:
+		if request != action {
+			t.Errorf("expected %s at %v but was %s", action, at, request)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected %s at %v", action, at)
+	}
+}
+
+func expectNoRequest(t *testing.T, requests chan string, at time.Time) {
+	select {
+	case request := <-requests:
+		t.Errorf("unexpected %s at %v", request, at)
+	default:
+	}
+}
+
+func TestQueueManagerClaimsAndReleasesOverWeeks(t *testing.T) {
+	// monday 12/10/2026 for two weeks.  every timer of the queue manager falls on a multiple of ten seconds so
+	// stepping by ten seconds reaches each deadline exactly
+	from := time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)
+	clock := types.NewFakeClock(from)
+	previous := types.GetClock()
+	types.SetClock(clock)
+	t.Cleanup(func() { types.SetClock(previous) })
+
+	toEunomia := make(chan types.EunomiaRequest)
+	requests := make(chan string, 10)
+	go fakeMonitor(toEunomia, requests)
+	queue := &types.Queue{UUID: gocql.TimeUUID(), QueueType: types.QueueAsync, WindowOfOperation: "9am - 5pm every weekday"}
+	go queueManager(types.Node{UUID: gocql.TimeUUID()}, queue, toEunomia)
+
+	for day := from; day.Before(from.AddDate(0, 0, 14)); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+			// the queue is claimed 20 seconds before the window opens and released as it closes
+			claim := day.Add(9*time.Hour - 20*time.Second)
+			stepTo(clock, claim.Add(-10*time.Second))
+			expectNoRequest(t, requests, clock.Now())
+			stepTo(clock, claim)
+			expectRequest(t, requests, types.EunomiaRequestBecomeMaster, claim)
+			release := day.Add(17 * time.Hour)
+			stepTo(clock, release.Add(-10*time.Second))
+			expectNoRequest(t, requests, clock.Now())
+			stepTo(clock, release)
+			expectRequest(t, requests, types.EunomiaRequestReleaseMaster, release)
+		}
+		stepTo(clock, day.AddDate(0, 0, 1))
+		expectNoRequest(t, requests, clock.Now())
+	}
+}
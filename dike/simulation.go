@@ -0,0 +1,263 @@
+package dike
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"sort"
+	"time"
+)
+
+// bound the number of intervals generated for a single queue
+const maxSimulationIntervals = 10000
+
+const rootQueueUUID = "11111111-1111-1111-1111-111111111111"
+
+// Simulate loads the queues and pending tasks from the store and replays the windows of operation and containment
+// rules used by the queue managers over the requested range.  Nothing is executed.  If overrides are given the tasks
+// are also simulated without them so any which would be delayed are marked.
+func Simulate(request types.SimulationRequest) (types.Simulation, error) {
+	tasks := []types.Task{}
+	for _, task := range types.GetTasks() {
+		if task.Status == types.TaskPending {
+			tasks = append(tasks, task)
+		}
+	}
+	return simulate(types.GetQueues(), tasks, request)
+}
+
+func simulate(queues []types.Queue, tasks []types.Task, request types.SimulationRequest) (types.Simulation, error) {
+	from, to := request.From, request.To
+	if from.IsZero() {
+		from = types.GetClock().Now()
+	}
+	if to.IsZero() {
+		to = from.Add(types.DefaultSimulationRange)
+	}
+	if !to.After(from) {
+		return types.Simulation{}, errors.New("The end of the simulation must be after the start")
+	}
+	if to.Sub(from) > types.MaxSimulationRange {
+		return types.Simulation{}, fmt.Errorf("The simulation may not cover more than %d days", int(types.MaxSimulationRange.Hours()/24))
+	}
+	simulation, err := replay(queues, tasks, from, to, request.Overrides)
+	if err != nil {
+		return types.Simulation{}, err
+	}
+	if len(request.Overrides) > 0 {
+		baseline, _ := replay(queues, tasks, from, to, nil)
+		baselineFireAt := map[gocql.UUID]*time.Time{}
+		for _, task := range baseline.Tasks {
+			baselineFireAt[task.UUID] = task.FireAt
+		}
+		for idx := range simulation.Tasks {
+			task := &simulation.Tasks[idx]
+			task.BaselineFireAt = baselineFireAt[task.UUID]
+			task.Delayed = task.BaselineFireAt != nil && (task.FireAt == nil || task.FireAt.After(*task.BaselineFireAt))
+		}
+		simulation.Overrides = request.Overrides
+	}
+	return simulation, nil
+}
+
+// replay generates the timeline of the queues and tasks between from and to
+func replay(queues []types.Queue, tasks []types.Task, from time.Time, to time.Time, overrides []types.WindowOverride) (types.Simulation, error) {
+	// work on copies; the overrides must not leak back to the caller
+	simulated := []*types.Queue{}
+	for _, queue := range queues {
+		q := queue
+		simulated = append(simulated, &q)
+	}
+	if err := applyOverrides(simulated, overrides); err != nil {
+		return types.Simulation{}, err
+	}
+
+	// the intervals in which each queue's own window is open, and every point at which any of them change
+	own := map[*types.Queue][]types.Interval{}
+	// keyed by UnixNano as the same instant may be held in different locations
+	boundaries := map[int64]time.Time{from.UnixNano(): from}
+	for _, q := range simulated {
+		own[q] = windowIntervals(q, from, to)
+		for _, interval := range own[q] {
+			boundaries[interval.Start.UnixNano()] = interval.Start
+			boundaries[interval.End.UnixNano()] = interval.End
+		}
+	}
+	times := []time.Time{}
+	for _, t := range boundaries {
+		if !t.Before(from) && t.Before(to) {
+			times = append(times, t)
+		}
+	}
+	sort.Sort(byTime(times))
+
+	// between two boundaries nothing changes so containment only needs to be evaluated at each boundary
+	simulation := types.Simulation{From: from, To: to, Queues: []types.SimulatedQueue{}, Tasks: []types.SimulatedTask{}, Timeline: []types.SimulationEvent{}}
+	open := map[*types.Queue][]types.Interval{}
+	wasOpen := map[*types.Queue]bool{}
+	tree := newContainment()
+	for _, q := range simulated {
+		tree.add(q, nil)
+	}
+	for _, t := range times {
+		for _, q := range simulated {
+			tree.setWindowOpen(q.UUID, intervalAt(own[q], t) >= 0)
+		}
+		for _, q := range simulated {
+			nowOpen := tree.isOpen(q.UUID)
+			if nowOpen && !wasOpen[q] {
+				open[q] = append(open[q], types.Interval{Start: t, End: to})
+				simulation.Timeline = append(simulation.Timeline, types.SimulationEvent{Time: t, Type: types.SimulationQueueOpen, Queue: q.UUID, Description: fmt.Sprintf("Queue %s opens", describeQueue(q))})
+			} else if !nowOpen && wasOpen[q] {
+				open[q][len(open[q])-1].End = t
+				simulation.Timeline = append(simulation.Timeline, types.SimulationEvent{Time: t, Type: types.SimulationQueueClose, Queue: q.UUID, Description: fmt.Sprintf("Queue %s closes", describeQueue(q))})
+			}
+			wasOpen[q] = nowOpen
+		}
+	}
+
+	byUUID := map[string]*types.Queue{}
+	for _, q := range simulated {
+		intervals := open[q]
+		if intervals == nil {
+			intervals = []types.Interval{}
+		}
+		simulation.Queues = append(simulation.Queues, types.SimulatedQueue{UUID: q.UUID, Name: q.Name, Paths: q.OurPaths, Window: q.WindowOfOperation, Intervals: intervals})
+		byUUID[q.UUID.String()] = q
+	}
+
+	// sync queues execute the highest priority task first
+	ordered := append([]types.Task{}, tasks...)
+	sort.Stable(byPriority(ordered))
+	for _, task := range ordered {
+		queueUUID := rootQueueUUID
+		if task.Queue != nil {
+			queueUUID = task.Queue.String()
+		}
+		q, ok := byUUID[queueUUID]
+		if !ok {
+			continue
+		}
+		result := types.SimulatedTask{UUID: task.UUID, Name: task.Name, Queue: q.UUID}
+		taskUUID := task.UUID
+		if q.QueueType == types.QueueSync {
+			// sync tasks are executed, in priority order, once the queue opens
+			result.Outcome = types.SimulationWaiting
+			if len(open[q]) > 0 {
+				fireAt := open[q][0].Start
+				result.Outcome = types.SimulationFires
+				result.FireAt = &fireAt
+				simulation.Timeline = append(simulation.Timeline, types.SimulationEvent{Time: fireAt, Type: types.SimulationTaskFires, Queue: q.UUID, Task: &taskUUID, Description: fmt.Sprintf("Task %s (priority %d) is available to queue %s", describeTask(task), task.Priority, describeQueue(q))})
+			}
+		} else {
+			if task.When.Before(from) || !task.When.Before(to) {
+				continue
+			}
+			result.When = task.When
+			if intervalAt(open[q], task.When) >= 0 {
+				fireAt := task.When
+				result.Outcome = types.SimulationFires
+				result.FireAt = &fireAt
+				simulation.Timeline = append(simulation.Timeline, types.SimulationEvent{Time: fireAt, Type: types.SimulationTaskFires, Queue: q.UUID, Task: &taskUUID, Description: fmt.Sprintf("Task %s fires on queue %s", describeTask(task), describeQueue(q))})
+			} else {
+				// the queue manager only collects async tasks which are due while the queue is open
+				result.Outcome = types.SimulationMissed
+				simulation.Timeline = append(simulation.Timeline, types.SimulationEvent{Time: task.When, Type: types.SimulationTaskMissed, Queue: q.UUID, Task: &taskUUID, Description: fmt.Sprintf("Task %s is missed, queue %s is closed", describeTask(task), describeQueue(q))})
+			}
+		}
+		simulation.Tasks = append(simulation.Tasks, result)
+	}
+	sort.Stable(byEventTime(simulation.Timeline))
+	return simulation, nil
+}
+
+func applyOverrides(queues []*types.Queue, overrides []types.WindowOverride) error {
+	for _, override := range overrides {
+		if override.Queue == "" && override.Path == "" {
+			return errors.New("Each override must give a queue or a path")
+		}
+		window, err := types.Parse(override.Window)
+		if err != nil {
+			return errors.New("Invalid window definition for override: " + err.Error())
+		}
+		if err := window.ValidateCalendars(); err != nil {
+			return errors.New("Invalid window definition for override: " + err.Error())
+		}
+		matched := false
+		for _, q := range queues {
+			if (override.Queue != "" && q.UUID.String() == override.Queue) || (override.Path != "" && q.MatchesPath(override.Path)) {
+				q.WindowOfOperation = override.Window
+				matched = true
+			}
+		}
+		if !matched {
+			return errors.New("No queue found for override: " + override.Queue + override.Path)
+		}
+	}
+	return nil
+}
+
+// windowIntervals returns the intervals, clipped to the simulation, in which the queue's own window is open
+func windowIntervals(q *types.Queue, from time.Time, to time.Time) []types.Interval {
+	intervals := []types.Interval{}
+	if q.LoadWindow() != nil {
+		// an invalid window never opens
+		return intervals
+	}
+	t := from
+	for i := 0; i < maxSimulationIntervals && t.Before(to); i++ {
+		next := q.Window.Intervals(t, 1)
+		if len(next) == 0 || !next[0].Start.Before(to) {
+			break
+		}
+		interval := next[0]
+		if interval.End.After(to) {
+			interval.End = to
+		}
+		intervals = append(intervals, interval)
+		t = next[0].End
+	}
+	return intervals
+}
+
+// intervalAt returns the index of the interval which includes t, or -1
+func intervalAt(intervals []types.Interval, t time.Time) int {
+	idx := sort.Search(len(intervals), func(i int) bool { return intervals[i].End.After(t) })
+	if idx < len(intervals) && !intervals[idx].Start.After(t) {
+		return idx
+	}
+	return -1
+}
+
+func describeQueue(q *types.Queue) string {
+	if q.Name != "" {
+		return fmt.Sprintf("\"%s\"", q.Name)
+	}
+	return q.UUID.String()
+}
+
+func describeTask(task types.Task) string {
+	if task.Name != "" {
+		return fmt.Sprintf("\"%s\"", task.Name)
+	}
+	return task.UUID.String()
+}
+
+type byTime []time.Time
+
+func (t byTime) Len() int           { return len(t) }
+func (t byTime) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byTime) Less(i, j int) bool { return t[i].Before(t[j]) }
+
+type byPriority []types.Task
+
+func (t byPriority) Len() int           { return len(t) }
+func (t byPriority) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byPriority) Less(i, j int) bool { return t[i].Priority > t[j].Priority }
+
+type byEventTime []types.SimulationEvent
+
+func (e byEventTime) Len() int           { return len(e) }
+func (e byEventTime) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byEventTime) Less(i, j int) bool { return e[i].Time.Before(e[j].Time) }
@@ -0,0 +1,179 @@
+package dike
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"testing"
+	"time"
+)
+
+// simulationTime returns the hour of the day in october 2026, in which the simulations start on monday 12/10/2026
+func simulationTime(day int, hour int) time.Time {
+	return time.Date(2026, time.October, day, hour, 0, 0, 0, time.UTC)
+}
+
+func simulatedQueue(name string, queueType string, window string, paths ...string) types.Queue {
+	return types.Queue{UUID: gocql.TimeUUID(), Name: name, QueueType: queueType, WindowOfOperation: window, OurPaths: paths}
+}
+
+func simulatedTask(name string, queue types.Queue, when time.Time, priority uint64) types.Task {
+	return types.Task{UUID: gocql.TimeUUID(), Name: name, Queue: &queue.UUID, When: when, Priority: priority, Status: types.TaskPending}
+}
+
+func checkSimulatedIntervals(t *testing.T, simulation types.Simulation, queue types.Queue, expected []types.Interval) {
+	for _, simulated := range simulation.Queues {
+		if simulated.UUID != queue.UUID {
+			continue
+		}
+		if len(simulated.Intervals) != len(expected) {
+			t.Errorf("%s: expected the intervals %v but were %v", queue.Name, expected, simulated.Intervals)
+			return
+		}
+		for idx, interval := range simulated.Intervals {
+			if !interval.Start.Equal(expected[idx].Start) || !interval.End.Equal(expected[idx].End) {
+				t.Errorf("%s: expected the intervals %v but were %v", queue.Name, expected, simulated.Intervals)
+				return
+			}
+		}
+		return
+	}
+	t.Errorf("%s: not simulated", queue.Name)
+}
+
+func simulatedTaskFor(simulation types.Simulation, task types.Task) (types.SimulatedTask, bool) {
+	for _, simulated := range simulation.Tasks {
+		if simulated.UUID == task.UUID {
+			return simulated, true
+		}
+	}
+	return types.SimulatedTask{}, false
+}
+
+func TestSimulate(t *testing.T) {
+	batch := simulatedQueue("batch", types.QueueAsync, "9am - 5pm every weekday", "/batch")
+	child := simulatedQueue("child", types.QueueAsync, "always", "/batch/child")
+	reports := simulatedQueue("reports", types.QueueSync, "1am - 2am every day")
+	duringWindow := simulatedTask("during the window", batch, simulationTime(12, 10), 0)
+	afterWindow := simulatedTask("after the window", batch, simulationTime(12, 18), 0)
+	afterSimulation := simulatedTask("after the simulation", batch, simulationTime(15, 10), 0)
+	contained := simulatedTask("contained", child, simulationTime(13, 8), 0)
+	low := simulatedTask("low", reports, time.Time{}, 1)
+	high := simulatedTask("high", reports, time.Time{}, 5)
+
+	request := types.SimulationRequest{From: simulationTime(12, 0), To: simulationTime(14, 0)}
+	simulation, err := simulate([]types.Queue{batch, child, reports}, []types.Task{duringWindow, afterWindow, afterSimulation, contained, low, high}, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weekdays := []types.Interval{{simulationTime(12, 9), simulationTime(12, 17)}, {simulationTime(13, 9), simulationTime(13, 17)}}
+	checkSimulatedIntervals(t, simulation, batch, weekdays)
+	// the child is only open while its parent is
+	checkSimulatedIntervals(t, simulation, child, weekdays)
+	checkSimulatedIntervals(t, simulation, reports, []types.Interval{{simulationTime(12, 1), simulationTime(12, 2)}, {simulationTime(13, 1), simulationTime(13, 2)}})
+
+	tests := []struct {
+		task    types.Task
+		outcome string
+		fireAt  time.Time
+	}{
+		{duringWindow, types.SimulationFires, simulationTime(12, 10)},
+		{afterWindow, types.SimulationMissed, time.Time{}},
+		{contained, types.SimulationMissed, time.Time{}},
+		{low, types.SimulationFires, simulationTime(12, 1)},
+		{high, types.SimulationFires, simulationTime(12, 1)},
+	}
+	for _, test := range tests {
+		simulated, ok := simulatedTaskFor(simulation, test.task)
+		if !ok {
+			t.Errorf("%s: not simulated", test.task.Name)
+			continue
+		}
+		if simulated.Outcome != test.outcome || (simulated.FireAt == nil) != test.fireAt.IsZero() || (simulated.FireAt != nil && !simulated.FireAt.Equal(test.fireAt)) {
+			t.Errorf("%s: expected %s at %v but was %s at %v", test.task.Name, test.outcome, test.fireAt, simulated.Outcome, simulated.FireAt)
+		}
+	}
+	if _, ok := simulatedTaskFor(simulation, afterSimulation); ok {
+		t.Error("expected a task after the end of the simulation to be left out")
+	}
+
+	// the timeline is in time order with sync tasks in priority order
+	expected := []struct {
+		time      time.Time
+		eventType string
+		queue     types.Queue
+	}{
+		{simulationTime(12, 1), types.SimulationQueueOpen, reports},
+		{simulationTime(12, 1), types.SimulationTaskFires, reports},
+		{simulationTime(12, 1), types.SimulationTaskFires, reports},
+		{simulationTime(12, 2), types.SimulationQueueClose, reports},
+		{simulationTime(12, 9), types.SimulationQueueOpen, batch},
+		{simulationTime(12, 9), types.SimulationQueueOpen, child},
+		{simulationTime(12, 10), types.SimulationTaskFires, batch},
+		{simulationTime(12, 17), types.SimulationQueueClose, batch},
+		{simulationTime(12, 17), types.SimulationQueueClose, child},
+		{simulationTime(12, 18), types.SimulationTaskMissed, batch},
+		{simulationTime(13, 1), types.SimulationQueueOpen, reports},
+		{simulationTime(13, 2), types.SimulationQueueClose, reports},
+		{simulationTime(13, 8), types.SimulationTaskMissed, child},
+		{simulationTime(13, 9), types.SimulationQueueOpen, batch},
+		{simulationTime(13, 9), types.SimulationQueueOpen, child},
+		{simulationTime(13, 17), types.SimulationQueueClose, batch},
+		{simulationTime(13, 17), types.SimulationQueueClose, child},
+	}
+	if len(simulation.Timeline) != len(expected) {
+		t.Fatalf("expected %d events but found %d: %v", len(expected), len(simulation.Timeline), simulation.Timeline)
+	}
+	for idx, event := range simulation.Timeline {
+		if !event.Time.Equal(expected[idx].time) || event.Type != expected[idx].eventType || event.Queue != expected[idx].queue.UUID {
+			t.Errorf("event %d: expected %s of %s at %v but was %s", idx, expected[idx].eventType, expected[idx].queue.Name, expected[idx].time, event.Description)
+		}
+	}
+	if simulation.Timeline[1].Task == nil || *simulation.Timeline[1].Task != high.UUID {
+		t.Error("expected the higher priority sync task to fire first")
+	}
+}
+
+func TestSimulateOverrides(t *testing.T) {
+	batch := simulatedQueue("batch", types.QueueAsync, "9am - 5pm every weekday", "/batch")
+	early := simulatedTask("early", batch, simulationTime(12, 10), 0)
+	late := simulatedTask("late", batch, simulationTime(12, 15), 0)
+	request := types.SimulationRequest{
+		From:      simulationTime(12, 0),
+		To:        simulationTime(13, 0),
+		Overrides: []types.WindowOverride{{Path: "/batch", Window: "12pm - 5pm every weekday"}},
+	}
+	simulation, err := simulate([]types.Queue{batch}, []types.Task{early, late}, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSimulatedIntervals(t, simulation, batch, []types.Interval{{simulationTime(12, 12), simulationTime(12, 17)}})
+	if simulated, _ := simulatedTaskFor(simulation, early); simulated.Outcome != types.SimulationMissed || !simulated.Delayed || simulated.BaselineFireAt == nil || !simulated.BaselineFireAt.Equal(simulationTime(12, 10)) {
+		t.Errorf("expected the early task to be delayed by the override but was %+v", simulated)
+	}
+	if simulated, _ := simulatedTaskFor(simulation, late); simulated.Outcome != types.SimulationFires || simulated.Delayed {
+		t.Errorf("expected the late task to be unaffected by the override but was %+v", simulated)
+	}
+	if batch.WindowOfOperation != "9am - 5pm every weekday" {
+		t.Error("expected the override not to change the queue")
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	batch := simulatedQueue("batch", types.QueueAsync, "9am - 5pm every weekday", "/batch")
+	tests := []struct {
+		name    string
+		request types.SimulationRequest
+	}{
+		{"end before the start", types.SimulationRequest{From: simulationTime(13, 0), To: simulationTime(12, 0)}},
+		{"longer than the maximum", types.SimulationRequest{From: simulationTime(12, 0), To: simulationTime(12, 0).Add(types.MaxSimulationRange + time.Hour)}},
+		{"override without a queue", types.SimulationRequest{From: simulationTime(12, 0), To: simulationTime(13, 0), Overrides: []types.WindowOverride{{Window: "always"}}}},
+		{"override with an invalid window", types.SimulationRequest{From: simulationTime(12, 0), To: simulationTime(13, 0), Overrides: []types.WindowOverride{{Path: "/batch", Window: "sometimes"}}}},
+		{"override of an unknown path", types.SimulationRequest{From: simulationTime(12, 0), To: simulationTime(13, 0), Overrides: []types.WindowOverride{{Path: "/other", Window: "always"}}}},
+	}
+	for _, test := range tests {
+		if _, err := simulate([]types.Queue{batch}, []types.Task{}, test.request); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -1,32 +1,73 @@
 package eirene
 
 import (
-	"encoding/json"
+	"github.com/gocql/gocql"
 	"github.com/kieranbroadfoot/horae/types"
 	"net/http"
-	"net/url"
 )
 
 // @Title actions
-// @Description This endpoint will return actions known to Horae, either as an array or based on specific criteria (tag).
+// @Description This endpoint will return a page of the actions known to Horae, optionally filtered.  Actions are returned in the order of the store.  The X-Total-Count header holds the number of matching actions (or, while further pages remain, X-Total-Estimate an estimate of it) and the X-Next-Cursor and Link headers the next page.
 // @Accept  json
-// @Param   tag     query    string     false        "Tag against which you wish to limit actions returned"
+// @Param   limit   query    int        false        "The number of actions per page (100 by default, at most 1000)"
+// @Param   cursor  query    string     false        "The cursor of the next page, from the X-Next-Cursor header of the previous page"
+// @Param   status  query    string     false        "Comma separated statuses against which you wish to limit actions returned"
+// @Param   selector query   string     false        "Tag selector against which you wish to limit actions returned, e.g. env=prod,team in (payments,ledger),!deprecated"
+// @Param   tag     query    string     false        "Tag against which you wish to limit actions returned (shorthand for a selector of the tag)"
+// @Param   prefix  query    string     false        "URI prefix against which you wish to limit actions returned"
 // @Success 200 {array}  types.Action
 // @Failure 400 {object} types.Error
+// @Failure 503 {object} types.Error
 // @Resource /actions
 // @Router /actions [get]
 func getActions(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
-	u, _ := url.Parse(r.URL.String())
-	queryParams := u.Query()
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if val, ok := queryParams["tag"]; ok {
-		if err := json.NewEncoder(w).Encode(types.GetActionsByTag(val[0])); err != nil {
-			panic(err)
+	options, err := listOptions(r)
+	if err != nil {
+		returnError(w, 400, err.Error())
+		return
+	}
+	actions, page, err := types.ListActions(options)
+	returnList(w, r, actions, page, err)
+}
+
+// @Title deleteactions
+// @Description Deletes every action chosen by a selector (or tag), with the other filters of the actions endpoint.  An action which cannot be deleted is reported and the others are still deleted.  If the store fails part way through the actions already deleted remain so; repeat the request to delete the rest.
+// @Accept  json
+// @Param   selector query   string     false        "Tag selector of the actions to delete, e.g. env=prod,team in (payments,ledger),!deprecated.  A selector or tag is required"
+// @Param   tag     query    string     false        "Tag of the actions to delete (shorthand for a selector of the tag)"
+// @Param   status  query    string     false        "Comma separated statuses to which the deletion is limited"
+// @Param   prefix  query    string     false        "URI prefix to which the deletion is limited"
+// @Success 200 {object} types.BulkResult
+// @Failure 400 {object} types.Error
+// @Failure 503 {object} types.Error
+// @Resource /actions
+// @Router /actions [delete]
+func deleteActions(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	options, err := bulkOptions(r)
+	if err != nil {
+		returnError(w, 400, err.Error())
+		return
+	}
+	result := types.BulkResult{Succeeded: []gocql.UUID{}, Failed: map[string]string{}}
+	for {
+		actions, page, err := types.ListActions(options)
+		if err != nil {
+			returnListError(w, err)
+			return
+		}
+		for _, action := range actions {
+			if err := action.Delete(); err != nil {
+				result.Failed[action.UUID.String()] = err.Error()
+				continue
+			}
+			result.Succeeded = append(result.Succeeded, action.UUID)
 		}
-	} else {
-		if err := json.NewEncoder(w).Encode(types.GetActions()); err != nil {
-			panic(err)
+		if page.Next == "" {
+			break
 		}
+		options.Cursor = page.Next
 	}
+	returnBulk(w, result)
 }
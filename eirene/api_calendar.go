@@ -0,0 +1,167 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/kieranbroadfoot/horae/types"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// @Title querycalendar
+// @Description Provides the details of a calendar, including all of its dates and date ranges.
+// @Accept  json
+// @Param   uuid     path    string     false        "UUID of the requested calendar"
+// @Success 200 {object} types.Calendar
+// @Failure 400 {object} types.Error
+// @Resource /calendars
+// @Router /calendar/{uuid} [get]
+func getCalendar(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	calendar, cerr := types.GetCalendar(vars["uuid"])
+	if cerr != nil {
+		returnError(w, 404, "Calendar not found")
+	} else {
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(calendar); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// @Title createcalendar
+// @Description A calendar is a named set of dates, such as public holidays or change freezes, which may be referenced by windows of operation, e.g. "9am - 5pm every weekday except calendar uk-holidays".  The name must be unique and may only contain letters, numbers, "-", "_" and ".".  Each entry is either a single date (DD/MM/YYYY) or an inclusive range of dates.
+// @Accept  json
+// @Param   calendar     query    types.Calendar     true        "A calendar object"
+// @Success 200 {object} types.Calendar
+// @Failure 400 {object} types.Error
+// @Resource /calendars
+// @Router /calendar [put]
+func createCalendar(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	calendar := new(types.Calendar)
+	err := json.NewDecoder(r.Body).Decode(calendar)
+	if err != nil {
+		returnError(w, 400, "Badly formed request")
+	} else {
+		if calendar.UUID.String() != "00000000-0000-0000-0000-000000000000" {
+			// marshalling json will create a dummy UUID if one was not specified.
+			returnError(w, 400, "Calendar not saved: cannot specify UUID on create")
+		} else {
+			cerr := calendar.CreateOrUpdate()
+			if cerr != nil {
+				returnError(w, 400, "Calendar not saved: "+cerr.Error())
+			} else {
+				w.WriteHeader(http.StatusOK)
+				if err := json.NewEncoder(w).Encode(calendar); err != nil {
+					panic(err)
+				}
+			}
+		}
+	}
+}
+
+// @Title updatecalendar
+// @Description A calendar may update its description and entries.  The entries given replace those already known.  Queues whose windows of operation use the calendar are re-evaluated.  A calendar cannot be renamed whilst it is used by a queue.
+// @Accept  json
+// @Param   uuid     path   string     	true        "UUID for updated calendar"
+// @Param	calendar	 query	types.Calendar  true		"A calendar object"
+// @Success 200 {object} types.Success
+// @Failure 400 {object} types.Error
+// @Resource /calendars
+// @Router /calendar/{uuid} [put]
+func updateCalendar(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	vars := mux.Vars(r)
+	calendar, cerr := types.GetCalendar(vars["uuid"])
+	if cerr != nil {
+		returnError(w, 400, "Calendar not updated: "+cerr.Error())
+	} else {
+		data, ioerr := ioutil.ReadAll(r.Body)
+		if ioerr != nil {
+			returnError(w, 400, "Unable to read incoming json")
+		} else {
+			err := json.Unmarshal(data, &calendar)
+			if err != nil {
+				returnError(w, 400, "Badly formed request: "+err.Error())
+			} else {
+				cerr := calendar.CreateOrUpdate()
+				if cerr != nil {
+					returnError(w, 400, "Calendar not updated: "+cerr.Error())
+				} else {
+					returnSuccess(w, "Calendar updated")
+					notifyQueuesUsingCalendar(calendar, toEunomia)
+				}
+			}
+		}
+	}
+}
+
+// @Title importcalendar
+// @Description Adds the events of an iCalendar (.ics) file to the calendar.  Only the dates of each event are used; all day events cover their start date up to (but not including) their end date.  Simple yearly recurring events are expanded.  By default the events are merged with the existing entries.
+// @Accept  text/calendar
+// @Param   uuid     path   string     	true        "UUID of the calendar"
+// @Param   replace  query  bool     	false        "If true the existing entries are replaced by the imported events"
+// @Success 200 {object} types.Calendar
+// @Failure 400 {object} types.Error
+// @Resource /calendars
+// @Router /calendar/{uuid}/import [put]
+func importCalendar(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	vars := mux.Vars(r)
+	u, _ := url.Parse(r.URL.String())
+	queryParams := u.Query()
+	calendar, cerr := types.GetCalendar(vars["uuid"])
+	if cerr != nil {
+		returnError(w, 400, "Calendar not updated: "+cerr.Error())
+	} else {
+		entries, ierr := types.ParseICS(r.Body)
+		if ierr != nil {
+			returnError(w, 400, "Calendar not updated: "+ierr.Error())
+		} else {
+			cerr := calendar.Import(entries, queryParams.Get("replace") == "true")
+			if cerr != nil {
+				returnError(w, 400, "Calendar not updated: "+cerr.Error())
+			} else {
+				w.WriteHeader(http.StatusOK)
+				if err := json.NewEncoder(w).Encode(calendar); err != nil {
+					panic(err)
+				}
+				notifyQueuesUsingCalendar(calendar, toEunomia)
+			}
+		}
+	}
+}
+
+// @Title deletecalendar
+// @Description Removes a calendar.  A calendar which is used by the window of operation of any queue cannot be deleted.
+// @Accept  json
+// @Param   uuid     	path    string     	true    "UUID of the calendar to be deleted"
+// @Success 200 {object} types.Success
+// @Failure 400 {object} types.Error
+// @Resource /calendars
+// @Router /calendar/{uuid} [delete]
+func deleteCalendar(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	calendar, cerr := types.GetCalendar(vars["uuid"])
+	if cerr != nil {
+		returnError(w, 404, "Calendar not found")
+	} else {
+		cerr := calendar.Delete()
+		if cerr != nil {
+			returnError(w, 400, "Calendar not deleted: "+cerr.Error())
+		} else {
+			returnSuccess(w, "Calendar deleted")
+		}
+	}
+}
+
+// notifyQueuesUsingCalendar marks each queue using the calendar as updated so their windows are re-evaluated
+func notifyQueuesUsingCalendar(calendar types.Calendar, toEunomia chan types.EunomiaRequest) {
+	for _, queue := range calendar.ReferencingQueues() {
+		toEunomia <- types.EunomiaRequest{Action: types.EunomiaStoreUpdate, Key: "updates/queues/" + queue.UUID.String(), Value: types.EunomiaActionUpdate, TTL: 20}
+	}
+}
@@ -0,0 +1,22 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+)
+
+// @Title calendars
+// @Description This endpoint will return all calendars known to Horae, including their dates.
+// @Accept  json
+// @Success 200 {array}  types.Calendar
+// @Failure 400 {object} types.Error
+// @Resource /calendars
+// @Router /calendars [get]
+func getCalendars(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(types.GetCalendars()); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,108 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// @Title getCluster
+// @Description Returns the members of the cluster: the address, version, role (master or slave), start time and last heartbeat of each live node and the queues it owns.  Served by any node.
+// @Success 200 {object} types.ClusterStatus
+// @Failure 503 {object} types.Error
+// @Resource /cluster
+// @Router /cluster [get]
+func getCluster(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	status := requestCluster(toEunomia)
+	if status.Error != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode(types.Error{Code: http.StatusServiceUnavailable, Message: status.Error}); err != nil {
+			panic(err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		panic(err)
+	}
+}
+
+// @Title getQueueOwner
+// @Description Returns the node which currently owns the queue, since when, and the most recent changes in the ownership of the queue (newest first).  A queue has no owner while its window is closed.
+// @Param   uuid     path    string     true        "UUID of the queue"
+// @Param   limit     query    int     false        "The number of ownership changes to return (default 20)"
+// @Success 200 {object} types.QueueOwner
+// @Failure 404 {object} types.Error "Queue not found"
+// @Failure 503 {object} types.Error
+// @Resource /queues
+// @Router /queue/{uuid}/owner [get]
+func getQueueOwner(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	queue, err := types.GetQueue(vars["uuid"])
+	if err != nil {
+		returnError(w, 404, "Queue not found")
+		return
+	}
+	limit := types.DefaultOwnershipHistory
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			returnError(w, 400, "Invalid limit")
+			return
+		}
+	}
+	report := requestOwnership(toEunomia)
+	if report.Error != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode(types.Error{Code: http.StatusServiceUnavailable, Message: report.Error}); err != nil {
+			panic(err)
+		}
+		return
+	}
+	owner := types.QueueOwner{Queue: queue.UUID, History: types.GetOwnershipHistory(queue.UUID, limit)}
+	for _, node := range report.Nodes {
+		for _, owned := range node.Queues {
+			if owned == queue.UUID {
+				current := node
+				current.Queues = nil
+				owner.Owner = &current
+			}
+		}
+	}
+	if owner.Owner != nil {
+		// the owner acquired the queue at its most recent acquisition (if it is within the history returned)
+		for _, change := range owner.History {
+			if change.Node == owner.Owner.UUID && change.Event == types.OwnershipAcquired {
+				since := change.When
+				owner.Since = &since
+				break
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(owner); err != nil {
+		panic(err)
+	}
+}
+
+// requestCluster asks eunomia to report the members of the cluster
+func requestCluster(toEunomia chan types.EunomiaRequest) types.ClusterStatus {
+	result := make(chan types.ClusterStatus, 1)
+	timeout := time.After(reportTimeout)
+	select {
+	case toEunomia <- types.EunomiaRequest{Action: types.EunomiaClusterReport, ChannelToCluster: result}:
+	case <-timeout:
+		return types.ClusterStatus{Error: "The coordinator is not started"}
+	}
+	select {
+	case status := <-result:
+		return status
+	case <-timeout:
+		return types.ClusterStatus{Error: "The coordinator did not respond"}
+	}
+}
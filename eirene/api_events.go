@@ -0,0 +1,83 @@
+package eirene
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// how often a comment is sent to an idle event stream so proxies do not close it
+const eventHeartbeat = 15 * time.Second
+
+// @Title getEvents
+// @Description Streams scheduler activity as server-sent events: task status changes, queues opening, pausing and closing, changes in queue ownership and backpressure signals.  Events are published across the cluster so any node may serve the stream.  Each event is sent with its type as the event name and the event as json data.
+// @Accept  json
+// @Param   queue     query    string     false        "Only events for the queue with this UUID"
+// @Param   path     query    string     false        "Only events for queues at or beneath this path"
+// @Param   tag     query    string     false        "Only events for tasks or queues with this tag"
+// @Param   selector query   string     false        "Only events for tasks or queues whose tags are selected, e.g. env=prod,team in (payments,ledger),!deprecated"
+// @Param   task     query    string     false        "Only events for the task with this UUID"
+// @Success 200 {object} types.Event
+// @Failure 400 {object} types.Error
+// @Resource /events
+// @Router /events [get]
+func getEvents(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	u, _ := url.Parse(r.URL.String())
+	queryParams := u.Query()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		returnError(w, 400, "Streaming is not supported")
+		return
+	}
+	filter := types.EventFilter{Queue: queryParams.Get("queue"), PathPrefix: queryParams.Get("path"), Tag: queryParams.Get("tag"), Task: queryParams.Get("task")}
+	selector, err := types.ParseSelector(queryParams.Get("selector"))
+	if err != nil {
+		returnError(w, 400, err.Error())
+		return
+	}
+	filter.Selector = selector
+
+	events := make(chan types.Event, 100)
+	toEunomia <- types.EunomiaRequest{Action: types.EunomiaEventsSubscribe, ChannelToEvents: events}
+	defer func() {
+		toEunomia <- types.EunomiaRequest{Action: types.EunomiaEventsUnsubscribe, ChannelToEvents: events}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var closed <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closed = notifier.CloseNotify()
+	}
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case event := <-events:
+			if filter.Matches(event) {
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
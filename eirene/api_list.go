@@ -0,0 +1,116 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listOptions reads the pagination, filter and sort parameters shared by the list endpoints
+func listOptions(r *http.Request) (types.ListOptions, error) {
+	params := r.URL.Query()
+	options := types.ListOptions{Cursor: params.Get("cursor"), Selector: params.Get("selector"), Tag: params.Get("tag"), Prefix: params.Get("prefix")}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return options, types.ListError("Invalid limit")
+		}
+		options.Limit = limit
+	}
+	for _, value := range params["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				options.Statuses = append(options.Statuses, status)
+			}
+		}
+	}
+	if value := params.Get("queue"); value != "" {
+		queue, err := gocql.ParseUUID(value)
+		if err != nil {
+			return options, types.ListError("Invalid queue")
+		}
+		options.Queue = &queue
+	}
+	for name, at := range map[string]*time.Time{"since": &options.Since, "until": &options.Until} {
+		if value := params.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return options, types.ListError("Invalid " + name + ": expected an RFC 3339 timestamp")
+			}
+			*at = parsed
+		}
+	}
+	options.Sort = params.Get("sort")
+	if strings.HasPrefix(options.Sort, "-") {
+		options.Sort = strings.TrimPrefix(options.Sort, "-")
+		options.Descending = true
+	}
+	return options, nil
+}
+
+// returnList writes a page of a list endpoint.  The total (or an estimate of it) and the cursor of the next page are
+// returned as headers so the body remains an array.
+func returnList(w http.ResponseWriter, r *http.Request, rows interface{}, page types.ListPage, err error) {
+	if err != nil {
+		returnListError(w, err)
+		return
+	}
+	if page.Estimated {
+		w.Header().Set("X-Total-Estimate", strconv.FormatInt(page.Total, 10))
+	} else if page.Total >= 0 {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	}
+	if page.Next != "" {
+		next := *r.URL
+		params := next.Query()
+		params.Set("cursor", page.Next)
+		next.RawQuery = params.Encode()
+		w.Header().Set("X-Next-Cursor", page.Next)
+		w.Header().Set("Link", "<"+next.RequestURI()+">; rel=\"next\"")
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(rows); err != nil {
+		panic(err)
+	}
+}
+
+// returnListError writes the error of a list: a 400 for invalid options, otherwise a 503 as the store failed
+func returnListError(w http.ResponseWriter, err error) {
+	if _, ok := err.(types.ListError); ok {
+		returnError(w, 400, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err := json.NewEncoder(w).Encode(types.Error{Code: http.StatusServiceUnavailable, Message: err.Error()}); err != nil {
+		panic(err)
+	}
+}
+
+// bulkOptions reads the filters of a bulk operation, which apply to every row they select rather than to a page.  A
+// selector (or tag) is required so an operation is never applied to every row by mistake.
+func bulkOptions(r *http.Request) (types.ListOptions, error) {
+	options, err := listOptions(r)
+	if err != nil {
+		return options, err
+	}
+	if strings.TrimSpace(options.Selector) == "" && options.Tag == "" {
+		return options, types.ListError("A selector or tag is required")
+	}
+	if options.Cursor != "" || options.Sort != "" {
+		return options, types.ListError("A bulk operation may not be paged or sorted")
+	}
+	options.Limit = types.MaxPageSize
+	return options, nil
+}
+
+// returnBulk writes the outcome of a bulk operation
+func returnBulk(w http.ResponseWriter, result types.BulkResult) {
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		panic(err)
+	}
+}
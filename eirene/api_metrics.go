@@ -0,0 +1,17 @@
+package eirene
+
+import (
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+)
+
+// @Title getMetrics
+// @Description Returns the metrics of this node in the Prometheus text format: task executions, action latencies, the depth and state of the queues owned by the node, window transitions, etcd and Cassandra latencies and errors and API requests.  Every node serves its own metrics so each node should be scraped.
+// @Success 200 {string} string
+// @Resource /metrics
+// @Router /metrics [get]
+func getMetrics(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	types.WriteMetrics(w)
+}
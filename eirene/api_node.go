@@ -0,0 +1,144 @@
+package eirene
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/kieranbroadfoot/horae/dike"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// how long the readiness probe waits for etcd
+const readinessTimeout = 2 * time.Second
+
+// localNode describes this node.  It is set once the API is listening and updated as the master changes.
+var localNode = struct {
+	sync.RWMutex
+	node    types.Node
+	started time.Time
+}{started: time.Now()}
+
+func setLocalNode(node types.Node) {
+	localNode.Lock()
+	defer localNode.Unlock()
+	localNode.node = node
+}
+
+// @Title getHealth
+// @Description Liveness probe.  Returns 200 while the process is running.  Served by every node whatever its role.
+// @Success 200 {object} types.Health
+// @Resource /node
+// @Router /healthz [get]
+func getHealth(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(types.Health{Status: types.HealthOK}); err != nil {
+		panic(err)
+	}
+}
+
+// @Title getReadiness
+// @Description Readiness probe.  Returns 200 if the store (Cassandra) and coordinator (etcd) are reachable and the election has settled (the node knows whether it is master or slave), otherwise 503.  Served by every node whatever its role.
+// @Success 200 {object} types.Health
+// @Failure 503 {object} types.Health
+// @Resource /node
+// @Router /readyz [get]
+func getReadiness(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest, mw *MasterSlave) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	health := types.Health{Status: types.HealthReady, Checks: map[string]string{}}
+	checks := map[string]error{"store": types.PingStore(), "coordinator": checkCoordinator(toEunomia)}
+	if mw.role() == types.NodeRoleUnavailable {
+		checks["election"] = errors.New("The election has not settled")
+	}
+	if dike.Draining() {
+		checks["drain"] = errors.New("The node is draining")
+	}
+	for name, err := range checks {
+		if err != nil {
+			health.Status = types.HealthNotReady
+			health.Checks[name] = err.Error()
+		} else {
+			health.Checks[name] = types.HealthOK
+		}
+	}
+	if _, ok := checks["election"]; !ok {
+		health.Checks["election"] = mw.role()
+	}
+	if health.Status == types.HealthReady {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		panic(err)
+	}
+}
+
+// checkCoordinator asks eunomia to probe etcd
+func checkCoordinator(toEunomia chan types.EunomiaRequest) error {
+	result := make(chan error, 1)
+	timeout := time.After(readinessTimeout)
+	select {
+	case toEunomia <- types.EunomiaRequest{Action: types.EunomiaHealthCheck, ChannelToHealth: result}:
+	case <-timeout:
+		return errors.New("The coordinator is not started")
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-timeout:
+		return errors.New("The coordinator did not respond")
+	}
+}
+
+// @Title getNode
+// @Description Returns the node serving the request: its role (master, slave or unavailable), the current master, the queues it owns and its uptime.  Served by every node whatever its role.
+// @Success 200 {object} types.NodeStatus
+// @Resource /node
+// @Router /node [get]
+func getNode(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest, mw *MasterSlave) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	localNode.RLock()
+	node, started := localNode.node, localNode.started
+	localNode.RUnlock()
+	status := types.NodeStatus{UUID: node.UUID, Cluster: node.Cluster, Address: node.Address, Port: node.Port, Role: mw.role(), OwnedQueues: dike.OwnedQueues(), Draining: dike.Draining(), InFlight: types.InFlight(), Started: started, UptimeSeconds: int64(time.Since(started) / time.Second)}
+	if status.Role != types.NodeRoleUnavailable {
+		status.Master = mw.currentMasterAsURI()
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		panic(err)
+	}
+}
+
+// @Title drainNode
+// @Description Drains the node serving the request and shuts it down: the node stops claiming queues and executing tasks, waits for the tasks and actions it is running to finish (up to the drain timeout), releases its queues so other nodes take them over at once, leaves the cluster and exits.  Readiness fails while the node drains.  Served by every node whatever its role.  SIGTERM has the same effect.
+// @Param timeout query int false "The number of seconds to wait for running tasks and actions (by default -drain-timeout)"
+// @Success 202 {object} types.Success
+// @Failure 400 {object} types.Error
+// @Resource /node
+// @Router /node/drain [post]
+func drainNode(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest, drainToCore chan time.Duration) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	timeout := time.Duration(types.Configuration.DrainTimeout) * time.Second
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			returnError(w, 400, "Invalid timeout (expected a number of seconds)")
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	select {
+	case drainToCore <- timeout:
+	default:
+		// already draining
+	}
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(types.Success{Message: "Draining"}); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,50 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+	"time"
+)
+
+// how long the ownership and cluster reports wait for etcd
+const reportTimeout = 5 * time.Second
+
+// @Title getOwnership
+// @Description Returns the distribution of queue ownership across the cluster: the queues owned by each live node and the queues which no node owns (e.g. their window is closed).  Served by any node.
+// @Success 200 {object} types.QueueOwnership
+// @Failure 503 {object} types.Error
+// @Resource /ownership
+// @Router /ownership [get]
+func getOwnership(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	report := requestOwnership(toEunomia)
+	if report.Error != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode(types.Error{Code: http.StatusServiceUnavailable, Message: report.Error}); err != nil {
+			panic(err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		panic(err)
+	}
+}
+
+// requestOwnership asks eunomia to report the ownership of queues across the cluster
+func requestOwnership(toEunomia chan types.EunomiaRequest) types.QueueOwnership {
+	result := make(chan types.QueueOwnership, 1)
+	timeout := time.After(reportTimeout)
+	select {
+	case toEunomia <- types.EunomiaRequest{Action: types.EunomiaOwnershipReport, ChannelToOwnership: result}:
+	case <-timeout:
+		return types.QueueOwnership{Error: "The coordinator is not started"}
+	}
+	select {
+	case report := <-result:
+		return report
+	case <-timeout:
+		return types.QueueOwnership{Error: "The coordinator did not respond"}
+	}
+}
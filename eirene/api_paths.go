@@ -0,0 +1,32 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/kieranbroadfoot/horae/dike"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+	"net/url"
+)
+
+// @Title getPaths
+// @Description Returns the hierarchy of paths at and beneath the prefix (defaulting to /).  Each node lists the queues found at that path with their current state (open, paused or closed), their effective containment and, for queues which are not contained, the closed parents blocking them.
+// @Accept  json
+// @Param   prefix     query    string     false        "The path at which the tree starts, e.g. /datacenters/dc2"
+// @Success 200 {object} types.PathNode
+// @Failure 400 {object} types.Error
+// @Resource /paths
+// @Router /paths [get]
+func getPaths(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	u, _ := url.Parse(r.URL.String())
+	queryParams := u.Query()
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	tree, err := dike.PathTree(queryParams.Get("prefix"))
+	if err != nil {
+		returnError(w, 400, err.Error())
+	} else {
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(tree); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -6,23 +6,32 @@ import (
 	"github.com/kieranbroadfoot/horae/types"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
 // @Title queryqueue
-// @Description Provides details of the requested queue including availability windows, type, associated tags and paths.
+// @Description Provides details of the requested queue including availability windows, type, associated tags and paths.  If effective is true the settings the queue inherits from its ancestors are applied (inherited tags are not matched by tag filters or selectors).
 // @Accept  json
 // @Param   uuid     path    string     false        "UUID of the requested queue"
+// @Param   effective     query    bool     false        "Return the effective configuration of the queue, including inherited settings"
 // @Success 200 {object} types.Queue
 // @Failure 404 {object} types.Error "Queue not found"
 // @Resource /queues
 // @Router /queue/{uuid} [get]
 func getQueue(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
 	vars := mux.Vars(r)
+	u, _ := url.Parse(r.URL.String())
+	queryParams := u.Query()
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	queue, qerr := types.GetQueue(vars["uuid"])
 	if qerr != nil {
 		returnError(w, 404, "Queue not found")
 	} else {
+		if queryParams.Get("effective") == "true" {
+			queue = queue.Effective()
+		}
 		w.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(w).Encode(queue); err != nil {
 			panic(err)
@@ -136,3 +145,56 @@ func deleteQueue(w http.ResponseWriter, r *http.Request, toEunomia chan types.Eu
 	}
 	toEunomia <- types.EunomiaRequest{Action: types.EunomiaStoreUpdate, Key: "updates/queues/"+queue.UUID.String(), Value: types.EunomiaActionDelete, TTL: 20}
 }
+
+// @Title queueschedule
+// @Description Provides the next intervals in which the queue will be open.  As well as the queue's own window of operation this takes into account the windows of any queues which contain it via its paths (including the root queue).
+// @Accept  json
+// @Param   uuid     path    string     true        "UUID of the requested queue"
+// @Param   from     query   string     false       "The reference time (RFC3339) from which intervals are generated. Defaults to now"
+// @Param   count    query   int        false       "The number of intervals to generate. Defaults to 5, maximum of 100"
+// @Success 200 {object} types.WindowExplanation
+// @Failure 400 {object} types.Error
+// @Failure 404 {object} types.Error "Queue not found"
+// @Resource /queues
+// @Router /queue/{uuid}/schedule [get]
+func getQueueSchedule(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	vars := mux.Vars(r)
+	u, _ := url.Parse(r.URL.String())
+	queryParams := u.Query()
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	from := types.GetClock().Now()
+	count := types.DefaultScheduleCount
+	if val, ok := queryParams["from"]; ok {
+		parsed, err := time.Parse(time.RFC3339, val[0])
+		if err != nil {
+			returnError(w, 400, "Invalid reference time: "+err.Error())
+			return
+		}
+		from = parsed
+	}
+	if val, ok := queryParams["count"]; ok {
+		parsed, err := strconv.Atoi(val[0])
+		if err != nil || parsed <= 0 {
+			returnError(w, 400, "Invalid count")
+			return
+		}
+		count = parsed
+		if count > types.MaxScheduleCount {
+			count = types.MaxScheduleCount
+		}
+	}
+	queue, qerr := types.GetQueue(vars["uuid"])
+	if qerr != nil {
+		returnError(w, 404, "Queue not found")
+	} else {
+		schedule, serr := queue.Schedule(from, count)
+		if serr != nil {
+			returnError(w, 400, serr.Error())
+		} else {
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(schedule); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
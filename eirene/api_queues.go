@@ -1,33 +1,76 @@
 package eirene
 
 import (
-	"encoding/json"
+	"github.com/gocql/gocql"
 	"github.com/kieranbroadfoot/horae/types"
 	"net/http"
-	"net/url"
 )
 
 // @Title queues
-// @Description The queues endpoint provides information regarding the available queues known to Horae. This will always include the "default" asynchronous queue.
+// @Description The queues endpoint provides a page of the available queues known to Horae, optionally filtered and sorted. This will always include the "default" asynchronous queue.  Deleted queues are only returned if asked for by status.  The X-Total-Count header holds the number of matching queues (or, while further pages remain of an unsorted list, X-Total-Estimate an estimate of it) and the X-Next-Cursor and Link headers the next page.
 // @Accept  json
-// @Param   tag     query    string     false        "Tag against which you wish to limit queues returned"
+// @Param   limit   query    int        false        "The number of queues per page (100 by default, at most 1000)"
+// @Param   cursor  query    string     false        "The cursor of the next page, from the X-Next-Cursor header of the previous page"
+// @Param   status  query    string     false        "Comma separated statuses against which you wish to limit queues returned"
+// @Param   selector query   string     false        "Tag selector against which you wish to limit queues returned, e.g. env=prod,team in (payments,ledger),!deprecated"
+// @Param   tag     query    string     false        "Tag against which you wish to limit queues returned (shorthand for a selector of the tag)"
+// @Param   prefix  query    string     false        "Name prefix against which you wish to limit queues returned"
+// @Param   sort    query    string     false        "name (prefixed with - to sort in descending order).  Only with a selector with a positive requirement"
 // @Success 200 {array}  types.Queue
 // @Failure 400 {object} types.Error
+// @Failure 503 {object} types.Error
 // @Resource /queues
 // @Router /queues [get]
 func getQueues(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
-	// gets any query parameters from the URL itself
-	u, _ := url.Parse(r.URL.String())
-	queryParams := u.Query()
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if val, ok := queryParams["tag"]; ok {
-		if err := json.NewEncoder(w).Encode(types.GetQueuesByTag(val[0])); err != nil {
-			panic(err)
+	options, err := listOptions(r)
+	if err != nil {
+		returnError(w, 400, err.Error())
+		return
+	}
+	queues, page, err := types.ListQueues(options)
+	returnList(w, r, queues, page, err)
+}
+
+// @Title deletequeues
+// @Description Deletes every queue chosen by a selector (or tag), with the other filters of the queues endpoint.  Each queue is deleted as by DELETE /queue/{uuid}, so a queue which should drain does so first.  A queue which cannot be deleted is reported and the others are still deleted.  If the store fails part way through the queues already deleted remain so; repeat the request to delete the rest.
+// @Accept  json
+// @Param   selector query   string     false        "Tag selector of the queues to delete, e.g. env=prod,team in (payments,ledger),!deprecated.  A selector or tag is required"
+// @Param   tag     query    string     false        "Tag of the queues to delete (shorthand for a selector of the tag)"
+// @Param   prefix  query    string     false        "Name prefix to which the deletion is limited"
+// @Success 200 {object} types.BulkResult
+// @Failure 400 {object} types.Error
+// @Failure 503 {object} types.Error
+// @Resource /queues
+// @Router /queues [delete]
+func deleteQueues(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	options, err := bulkOptions(r)
+	if err != nil {
+		returnError(w, 400, err.Error())
+		return
+	}
+	// only queues which are active may be deleted
+	options.Statuses = []string{types.QueueActive}
+	result := types.BulkResult{Succeeded: []gocql.UUID{}, Failed: map[string]string{}}
+	for {
+		queues, page, err := types.ListQueues(options)
+		if err != nil {
+			returnListError(w, err)
+			return
+		}
+		for _, queue := range queues {
+			if err := queue.Delete(); err != nil {
+				result.Failed[queue.UUID.String()] = err.Error()
+				continue
+			}
+			result.Succeeded = append(result.Succeeded, queue.UUID)
+			toEunomia <- types.EunomiaRequest{Action: types.EunomiaStoreUpdate, Key: "updates/queues/" + queue.UUID.String(), Value: types.EunomiaActionDelete, TTL: 20}
 		}
-	} else {
-		if err := json.NewEncoder(w).Encode(types.GetQueues()); err != nil {
-			panic(err)
+		if page.Next == "" {
+			break
 		}
+		options.Cursor = page.Next
 	}
+	returnBulk(w, result)
 }
@@ -0,0 +1,35 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/kieranbroadfoot/horae/dike"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+)
+
+// @Title simulate
+// @Description Replays the windows of operation and containment of all queues over a future time range (defaulting to the next 7 days) without executing anything.  The response shows when each queue would open and close and when each pending task would fire.  Overrides replace the window of a queue (by UUID) or of the queues at a path, e.g. to see which tasks a weekend downtime on /apps would delay.
+// @Accept  json
+// @Param   simulation     query    types.SimulationRequest     true        "The range to simulate and any window overrides"
+// @Success 200 {object} types.Simulation
+// @Failure 400 {object} types.Error
+// @Resource /simulate
+// @Router /simulate [post]
+func simulate(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	request := new(types.SimulationRequest)
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		returnError(w, 400, "Badly formed request")
+	} else {
+		simulation, serr := dike.Simulate(*request)
+		if serr != nil {
+			returnError(w, 400, "Simulation failed: "+serr.Error())
+		} else {
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(simulation); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
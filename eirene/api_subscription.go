@@ -0,0 +1,148 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/kieranbroadfoot/horae/types"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// @Title querysubscription
+// @Description Provides the details of a subscription.
+// @Accept  json
+// @Param   uuid     path    string     false        "UUID of the requested subscription"
+// @Success 200 {object} types.Subscription
+// @Failure 400 {object} types.Error
+// @Resource /subscriptions
+// @Router /subscription/{uuid} [get]
+func getSubscription(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	subscription, serr := types.GetSubscription(vars["uuid"])
+	if serr != nil {
+		returnError(w, 404, "Subscription not found")
+	} else {
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(subscription); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// @Title createsubscription
+// @Description A subscription executes an action for every event (see /events) matching its filter, e.g. every task failure beneath /apps: {"eventTypes":["task.status"],"statuses":["Failure"],"pathPrefix":"/apps","action":"..."}.  Every filter is optional.  Delivery is at-least-once: failed deliveries are retried after 10 seconds, 30 seconds, 1, 5 and 15 minutes and then kept as dead letters.  The event is available to the action via the HORAE_EVENT, HORAE_EVENT_TYPE, HORAE_EVENT_STATUS, HORAE_QUEUE_UUID and HORAE_TASK_UUID template tags.
+// @Accept  json
+// @Param   subscription     query    types.Subscription     true        "A subscription object"
+// @Success 200 {object} types.Subscription
+// @Failure 400 {object} types.Error
+// @Resource /subscriptions
+// @Router /subscription [put]
+func createSubscription(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	subscription := new(types.Subscription)
+	err := json.NewDecoder(r.Body).Decode(subscription)
+	if err != nil {
+		returnError(w, 400, "Badly formed request")
+	} else {
+		if subscription.UUID.String() != "00000000-0000-0000-0000-000000000000" {
+			// marshalling json will create a dummy UUID if one was not specified.
+			returnError(w, 400, "Subscription not saved: cannot specify UUID on create")
+		} else {
+			serr := subscription.CreateOrUpdate()
+			if serr != nil {
+				returnError(w, 400, "Subscription not saved: "+serr.Error())
+			} else {
+				w.WriteHeader(http.StatusOK)
+				if err := json.NewEncoder(w).Encode(subscription); err != nil {
+					panic(err)
+				}
+			}
+		}
+	}
+}
+
+// @Title updatesubscription
+// @Description A subscription may change its filter and action.  Deliveries already recorded are unaffected.
+// @Accept  json
+// @Param   uuid     path   string     	true        "UUID for updated subscription"
+// @Param	subscription	 query	types.Subscription  true		"A subscription object"
+// @Success 200 {object} types.Success
+// @Failure 400 {object} types.Error
+// @Resource /subscriptions
+// @Router /subscription/{uuid} [put]
+func updateSubscription(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	vars := mux.Vars(r)
+	subscription, serr := types.GetSubscription(vars["uuid"])
+	if serr != nil {
+		returnError(w, 400, "Subscription not updated: "+serr.Error())
+	} else {
+		data, ioerr := ioutil.ReadAll(r.Body)
+		if ioerr != nil {
+			returnError(w, 400, "Unable to read incoming json")
+		} else {
+			err := json.Unmarshal(data, &subscription)
+			if err != nil {
+				returnError(w, 400, "Badly formed request: "+err.Error())
+			} else {
+				serr := subscription.CreateOrUpdate()
+				if serr != nil {
+					returnError(w, 400, "Subscription not updated: "+serr.Error())
+				} else {
+					returnSuccess(w, "Subscription updated")
+				}
+			}
+		}
+	}
+}
+
+// @Title deletesubscription
+// @Description Removes a subscription.  Pending deliveries to the subscription are dead-lettered.
+// @Accept  json
+// @Param   uuid     	path    string     	true    "UUID of the subscription to be deleted"
+// @Success 200 {object} types.Success
+// @Failure 400 {object} types.Error
+// @Resource /subscriptions
+// @Router /subscription/{uuid} [delete]
+func deleteSubscription(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	subscription, serr := types.GetSubscription(vars["uuid"])
+	if serr != nil {
+		returnError(w, 404, "Subscription not found")
+	} else {
+		serr := subscription.Delete()
+		if serr != nil {
+			returnError(w, 400, "Subscription not deleted: "+serr.Error())
+		} else {
+			returnSuccess(w, "Subscription deleted")
+		}
+	}
+}
+
+// @Title querysubscriptiondeliveries
+// @Description Returns the deliveries of events to the subscription, optionally only those with the given status.  Use status=DeadLetter to find the events which could not be delivered.
+// @Accept  json
+// @Param   uuid     path    string     true        "UUID of the subscription"
+// @Param   status     query    string     false        "Pending, Delivered or DeadLetter"
+// @Success 200 {array} types.Delivery
+// @Failure 400 {object} types.Error
+// @Resource /subscriptions
+// @Router /subscription/{uuid}/deliveries [get]
+func getSubscriptionDeliveries(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	vars := mux.Vars(r)
+	u, _ := url.Parse(r.URL.String())
+	queryParams := u.Query()
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	subscription, serr := types.GetSubscription(vars["uuid"])
+	if serr != nil {
+		returnError(w, 404, "Subscription not found")
+	} else {
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(subscription.Deliveries(queryParams.Get("status"))); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+)
+
+// @Title subscriptions
+// @Description This endpoint will return all subscriptions known to Horae.
+// @Accept  json
+// @Success 200 {array}  types.Subscription
+// @Failure 400 {object} types.Error
+// @Resource /subscriptions
+// @Router /subscriptions [get]
+func getSubscriptions(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(types.GetSubscriptions()); err != nil {
+		panic(err)
+	}
+}
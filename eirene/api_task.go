@@ -50,6 +50,7 @@ func createTask(w http.ResponseWriter, r *http.Request, toEunomia chan types.Eun
 			// marshalling json will create a dummy UUID if one was not specified.
 			returnError(w, 400, "Task not saved: cannot specify UUID on create")
 		} else {
+			task.Trace(requestSpan(r))
 			terr := task.CreateOrUpdate()
 			if terr != nil {
 				returnError(w, 400, "Task not saved: "+terr.Error())
@@ -88,6 +89,7 @@ func updateTask(w http.ResponseWriter, r *http.Request, toEunomia chan types.Eun
 			if err != nil {
 				returnError(w, 400, "Badly formed request")
 			} else {
+				task.Trace(requestSpan(r))
 				terr := task.CreateOrUpdate()
 				if terr != nil {
 					returnError(w, 400, "Task not updated: "+terr.Error())
@@ -115,6 +117,7 @@ func deleteTask(w http.ResponseWriter, r *http.Request, toEunomia chan types.Eun
 	if terr != nil {
 		returnError(w, 404, "Task not found")
 	} else {
+		task.Trace(requestSpan(r))
 		terr := task.Delete()
 		if terr != nil {
 			returnError(w, 400, "Task not deleted: "+terr.Error())
@@ -140,6 +143,7 @@ func completeTask(w http.ResponseWriter, r *http.Request, toEunomia chan types.E
 	if terr != nil {
 		returnError(w, 404, "Task not found")
 	} else {
+		task.Trace(requestSpan(r))
 		terr := task.SetStatus(types.TaskComplete)
 		if terr != nil {
 			returnError(w, 400, "Task not completed: "+terr.Error())
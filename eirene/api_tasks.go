@@ -1,37 +1,82 @@
 package eirene
 
 import (
-	"encoding/json"
+	"github.com/gocql/gocql"
 	"github.com/kieranbroadfoot/horae/types"
 	"net/http"
-	"net/url"
 )
 
 // @Title tasks
-// @Description This endpoint will return tasks known to Horae, either as an array or based on specific criteria (tag or queue).
+// @Description This endpoint will return a page of the tasks known to Horae, optionally filtered and sorted.  Unsorted pages are returned in the order of the store.  The X-Total-Count header holds the number of matching tasks (or, while further pages remain of an unsorted list, X-Total-Estimate an estimate of it) and the X-Next-Cursor and Link headers the next page.
 // @Accept  json
-// @Param   tag     query    string     false        "Tag against which you wish to limit tasks returned"
+// @Param   limit   query    int        false        "The number of tasks per page (100 by default, at most 1000)"
+// @Param   cursor  query    string     false        "The cursor of the next page, from the X-Next-Cursor header of the previous page"
+// @Param   status  query    string     false        "Comma separated statuses against which you wish to limit tasks returned"
 // @Param   queue   query    string     false        "UUID of queue to scope tasks returned"
+// @Param   since   query    string     false        "Only tasks due at or after this time (RFC 3339)"
+// @Param   until   query    string     false        "Only tasks due before this time (RFC 3339)"
+// @Param   selector query   string     false        "Tag selector against which you wish to limit tasks returned, e.g. env=prod,team in (payments,ledger),!deprecated"
+// @Param   tag     query    string     false        "Tag against which you wish to limit tasks returned (shorthand for a selector of the tag)"
+// @Param   prefix  query    string     false        "Name prefix against which you wish to limit tasks returned"
+// @Param   sort    query    string     false        "when, priority or name (prefixed with - to sort in descending order).  Only with a queue or a selector with a positive requirement"
 // @Success 200 {array}  types.Task
 // @Failure 400 {object} types.Error
+// @Failure 503 {object} types.Error
 // @Resource /tasks
 // @Router /tasks [get]
 func getTasks(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
-	u, _ := url.Parse(r.URL.String())
-	queryParams := u.Query()
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if val, ok := queryParams["tag"]; ok {
-		if err := json.NewEncoder(w).Encode(types.GetTasksByTag(val[0])); err != nil {
-			panic(err)
+	options, err := listOptions(r)
+	if err != nil {
+		returnError(w, 400, err.Error())
+		return
+	}
+	tasks, page, err := types.ListTasks(options)
+	returnList(w, r, tasks, page, err)
+}
+
+// @Title deletetasks
+// @Description Deletes every task chosen by a selector (or tag), with the other filters of the tasks endpoint.  A task which cannot be deleted is reported and the others are still deleted.  If the store fails part way through the tasks already deleted remain so; repeat the request to delete the rest.
+// @Accept  json
+// @Param   selector query   string     false        "Tag selector of the tasks to delete, e.g. env=prod,team in (payments,ledger),!deprecated.  A selector or tag is required"
+// @Param   tag     query    string     false        "Tag of the tasks to delete (shorthand for a selector of the tag)"
+// @Param   status  query    string     false        "Comma separated statuses to which the deletion is limited"
+// @Param   queue   query    string     false        "UUID of the queue to which the deletion is limited"
+// @Param   since   query    string     false        "Only tasks due at or after this time (RFC 3339)"
+// @Param   until   query    string     false        "Only tasks due before this time (RFC 3339)"
+// @Param   prefix  query    string     false        "Name prefix to which the deletion is limited"
+// @Success 200 {object} types.BulkResult
+// @Failure 400 {object} types.Error
+// @Failure 503 {object} types.Error
+// @Resource /tasks
+// @Router /tasks [delete]
+func deleteTasks(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	options, err := bulkOptions(r)
+	if err != nil {
+		returnError(w, 400, err.Error())
+		return
+	}
+	result := types.BulkResult{Succeeded: []gocql.UUID{}, Failed: map[string]string{}}
+	for {
+		tasks, page, err := types.ListTasks(options)
+		if err != nil {
+			returnListError(w, err)
+			return
 		}
-	} else if val, ok := queryParams["queue"]; ok {
-		if err := json.NewEncoder(w).Encode(types.GetTasksByQueue(val[0])); err != nil {
-			panic(err)
+		for _, task := range tasks {
+			task.Trace(requestSpan(r))
+			if err := task.Delete(); err != nil {
+				result.Failed[task.UUID.String()] = err.Error()
+				continue
+			}
+			result.Succeeded = append(result.Succeeded, task.UUID)
+			toEunomia <- types.EunomiaRequest{Action: types.EunomiaStoreUpdate, Key: "updates/tasks/" + task.Queue.String() + "/" + task.UUID.String(), Value: types.EunomiaActionDelete, TTL: 20}
 		}
-	} else {
-		if err := json.NewEncoder(w).Encode(types.GetTasks()); err != nil {
-			panic(err)
+		if page.Next == "" {
+			break
 		}
+		options.Cursor = page.Next
 	}
+	returnBulk(w, result)
 }
@@ -0,0 +1,101 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/gocql/gocql"
+	"github.com/gorilla/mux"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+	"time"
+)
+
+// @Title transferLeader
+// @Description Moves mastership of the cluster to the given node or, if none is given, to the next node in election order.  The designated node remains master while it is a member of the cluster.  Every node acts on the transfer at once.
+// @Param   node     query    string     false        "UUID of the node to become master"
+// @Success 200 {object} types.TransferResult
+// @Failure 400 {object} types.Error
+// @Failure 503 {object} types.Error
+// @Resource /cluster
+// @Router /cluster/leader/transfer [post]
+func transferLeader(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	request := types.EunomiaRequest{Action: types.EunomiaTransferLeader}
+	if !transferTarget(w, r, &request) {
+		return
+	}
+	returnTransfer(w, requestTransfer(toEunomia, request))
+}
+
+// @Title transferQueueOwner
+// @Description Moves ownership of the queue to the given node or, if none is given, to the preferred node other than the current owner.  The current owner stops executing the queue and releases it at once and the new owner claims it as soon as it sees the release.  A node which does not yet claim the queue (e.g. its window is closed) becomes owner if it claims the queue within a minute.  Requires rendezvous assignment.
+// @Param   uuid     path    string     true        "UUID of the queue"
+// @Param   node     query    string     false        "UUID of the node to own the queue"
+// @Success 200 {object} types.TransferResult
+// @Failure 400 {object} types.Error
+// @Failure 404 {object} types.Error "Queue not found"
+// @Failure 503 {object} types.Error
+// @Resource /queues
+// @Router /queue/{uuid}/owner/transfer [post]
+func transferQueueOwner(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	queue, err := types.GetQueue(vars["uuid"])
+	if err != nil {
+		returnError(w, 404, "Queue not found")
+		return
+	}
+	request := types.EunomiaRequest{Action: types.EunomiaTransferQueue, QueueUUID: queue.UUID}
+	if !transferTarget(w, r, &request) {
+		return
+	}
+	returnTransfer(w, requestTransfer(toEunomia, request))
+}
+
+// transferTarget sets the target of the transfer from the node parameter (if given).  It returns false, having
+// returned an error, if the node is not a valid UUID.
+func transferTarget(w http.ResponseWriter, r *http.Request, request *types.EunomiaRequest) bool {
+	if value := r.URL.Query().Get("node"); value != "" {
+		target, err := gocql.ParseUUID(value)
+		if err != nil {
+			returnError(w, 400, "Invalid node")
+			return false
+		}
+		request.Target = target
+	}
+	return true
+}
+
+// requestTransfer asks eunomia to perform the transfer
+func requestTransfer(toEunomia chan types.EunomiaRequest, request types.EunomiaRequest) types.TransferResult {
+	result := make(chan types.TransferResult, 1)
+	request.ChannelToTransfer = result
+	timeout := time.After(reportTimeout)
+	select {
+	case toEunomia <- request:
+	case <-timeout:
+		return types.TransferResult{Error: "The coordinator is not started"}
+	}
+	select {
+	case transfer := <-result:
+		return transfer
+	case <-timeout:
+		return types.TransferResult{Error: "The coordinator did not respond"}
+	}
+}
+
+func returnTransfer(w http.ResponseWriter, transfer types.TransferResult) {
+	if transfer.Invalid {
+		returnError(w, 400, transfer.Error)
+		return
+	} else if transfer.Error != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode(types.Error{Code: http.StatusServiceUnavailable, Message: transfer.Error}); err != nil {
+			panic(err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(transfer); err != nil {
+		panic(err)
+	}
+}
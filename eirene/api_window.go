@@ -0,0 +1,44 @@
+package eirene
+
+import (
+	"encoding/json"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+)
+
+// @Title explainwindow
+// @Description Parses a window of operation without creating a queue.  The response includes the parsed definition, its canonical form and the next intervals (defaulting to 5) in which the window is open, from the given reference time (defaulting to now).
+// @Accept  json
+// @Param   window     query    types.WindowExplainRequest     true        "The window to explain"
+// @Success 200 {object} types.WindowExplanation
+// @Failure 400 {object} types.Error
+// @Resource /windows
+// @Router /windows/explain [post]
+func explainWindow(w http.ResponseWriter, r *http.Request, toEunomia chan types.EunomiaRequest) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	request := new(types.WindowExplainRequest)
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		returnError(w, 400, "Badly formed request")
+	} else {
+		from, count := request.From, request.Count
+		if from.IsZero() {
+			from = types.GetClock().Now()
+		}
+		if count <= 0 {
+			count = types.DefaultScheduleCount
+		}
+		if count > types.MaxScheduleCount {
+			count = types.MaxScheduleCount
+		}
+		explanation, werr := types.ExplainWindow(request.Window, from, count)
+		if werr != nil {
+			returnError(w, 400, "Invalid window definition: "+werr.Error())
+		} else {
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(explanation); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
@@ -8,6 +8,16 @@
 // @SubApi Queues [/queues]
 // @SubApi Tasks [/tasks]
 // @SubApi Actions [/actions]
+// @SubApi Windows [/windows]
+// @SubApi Calendars [/calendars]
+// @SubApi Simulation [/simulate]
+// @SubApi Paths [/paths]
+// @SubApi Events [/events]
+// @SubApi Subscriptions [/subscriptions]
+// @SubApi Metrics [/metrics]
+// @SubApi Node [/node]
+// @SubApi Ownership [/ownership]
+// @SubApi Cluster [/cluster]
 
 package eirene
 
@@ -21,29 +31,62 @@ import (
 	"net"
 	"net/http"
 	"errors"
+	"time"
 )
 
-func startAPIInterface(toCore chan bool, toEunomia chan types.EunomiaRequest, listener net.Listener, mw *MasterSlave) {
+func startAPIInterface(toCore chan bool, toEunomia chan types.EunomiaRequest, drainToCore chan time.Duration, listener net.Listener, mw *MasterSlave) {
 	log.Print("Starting API Interface")
 
 	router := mux.NewRouter()
 	router.HandleFunc("/v1/actions", func(w http.ResponseWriter, r *http.Request) { getActions(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/actions", func(w http.ResponseWriter, r *http.Request) { deleteActions(w, r, toEunomia) }).Methods("DELETE")
 	router.HandleFunc("/v1/action/{uuid}", func(w http.ResponseWriter, r *http.Request) { getAction(w, r, toEunomia) }).Methods("GET")
 	router.HandleFunc("/v1/action", func(w http.ResponseWriter, r *http.Request) { createAction(w, r, toEunomia) }).Methods("PUT")
 	router.HandleFunc("/v1/action/{uuid}", func(w http.ResponseWriter, r *http.Request) { updateAction(w, r, toEunomia) }).Methods("PUT")
 	router.HandleFunc("/v1/action/{uuid}", func(w http.ResponseWriter, r *http.Request) { deleteAction(w, r, toEunomia) }).Methods("DELETE")
 	router.HandleFunc("/v1/tasks", func(w http.ResponseWriter, r *http.Request) { getTasks(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/tasks", func(w http.ResponseWriter, r *http.Request) { deleteTasks(w, r, toEunomia) }).Methods("DELETE")
 	router.HandleFunc("/v1/task/{uuid}", func(w http.ResponseWriter, r *http.Request) { getTask(w, r, toEunomia) }).Methods("GET")
 	router.HandleFunc("/v1/task", func(w http.ResponseWriter, r *http.Request) { createTask(w, r, toEunomia) }).Methods("PUT")
 	router.HandleFunc("/v1/task/{uuid}", func(w http.ResponseWriter, r *http.Request) { updateTask(w, r, toEunomia) }).Methods("PUT")
 	router.HandleFunc("/v1/task/{uuid}", func(w http.ResponseWriter, r *http.Request) { deleteTask(w, r, toEunomia) }).Methods("DELETE")
 	router.HandleFunc("/v1/task/{uuid}/complete", func(w http.ResponseWriter, r *http.Request) { completeTask(w, r, toEunomia) }).Methods("GET")
 	router.HandleFunc("/v1/queues", func(w http.ResponseWriter, r *http.Request) { getQueues(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/queues", func(w http.ResponseWriter, r *http.Request) { deleteQueues(w, r, toEunomia) }).Methods("DELETE")
 	router.HandleFunc("/v1/queue/{uuid}", func(w http.ResponseWriter, r *http.Request) { getQueue(w, r, toEunomia) }).Methods("GET")
 	router.HandleFunc("/v1/queue", func(w http.ResponseWriter, r *http.Request) { createQueue(w, r, toEunomia) }).Methods("PUT")
 	router.HandleFunc("/v1/queue/{uuid}", func(w http.ResponseWriter, r *http.Request) { updateQueue(w, r, toEunomia) }).Methods("PUT")
 	router.HandleFunc("/v1/queue/{uuid}", func(w http.ResponseWriter, r *http.Request) { deleteQueue(w, r, toEunomia) }).Methods("DELETE")
+	router.HandleFunc("/v1/queue/{uuid}/schedule", func(w http.ResponseWriter, r *http.Request) { getQueueSchedule(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/queue/{uuid}/owner", func(w http.ResponseWriter, r *http.Request) { getQueueOwner(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/queue/{uuid}/owner/transfer", func(w http.ResponseWriter, r *http.Request) { transferQueueOwner(w, r, toEunomia) }).Methods("POST")
+	router.HandleFunc("/v1/calendars", func(w http.ResponseWriter, r *http.Request) { getCalendars(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/calendar/{uuid}", func(w http.ResponseWriter, r *http.Request) { getCalendar(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/calendar", func(w http.ResponseWriter, r *http.Request) { createCalendar(w, r, toEunomia) }).Methods("PUT")
+	router.HandleFunc("/v1/calendar/{uuid}", func(w http.ResponseWriter, r *http.Request) { updateCalendar(w, r, toEunomia) }).Methods("PUT")
+	router.HandleFunc("/v1/calendar/{uuid}", func(w http.ResponseWriter, r *http.Request) { deleteCalendar(w, r, toEunomia) }).Methods("DELETE")
+	router.HandleFunc("/v1/calendar/{uuid}/import", func(w http.ResponseWriter, r *http.Request) { importCalendar(w, r, toEunomia) }).Methods("PUT")
+	router.HandleFunc("/v1/subscriptions", func(w http.ResponseWriter, r *http.Request) { getSubscriptions(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/subscription/{uuid}", func(w http.ResponseWriter, r *http.Request) { getSubscription(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/subscription", func(w http.ResponseWriter, r *http.Request) { createSubscription(w, r, toEunomia) }).Methods("PUT")
+	router.HandleFunc("/v1/subscription/{uuid}", func(w http.ResponseWriter, r *http.Request) { updateSubscription(w, r, toEunomia) }).Methods("PUT")
+	router.HandleFunc("/v1/subscription/{uuid}", func(w http.ResponseWriter, r *http.Request) { deleteSubscription(w, r, toEunomia) }).Methods("DELETE")
+	router.HandleFunc("/v1/subscription/{uuid}/deliveries", func(w http.ResponseWriter, r *http.Request) { getSubscriptionDeliveries(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/windows/explain", func(w http.ResponseWriter, r *http.Request) { explainWindow(w, r, toEunomia) }).Methods("POST")
+	router.HandleFunc("/v1/paths", func(w http.ResponseWriter, r *http.Request) { getPaths(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/events", func(w http.ResponseWriter, r *http.Request) { getEvents(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/simulate", func(w http.ResponseWriter, r *http.Request) { simulate(w, r, toEunomia) }).Methods("POST")
+	router.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) { getMetrics(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { getHealth(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) { getReadiness(w, r, toEunomia, mw) }).Methods("GET")
+	router.HandleFunc("/v1/node", func(w http.ResponseWriter, r *http.Request) { getNode(w, r, toEunomia, mw) }).Methods("GET")
+	router.HandleFunc("/v1/node/drain", func(w http.ResponseWriter, r *http.Request) { drainNode(w, r, toEunomia, drainToCore) }).Methods("POST")
+	router.HandleFunc("/v1/ownership", func(w http.ResponseWriter, r *http.Request) { getOwnership(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/cluster", func(w http.ResponseWriter, r *http.Request) { getCluster(w, r, toEunomia) }).Methods("GET")
+	router.HandleFunc("/v1/cluster/leader/transfer", func(w http.ResponseWriter, r *http.Request) { transferLeader(w, r, toEunomia) }).Methods("POST")
 	negroni := negroni.New(NewEireneLogger())
+	negroni.Use(NewAPITracing(router))
+	negroni.Use(NewAPIMetrics(router))
 	negroni.Use(mw)
 	negroni.UseHandler(router)
 
@@ -54,7 +97,7 @@ func startAPIInterface(toCore chan bool, toEunomia chan types.EunomiaRequest, li
 	}
 }
 
-func StartEirene(node types.Node, staticPort bool, signalToCore chan types.Node, failureToCore chan bool, toEunomia chan types.EunomiaRequest, fromEunomia chan types.EireneStrategyAction) {
+func StartEirene(node types.Node, staticPort bool, signalToCore chan types.Node, failureToCore chan bool, drainToCore chan time.Duration, toEunomia chan types.EunomiaRequest, fromEunomia chan types.EireneStrategyAction) {
 	log.Print("Starting Eirene")
 
 	// initialise a listener with a random port
@@ -71,14 +114,18 @@ func StartEirene(node types.Node, staticPort bool, signalToCore chan types.Node,
 	log.WithFields(log.Fields{"addr": listener.Addr().String()}).Info("Setting API Address")
 
 	// init and keep reference to middleware
-	middleware := NewMasterSlave()
-	middleware.setUnavailable()
+	middleware, err := NewMasterSlave(types.Configuration.APIRouting, toEunomia)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Fatal("Setting API Routing")
+		failureToCore <- true
+	}
 
-	go startAPIInterface(failureToCore, toEunomia, listener, middleware)
+	go startAPIInterface(failureToCore, toEunomia, drainToCore, listener, middleware)
 
 	// Now we've init'd the core API service we can announce our existence to the core
 	node.Address = listener.Addr().(*net.TCPAddr).IP.String()
 	node.Port = fmt.Sprintf("%d", listener.Addr().(*net.TCPAddr).Port)
+	setLocalNode(node)
 	signalToCore <- node
 
 	for {
@@ -95,8 +142,8 @@ func StartEirene(node types.Node, staticPort bool, signalToCore chan types.Node,
 					}
 				} else if strategyUpdate.Action == "slave" {
 					currentAddr, currentPort := middleware.currentMaster()
-					if currentAddr != strategyUpdate.Address && currentPort != strategyUpdate.Port {
-						log.WithFields(log.Fields{"state": "slave"}).Info("Changing API Routing Strategy")
+					if middleware.role() != types.NodeRoleSlave || currentAddr != strategyUpdate.Address || currentPort != strategyUpdate.Port {
+						log.WithFields(log.Fields{"state": "slave", "master": strategyUpdate.Address + ":" + strategyUpdate.Port}).Info("Changing API Routing Strategy")
 						middleware.setAvailableAsSlave(strategyUpdate.Address, strategyUpdate.Port)
 					}
 				} else if strategyUpdate.Action == "unavailable" {
@@ -105,7 +152,7 @@ func StartEirene(node types.Node, staticPort bool, signalToCore chan types.Node,
 				}
 				if node.MasterURI != middleware.currentMasterAsURI() {
 					node.MasterURI = middleware.currentMasterAsURI()
-					signalToCore <- node
+					setLocalNode(node)
 				}
 			}
 		}
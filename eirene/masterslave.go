@@ -1,35 +1,220 @@
 package eirene
 
 import (
+	"bytes"
+	"errors"
+	"github.com/kieranbroadfoot/horae/types"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
-// Eirene middleware. Handles behaviour for nodes which are neither ready for action or acting as slaves
+// Eirene middleware. Handles behaviour for nodes which are neither ready for action or acting as slaves.  By default
+// (active routing) every available node serves the API itself: writes go to the store and are announced to the queue
+// managers through etcd, so no node need be master to accept them.  Otherwise a slave either proxies requests to the
+// master or redirects the client to it.
+
+const (
+	// while the master is unknown or unreachable (e.g. during an election) a request is retried for up to
+	// proxyRetryWindow, waiting proxyRetryDelay (doubling each time, up to maxProxyRetryDelay) between attempts.  the
+	// window outlasts the TTL of the key of a failed master (at most 20 seconds) so the election can settle
+	proxyRetryWindow   = 30 * time.Second
+	proxyRetryDelay    = 250 * time.Millisecond
+	maxProxyRetryDelay = 4 * time.Second
+	// the largest request body which is proxied
+	maxProxiedBody = 10 << 20
+
+	// set on requests proxied to the master so they are not proxied again
+	forwardedHeader = "X-Horae-Forwarded"
+	// set on responses from a node which cannot serve a proxied request so the proxying node retries
+	notMasterHeader = "X-Horae-Not-Master"
+)
+
+// headers which apply to a single connection and are not proxied
+var hopByHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+var proxyClient = &http.Client{Timeout: 60 * time.Second}
+
+// paths which every node serves itself, whether or not it is available, so load balancers and orchestrators may
+// probe individual nodes
+var servedByEveryNode = map[string]bool{
+	"/healthz":       true,
+	"/readyz":        true,
+	"/v1/node":       true,
+	"/v1/node/drain": true,
+}
+
+// paths which any available node serves itself, whatever the routing, rather than routing to the master
+var servedByAnyNode = map[string]bool{
+	"/v1/events":    true, // events are published cluster-wide
+	"/metrics":      true, // each node reports its own metrics
+	"/v1/ownership": true, // read from etcd
+	"/v1/cluster":   true, // read from etcd
+}
 
 type MasterSlave struct {
+	mutex      sync.RWMutex
+	routing    string
+	toEunomia  chan types.EunomiaRequest
 	available  bool
 	master     bool
 	masterAddr string
 	masterPort string
 }
 
-func NewMasterSlave() *MasterSlave {
-	return &MasterSlave{false, false, "horae.co", "80"}
+// NewMasterSlave returns the middleware for the given routing (active, proxy or redirect).  The node is unavailable, and the
+// master unknown, until the election settles.  Eunomia is asked to check the election when the master cannot be reached.
+func NewMasterSlave(routing string, toEunomia chan types.EunomiaRequest) (*MasterSlave, error) {
+	if routing != types.APIRoutingActive && routing != types.APIRoutingProxy && routing != types.APIRoutingRedirect {
+		return nil, errors.New("Unknown API routing " + routing + " (expected active, proxy or redirect)")
+	}
+	return &MasterSlave{routing: routing, toEunomia: toEunomia}, nil
 }
 
 func (m *MasterSlave) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	if m.available != true {
-		// return 503
-		rw.WriteHeader(http.StatusServiceUnavailable)
-	} else if m.master != true {
-		// return 301 redirect to current master node
-		http.Redirect(rw, r, m.masterAddr+":"+m.masterPort+r.URL.Path, 301)
+	available, master, masterAddr, masterPort := m.state()
+	if servedByEveryNode[r.URL.Path] {
+		next(rw, r)
+	} else if available != true {
+		if r.Header.Get(forwardedHeader) != "" {
+			// proxied to us while we are not part of the election.  the proxying node retries
+			rw.Header().Set(notMasterHeader, "true")
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			// wait for the election to settle
+			m.proxy(rw, r, next)
+		}
+	} else if master != true && m.routing != types.APIRoutingActive && !servedByAnyNode[r.URL.Path] {
+		if r.Header.Get(forwardedHeader) != "" {
+			// proxied to us by a node which believes we are master.  it retries once the election settles
+			rw.Header().Set(notMasterHeader, "true")
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		} else if m.routing == types.APIRoutingRedirect {
+			if masterAddr == "" {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+			} else {
+				// redirect to the current master node.  a temporary redirect keeps the method and body of the request
+				http.Redirect(rw, r, "http://"+net.JoinHostPort(masterAddr, masterPort)+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+			}
+		} else {
+			m.proxy(rw, r, next)
+		}
 	} else {
 		next(rw, r)
 	}
 }
 
+// proxy forwards the request to the master and copies its response back.  While this node is unavailable or the
+// master is unknown or unreachable the request is retried (see proxyRetryWindow), and an unreachable master prompts
+// an immediate election check.  If this node may serve the request in the meantime (e.g. it becomes master) it does.
+func (m *MasterSlave) proxy(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxProxiedBody+1))
+	if err != nil {
+		returnError(rw, 400, "Unable to read request")
+		return
+	} else if len(body) > maxProxiedBody {
+		rw.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	deadline := time.Now().Add(proxyRetryWindow)
+	delay := proxyRetryDelay
+	for {
+		available, master, masterAddr, masterPort := m.state()
+		if available && (master || m.routing == types.APIRoutingActive || servedByAnyNode[r.URL.Path]) {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			next(rw, r)
+			return
+		}
+		if available && masterAddr != "" {
+			if m.routing == types.APIRoutingRedirect {
+				http.Redirect(rw, r, "http://"+net.JoinHostPort(masterAddr, masterPort)+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+				return
+			}
+			response, err := forwardToMaster(r, body, masterAddr, masterPort)
+			if err == nil && response.Header.Get(notMasterHeader) == "" {
+				copyResponse(rw, response)
+				return
+			} else if err == nil {
+				response.Body.Close()
+			}
+			// the master has failed or stepped down.  rather than wait for the next periodic check, determine the
+			// master again
+			m.checkElection()
+		}
+		if time.Now().Add(delay).After(deadline) {
+			break
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > maxProxyRetryDelay {
+			delay = maxProxyRetryDelay
+		}
+	}
+	rw.WriteHeader(http.StatusServiceUnavailable)
+}
+
+// checkElection asks eunomia to determine the master at once.  It does not wait for the check.
+func (m *MasterSlave) checkElection() {
+	if m.toEunomia != nil {
+		go func() { m.toEunomia <- types.EunomiaRequest{Action: types.EunomiaElectionCheck} }()
+	}
+}
+
+func forwardToMaster(r *http.Request, body []byte, masterAddr string, masterPort string) (*http.Response, error) {
+	request, err := http.NewRequest(r.Method, "http://"+net.JoinHostPort(masterAddr, masterPort)+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	copyHeaders(request.Header, r.Header)
+	if client, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			client = prior + ", " + client
+		}
+		request.Header.Set("X-Forwarded-For", client)
+	}
+	request.Header.Set("X-Forwarded-Host", r.Host)
+	request.Header.Set(forwardedHeader, "true")
+	if span := requestSpan(r); span.Valid() {
+		request.Header.Set(types.TraceparentHeader, span.Traceparent())
+	}
+	return proxyClient.Do(request)
+}
+
+func copyResponse(rw http.ResponseWriter, response *http.Response) {
+	defer response.Body.Close()
+	copyHeaders(rw.Header(), response.Header)
+	rw.WriteHeader(response.StatusCode)
+	io.Copy(rw, response.Body)
+}
+
+func copyHeaders(to http.Header, from http.Header) {
+	for key, values := range from {
+		hopByHop := false
+		for _, header := range hopByHopHeaders {
+			if strings.EqualFold(key, header) {
+				hopByHop = true
+			}
+		}
+		if !hopByHop {
+			for _, value := range values {
+				to.Add(key, value)
+			}
+		}
+	}
+}
+
+func (m *MasterSlave) state() (bool, bool, string, string) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.available, m.master, m.masterAddr, m.masterPort
+}
+
 func (m *MasterSlave) setAvailableAsMaster(addr string, port string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.available = true
 	m.master = true
 	m.masterAddr = addr
@@ -37,6 +222,8 @@ func (m *MasterSlave) setAvailableAsMaster(addr string, port string) {
 }
 
 func (m *MasterSlave) setAvailableAsSlave(addr string, port string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.available = true
 	m.master = false
 	m.masterAddr = addr
@@ -44,18 +231,38 @@ func (m *MasterSlave) setAvailableAsSlave(addr string, port string) {
 }
 
 func (m *MasterSlave) setUnavailable() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.available = false
 	m.master = false
 }
 
 func (m *MasterSlave) isMaster() bool {
-	return m.master
+	_, master, _, _ := m.state()
+	return master
+}
+
+// role returns master, slave or unavailable
+func (m *MasterSlave) role() string {
+	available, master, _, _ := m.state()
+	if !available {
+		return types.NodeRoleUnavailable
+	} else if master {
+		return types.NodeRoleMaster
+	}
+	return types.NodeRoleSlave
 }
 
 func (m *MasterSlave) currentMaster() (string, string) {
-	return m.masterAddr, m.masterPort
+	_, _, masterAddr, masterPort := m.state()
+	return masterAddr, masterPort
 }
 
-func (m *MasterSlave) currentMasterAsURI() (string) {
-	return "http://"+m.masterAddr+":"+m.masterPort+"/"
+// currentMasterAsURI returns the URI of the API of the current master, or an empty string if it is unknown
+func (m *MasterSlave) currentMasterAsURI() string {
+	_, _, masterAddr, masterPort := m.state()
+	if masterAddr == "" {
+		return ""
+	}
+	return "http://" + net.JoinHostPort(masterAddr, masterPort) + "/"
 }
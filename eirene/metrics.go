@@ -0,0 +1,49 @@
+package eirene
+
+import (
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APIMetrics is the Eirene middleware which counts API requests by method, route and response status.  Routes are
+// reported as registered (e.g. /v1/queue/{uuid}) so every queue shares a single series.
+type APIMetrics struct {
+	router *mux.Router
+}
+
+func NewAPIMetrics(router *mux.Router) *APIMetrics {
+	return &APIMetrics{router: router}
+}
+
+func (m *APIMetrics) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	next(rw, r)
+
+	status := rw.(negroni.ResponseWriter).Status()
+	if status == 0 {
+		// nothing was written, which net/http sends as a 200
+		status = http.StatusOK
+	}
+	types.MetricAPIRequests.Inc(r.Method, routeTemplate(m.router, r), strconv.Itoa(status))
+}
+
+// routeTemplate returns the path of the request with the values of its route variables replaced by their names
+func routeTemplate(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(r, &match) {
+		// unknown paths are not reported individually
+		return "unmatched"
+	}
+	elements := strings.Split(r.URL.Path, "/")
+	for name, value := range match.Vars {
+		for idx, element := range elements {
+			if element == value {
+				elements[idx] = "{" + name + "}"
+			}
+		}
+	}
+	return strings.Join(elements, "/")
+}
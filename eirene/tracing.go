@@ -0,0 +1,55 @@
+package eirene
+
+import (
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/kieranbroadfoot/horae/types"
+	"net/http"
+	"strconv"
+)
+
+type spanKey int
+
+const requestSpanKey spanKey = 0
+
+// APITracing is the Eirene middleware which traces each API request as a server span.  A W3C traceparent sent with
+// the request is honoured so the request joins the trace of the caller.  Handlers find the span with requestSpan.
+type APITracing struct {
+	router *mux.Router
+}
+
+func NewAPITracing(router *mux.Router) *APITracing {
+	return &APITracing{router: router}
+}
+
+func (t *APITracing) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	route := routeTemplate(t.router, r)
+	span := types.StartSpan(r.Method+" "+route, types.SpanServer, types.ParseTraceparent(r.Header.Get(types.TraceparentHeader)))
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.route", route)
+	span.SetAttribute("http.target", r.URL.RequestURI())
+	context.Set(r, requestSpanKey, span.Context)
+	// the router only clears the context of the requests it handles
+	defer context.Clear(r)
+
+	next(rw, r)
+
+	status := rw.(negroni.ResponseWriter).Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	span.SetAttribute("http.status_code", strconv.Itoa(status))
+	if status >= 500 {
+		span.SetError(http.StatusText(status))
+	}
+	span.Finish()
+}
+
+// requestSpan returns the span of the API request
+func requestSpan(r *http.Request) types.SpanContext {
+	if span, ok := context.Get(r, requestSpanKey).(types.SpanContext); ok {
+		return span
+	}
+	return types.SpanContext{}
+}
@@ -0,0 +1,67 @@
+package eunomia
+
+import (
+	"encoding/json"
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"sort"
+	"time"
+)
+
+// reportCluster reports the members of the cluster, as registered for the election, and the queues each owns to the
+// requester.  The master is the member designated by a leader transfer or otherwise the member which registered first
+// (see findLeader).
+func reportCluster(request types.EunomiaRequest) {
+	client := getEtcdClient()
+	status := types.ClusterStatus{Name: types.Configuration.ClusterName, Nodes: []types.ClusterNode{}}
+	start := time.Now()
+	resp, err := client.Get(getClusterPath()+"/nodes", false, true)
+	observeEtcd("get", start, err)
+	if err != nil {
+		status.Error = err.Error()
+		request.ChannelToCluster <- status
+		return
+	}
+	owned, _, err := queueOwners(client)
+	if err != nil {
+		status.Error = err.Error()
+		request.ChannelToCluster <- status
+		return
+	}
+
+	var lowestIndex uint64
+	for _, entry := range resp.Node.Nodes {
+		var node types.Node
+		if json.Unmarshal([]byte(entry.Value), &node) != nil {
+			continue
+		}
+		queues := owned[node.UUID]
+		if queues == nil {
+			queues = []gocql.UUID{}
+		}
+		sort.Sort(uuidsByString(queues))
+		status.Nodes = append(status.Nodes, types.ClusterNode{UUID: node.UUID, Address: node.Address, Port: node.Port, Version: node.Version, Role: types.NodeRoleSlave, Started: node.Started, Heartbeat: node.Heartbeat, OwnedQueues: queues})
+		if status.Master == nil || entry.CreatedIndex < lowestIndex {
+			master := node.UUID
+			status.Master = &master
+			lowestIndex = entry.CreatedIndex
+		}
+	}
+	if leader, ok := designatedLeader(client); ok {
+		master := leader.UUID
+		status.Master = &master
+	}
+	for idx := range status.Nodes {
+		if status.Master != nil && status.Nodes[idx].UUID == *status.Master {
+			status.Nodes[idx].Role = types.NodeRoleMaster
+		}
+	}
+	sort.Sort(clusterNodesByUUID(status.Nodes))
+	request.ChannelToCluster <- status
+}
+
+type clusterNodesByUUID []types.ClusterNode
+
+func (n clusterNodesByUUID) Len() int           { return len(n) }
+func (n clusterNodesByUUID) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n clusterNodesByUUID) Less(i, j int) bool { return n[i].UUID.String() < n[j].UUID.String() }
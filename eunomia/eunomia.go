@@ -23,9 +23,13 @@ Every update below should be set with a TTL, either for election purposes or sim
 quickly captured and updated
 
 /nodes/<UUID> - value { addr: , port: } - use indexes to elect/monitor leader
-/queues/<Queue UUID>/<Node UUID> - value { addr:, port: } - use indexes to elect/monitor queue leader for each queue
+/queues/<Queue UUID>/<Node UUID> - value { addr:, port: } - claims of the nodes which may own each queue
+/owners/<Queue UUID> - value Node UUID - the node which owns each queue, chosen from the claimants (see checkQueueOwnership)
+/pins/<Queue UUID> - value Node UUID - the node to which a queue was transferred, preferred as its owner
+/leader - value Node UUID - the node designated master by a leader transfer, if any
 /updates/queues/<Queue UUID> - value Action (Update/Create/Delete) - used to indicate changes to queues from API, update is read from DB
 /updates/tasks/<Queue UUID>/<Task UUID> - value Action (Update/Create/Delete) - used to indicate changes to tasks from API, update is read from DB
+/events/<in order key> - value Event (json) - scheduler activity published by each node, streamed to API clients by every node
 
 */
 
@@ -49,7 +53,7 @@ func getClusterPath() string {
 
 func setupEtcd(node types.Node) {
 	clusterPath = rootPath+node.Cluster
-	for _, value := range [4]string{"/nodes", "/queues", "/updates/queues", "/updates/tasks"} {
+	for _, value := range [7]string{"/nodes", "/queues", "/owners", "/pins", "/updates/queues", "/updates/tasks", "/events"} {
 		client := getEtcdClient()
 		// check for root dir for this cluster
 		_, err := client.Get(getClusterPath()+value, false, false)
@@ -63,14 +67,34 @@ func setupEtcd(node types.Node) {
 
 func StartEunomia(node types.Node, failure chan bool, toEirene chan types.EireneStrategyAction, requestsFromAll chan types.EunomiaRequest) {
 	log.Print("Starting Eunomia")
+	if types.Configuration.QueueAssignment != types.QueueAssignmentRendezvous && types.Configuration.QueueAssignment != types.QueueAssignmentFirst {
+		log.WithFields(log.Fields{"assignment": types.Configuration.QueueAssignment}).Fatal("Unknown queue assignment (expected rendezvous or first)")
+		failure <- true
+	}
 	setupEtcd(node)
-	go electMaster(node, toEirene)
+	// requests for an immediate election check are coalesced while one is pending
+	checkElection := make(chan bool, 1)
+	go electMaster(node, toEirene, checkElection)
 
 	workerCh := make(chan types.EunomiaRequest)
 	for i := 0; i <= 9; i++ {
 		go updateWorker(i, workerCh)
 	}
 
+	// events are published to etcd by a single worker so they are kept in order
+	eventCh := make(chan types.Event, eventBacklog)
+	go publishEvents(eventCh)
+	types.SetEventPublisher(func(event types.Event) {
+		event.Node = node.UUID
+		select {
+		case eventCh <- event:
+		default:
+			log.WithFields(log.Fields{"type": event.Type}).Warn("Event backlog full, dropping event")
+		}
+	})
+	subscriptionCh := make(chan types.EunomiaRequest)
+	go monitorEvents(subscriptionCh)
+
 	for {
 		select {
 		case request := <-requestsFromAll:
@@ -80,6 +104,30 @@ func StartEunomia(node types.Node, failure chan bool, toEirene chan types.Eirene
 			} else if request.Action == types.EunomiaQueueMonitor {
 				// case: receive message from a queue manager to set up a queue monitor
 				go monitorQueue(node, request, requestsFromAll)
+			} else if request.Action == types.EunomiaEventsSubscribe || request.Action == types.EunomiaEventsUnsubscribe {
+				// case: receive message from the API to start or stop streaming events to a client
+				subscriptionCh <- request
+			} else if request.Action == types.EunomiaHealthCheck {
+				// case: receive message from the API to probe etcd
+				go checkCoordinator(request)
+			} else if request.Action == types.EunomiaOwnershipReport {
+				// case: receive message from the API to report the ownership of queues across the cluster
+				go reportOwnership(request)
+			} else if request.Action == types.EunomiaClusterReport {
+				// case: receive message from the API to report the members of the cluster
+				go reportCluster(request)
+			} else if request.Action == types.EunomiaTransferLeader {
+				// case: receive message from the API to move mastership to another node
+				go transferLeader(request)
+			} else if request.Action == types.EunomiaElectionCheck {
+				// case: receive message from the API that the master could not be reached
+				select {
+				case checkElection <- true:
+				default:
+				}
+			} else if request.Action == types.EunomiaTransferQueue {
+				// case: receive message from the API to move a queue to another node
+				go transferQueue(request)
 			} else if request.Action == types.EunomiaStoreUpdate || request.Action == types.EunomiaStoreDelete {
 				// Do nothing more than pass it on to one of our workers
 				// TODO - is this a bottleneck?  or can we ensure other actions in this case are quick to exec?
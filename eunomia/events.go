@@ -0,0 +1,77 @@
+package eunomia
+
+import (
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/kieranbroadfoot/horae/types"
+	"time"
+)
+
+// the number of events which may wait to be published before further events are dropped
+const eventBacklog = 1000
+
+func publishEvents(eventCh chan types.Event) {
+	log.Debug("Starting eunomia event publisher")
+	client := getEtcdClient()
+	for event := range eventCh {
+		value, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		start := time.Now()
+		_, err = client.CreateInOrder(getClusterPath()+"/events", string(value), types.EventTTL)
+		observeEtcd("create_in_order", start, err)
+		if err != nil {
+			log.WithFields(log.Fields{"type": event.Type, "error": err}).Warn("Unable to publish event")
+		}
+	}
+}
+
+func monitorEvents(subscriptionCh chan types.EunomiaRequest) {
+	log.Info("Event monitor started")
+	// this monitor watches for events published by any node and passes them to every subscriber on this node
+
+	client := getEtcdClient()
+	subscribers := map[chan types.Event]bool{}
+
+	// channels for managing long-running etcd watchers
+	etcdWatchEvents := make(chan *etcd.Response)
+	etcdWatchEventsStop := make(chan bool)
+
+	// the index after the last event seen, so a restarted watch does not miss the events published in the meantime
+	var waitIndex uint64
+	go client.Watch(getClusterPath()+"/events", waitIndex, true, etcdWatchEvents, etcdWatchEventsStop)
+
+	for {
+		select {
+		case request := <-subscriptionCh:
+			if request.Action == types.EunomiaEventsSubscribe {
+				subscribers[request.ChannelToEvents] = true
+			} else {
+				delete(subscribers, request.ChannelToEvents)
+			}
+		case update := <-etcdWatchEvents:
+			if update == nil {
+				// the watch has ended and closed its channel, so there is nothing to stop.  restart it on fresh
+				// channels
+				etcdWatchEvents = make(chan *etcd.Response)
+				etcdWatchEventsStop = make(chan bool)
+				go client.Watch(getClusterPath()+"/events", waitIndex, true, etcdWatchEvents, etcdWatchEventsStop)
+			} else if update.Action == "create" || update.Action == "set" {
+				waitIndex = update.Node.ModifiedIndex + 1
+				var event types.Event
+				if err := json.Unmarshal([]byte(update.Node.Value), &event); err != nil {
+					continue
+				}
+				for subscriber := range subscribers {
+					select {
+					case subscriber <- event:
+					default:
+						// the subscriber is not keeping up.  drop rather than hold up every other subscriber
+					}
+				}
+			}
+		}
+	}
+}
@@ -5,10 +5,13 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/kieranbroadfoot/horae/types"
+	"time"
 )
 
 func findMaster(client *etcd.Client, path string, node types.Node) (bool, string, string) {
+	start := time.Now()
 	resp, err := client.Get(path, false, true)
+	observeEtcd("get", start, err)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Warn("Failed to query cluster status")
 		return false, "", ""
@@ -0,0 +1,15 @@
+package eunomia
+
+import (
+	"github.com/kieranbroadfoot/horae/types"
+	"time"
+)
+
+// checkCoordinator reports to the requester whether etcd is reachable
+func checkCoordinator(request types.EunomiaRequest) {
+	client := getEtcdClient()
+	start := time.Now()
+	_, err := client.Get(getClusterPath()+"/nodes", false, false)
+	observeEtcd("get", start, err)
+	request.ChannelToHealth <- err
+}
@@ -2,12 +2,22 @@ package eunomia
 
 import (
 	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/go-etcd/etcd"
 	"github.com/kieranbroadfoot/horae/types"
 	"math/rand"
+	"sync"
 	"time"
 )
 
-func electMaster(node types.Node, toEirene chan types.EireneStrategyAction) {
+// closed when the node leaves the cluster
+var (
+	leaving   = make(chan bool)
+	leaveOnce sync.Once
+)
+
+// electMaster determines the master of the cluster every 30 seconds, whenever the leader is transferred and whenever a
+// check is requested (e.g. by a node unable to reach the master)
+func electMaster(node types.Node, toEirene chan types.EireneStrategyAction, checkElection chan bool) {
 	// Function creates a node
 	log.Print("Starting Master Election")
 
@@ -24,6 +34,11 @@ func electMaster(node types.Node, toEirene chan types.EireneStrategyAction) {
 	updateNodeCh := make(chan bool) // signal shutdown
 	go updateNode(updateNodeCh, getClusterPath()+"/nodes", node, nodeTTL, updateRate)
 
+	// a leader transfer is acted upon at once rather than at the next check
+	etcdWatchLeader := make(chan *etcd.Response)
+	etcdWatchLeaderStop := make(chan bool)
+	go client.Watch(leaderKey(), 0, false, etcdWatchLeader, etcdWatchLeaderStop)
+
 	// now wait a couple of seconds before we start the election check
 	time.Sleep(2 * time.Second)
 
@@ -32,12 +47,43 @@ func electMaster(node types.Node, toEirene chan types.EireneStrategyAction) {
 		// determine which node is currently master.  if its ourselves
 		// then configure ourselves as master.  If not change state
 		// to slave
-		isMaster, newMasterAddr, newMasterPort := findMaster(client, getClusterPath()+"/nodes", node)
+		isMaster, newMasterAddr, newMasterPort := findLeader(client, node)
 		if isMaster {
-			toEirene <- types.EireneStrategyAction{"master", "", ""}
+			toEirene <- types.EireneStrategyAction{Action: "master"}
 		} else {
-			toEirene <- types.EireneStrategyAction{"slave", "http://" + newMasterAddr, newMasterPort}
+			toEirene <- types.EireneStrategyAction{Action: "slave", Address: newMasterAddr, Port: newMasterPort}
+		}
+		select {
+		case <-time.After(30 * time.Second):
+		case <-checkElection:
+		case leaderUpdate := <-etcdWatchLeader:
+			if leaderUpdate == nil {
+				// long poll has expired. restart
+				etcdWatchLeaderStop <- true
+				go client.Watch(leaderKey(), 0, false, etcdWatchLeader, etcdWatchLeaderStop)
+			}
+		case <-leaving:
+			// stop standing for election.  the node key is removed by LeaveCluster
+			updateNodeCh <- false
+			etcdWatchLeaderStop <- true
+			return
 		}
-		time.Sleep(30 * time.Second)
 	}
 }
+
+// LeaveCluster withdraws the node from the election so another node becomes master without waiting for the key of
+// this node to expire
+func LeaveCluster(node types.Node) {
+	leaveOnce.Do(func() {
+		close(leaving)
+		client := getEtcdClient()
+		start := time.Now()
+		_, err := client.Delete(getClusterPath()+"/nodes/"+node.UUID.String(), false)
+		observeEtcd("delete", start, err)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Warn("Unable to leave cluster")
+		} else {
+			log.WithFields(log.Fields{"node": node.UUID}).Info("Left cluster")
+		}
+	})
+}
@@ -0,0 +1,15 @@
+package eunomia
+
+import (
+	"github.com/kieranbroadfoot/horae/types"
+	"time"
+)
+
+// observeEtcd records the time taken by an etcd request and whether it failed.  Watches are long polls and are not
+// observed.
+func observeEtcd(operation string, start time.Time, err error) {
+	types.MetricEtcdDuration.ObserveSince(start, operation)
+	if err != nil {
+		types.MetricEtcdErrors.Inc(operation)
+	}
+}
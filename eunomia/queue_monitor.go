@@ -18,6 +18,10 @@ func monitorQueue(node types.Node, request types.EunomiaRequest, requestsFromAll
 
 	client := getEtcdClient()
 	masterTimer := time.NewTimer(1 * time.Hour)
+	// true while this node owns the queue
+	owned := false
+	// true while this node claims the queue (from a request to become master until the queue is released)
+	claimed := false
 	updateNodeCh := make(chan bool)
 
 	// channels for managing long-running etcd watchers
@@ -25,9 +29,12 @@ func monitorQueue(node types.Node, request types.EunomiaRequest, requestsFromAll
 	etcdWatchQueueStop := make(chan bool)
 	etcdWatchTaskActivity := make(chan *etcd.Response)
 	etcdWatchTaskStop := make(chan bool)
+	etcdWatchOwnerActivity := make(chan *etcd.Response)
+	etcdWatchOwnerStop := make(chan bool)
+	watchers := queueWatchers{queueWatch: etcdWatchQueueActivity, queueStop: etcdWatchQueueStop, taskWatch: etcdWatchTaskActivity, taskStop: etcdWatchTaskStop, ownerWatch: etcdWatchOwnerActivity, ownerStop: etcdWatchOwnerStop}
 
 	// start watching for changes relating to this queue
-	startWatchers(client, request.QueueUUID, etcdWatchQueueActivity, etcdWatchQueueStop, etcdWatchTaskActivity, etcdWatchTaskStop)
+	startWatchers(client, request.QueueUUID, watchers)
 
 	for {
 		select {
@@ -41,16 +48,23 @@ func monitorQueue(node types.Node, request types.EunomiaRequest, requestsFromAll
 				go updateNode(updateNodeCh, getClusterPath()+"/queues/"+queueManagerRequest.QueueUUID.String(), node, nodeTTL, updateRate)
 				// in two seconds check for master state
 				masterTimer = time.NewTimer(2 * time.Second)
+				claimed = true
 			} else if queueManagerRequest.Action == types.EunomiaRequestReleaseMaster {
 				log.WithFields(log.Fields{"queue": request.QueueUUID}).Info("Relinquishing ownership of queue")
 				requestsFromAll <- types.EunomiaRequest{Action: types.EunomiaStoreDelete, Key: getClusterPath() + "/queues/" + queueManagerRequest.QueueUUID.String() + "/" + node.UUID.String()}
+				releaseQueueOwnership(client, queueManagerRequest.QueueUUID, node)
 				updateNodeCh <- false // kill the updater
 				masterTimer.Stop()
+				owned = false
+				claimed = false
+				if queueManagerRequest.Done != nil {
+					close(queueManagerRequest.Done)
+				}
 			}
 		case <-masterTimer.C:
-			masterTimer = time.NewTimer(30 * time.Second)
-			isMaster, _, _ := findMaster(client, getClusterPath()+"/queues/"+request.QueueUUID.String(), node)
-			if isMaster {
+			masterTimer = time.NewTimer(ownershipCheckInterval)
+			owned = checkQueueOwnership(client, request.QueueUUID, node)
+			if owned {
 				request.ChannelToQueueManager <- types.EunomiaResponse{Action: types.EunomiaResponseBecameQueueMaster}
 			} else {
 				request.ChannelToQueueManager <- types.EunomiaResponse{Action: types.EunomiaResponseBecameQueueSlave}
@@ -59,16 +73,38 @@ func monitorQueue(node types.Node, request types.EunomiaRequest, requestsFromAll
 			// seen an update to the queue in etcd.  Signal to queue manager
 			if queueUpdate == nil {
 				// long poll has expired. restart
-				restartWatchers(client, request.QueueUUID, etcdWatchQueueActivity, etcdWatchQueueStop, etcdWatchTaskActivity, etcdWatchTaskStop)
+				restartWatchers(client, request.QueueUUID, watchers)
+			} else if queueUpdate.Node.Value == types.EunomiaActionTransfer {
+				// the queue is being transferred.  if we own it, hand it over now rather than at the next check.  if
+				// we claim it we may be the target: check at once in case the queue is unowned, otherwise we check
+				// again as the owner releases it
+				if owned && !checkQueueOwnership(client, request.QueueUUID, node) {
+					owned = false
+					request.ChannelToQueueManager <- types.EunomiaResponse{Action: types.EunomiaResponseBecameQueueSlave}
+				} else if claimed && !owned {
+					masterTimer.Stop()
+					masterTimer = time.NewTimer(0)
+				}
 			} else {
 				updateQueueManager(request, queueUpdate, types.EunomiaQueue)
 			}
 		case taskUpdate := <-etcdWatchTaskActivity:
 			if taskUpdate == nil {
-				restartWatchers(client, request.QueueUUID, etcdWatchQueueActivity, etcdWatchQueueStop, etcdWatchTaskActivity, etcdWatchTaskStop)
+				restartWatchers(client, request.QueueUUID, watchers)
 			} else {
 				updateQueueManager(request, taskUpdate, types.EunomiaTask)
 			}
+		case ownerUpdate := <-etcdWatchOwnerActivity:
+			if ownerUpdate == nil {
+				restartWatchers(client, request.QueueUUID, watchers)
+			} else if ownerUpdate.Action == "delete" || ownerUpdate.Action == "compareAndDelete" || ownerUpdate.Action == "expire" {
+				// the owner has released the queue (e.g. handing it over) or stopped.  a claimant checks at once rather
+				// than waiting for its next check
+				if claimed && !owned {
+					masterTimer.Stop()
+					masterTimer = time.NewTimer(0)
+				}
+			}
 		}
 	}
 }
@@ -81,18 +117,30 @@ func updateQueueManager(request types.EunomiaRequest, update *etcd.Response, act
 	}
 }
 
-func restartWatchers(client *etcd.Client, queue gocql.UUID, queueWatch chan *etcd.Response, queueStop chan bool, taskWatch chan *etcd.Response, taskStop chan bool) {
-	stopWatchers(queueStop, taskStop)
-	startWatchers(client, queue, queueWatch, queueStop, taskWatch, taskStop)
+// the channels of the watchers of a queue: updates to the queue, to its tasks and to its owner
+type queueWatchers struct {
+	queueWatch chan *etcd.Response
+	queueStop  chan bool
+	taskWatch  chan *etcd.Response
+	taskStop   chan bool
+	ownerWatch chan *etcd.Response
+	ownerStop  chan bool
+}
+
+func restartWatchers(client *etcd.Client, queue gocql.UUID, watchers queueWatchers) {
+	stopWatchers(watchers)
+	startWatchers(client, queue, watchers)
 }
 
-func startWatchers(client *etcd.Client, queue gocql.UUID, queueWatch chan *etcd.Response, queueStop chan bool, taskWatch chan *etcd.Response, taskStop chan bool) {
-	go client.Watch(getClusterPath()+"/updates/queues/"+queue.String(), 0, false, queueWatch, queueStop)
-	go client.Watch(getClusterPath()+"/updates/tasks/"+queue.String()+"/", 0, true, taskWatch, taskStop)
+func startWatchers(client *etcd.Client, queue gocql.UUID, watchers queueWatchers) {
+	go client.Watch(getClusterPath()+"/updates/queues/"+queue.String(), 0, false, watchers.queueWatch, watchers.queueStop)
+	go client.Watch(getClusterPath()+"/updates/tasks/"+queue.String()+"/", 0, true, watchers.taskWatch, watchers.taskStop)
+	go client.Watch(ownerKey(queue), 0, false, watchers.ownerWatch, watchers.ownerStop)
 }
 
-func stopWatchers(queueStop chan bool, taskWatch chan bool) {
+func stopWatchers(watchers queueWatchers) {
 	// shut down long running watchers
-	queueStop <- true
-	taskWatch <- true
+	watchers.queueStop <- true
+	watchers.taskStop <- true
+	watchers.ownerStop <- true
 }
@@ -0,0 +1,282 @@
+package eunomia
+
+import (
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"hash/fnv"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// the owner of a queue is recorded under /owners/<Queue UUID> and refreshed by the owner at every check
+	ownerTTL = 30
+	// ownership of a claimed queue is checked this often
+	ownershipCheckInterval = 10 * time.Second
+	// a node hands at most one queue to its preferred owner per rebalanceInterval, so a joining node takes over its
+	// share of the queues gradually rather than interrupting every queue at once
+	rebalanceInterval = 30 * time.Second
+	// etcd error code for a missing key
+	etcdKeyNotFound = 100
+)
+
+// lastHandover records when this node last handed a queue to another node
+var lastHandover = struct {
+	sync.Mutex
+	at time.Time
+}{}
+
+// mayHandOver determines if the node may hand over a queue now, and if so records the handover
+func mayHandOver() bool {
+	lastHandover.Lock()
+	defer lastHandover.Unlock()
+	now := types.GetClock().Now()
+	if !lastHandover.at.IsZero() && now.Sub(lastHandover.at) < rebalanceInterval {
+		return false
+	}
+	lastHandover.at = now
+	return true
+}
+
+func ownerKey(queue gocql.UUID) string {
+	return getClusterPath() + "/owners/" + queue.String()
+}
+
+// checkQueueOwnership determines if this node owns the queue.  Every node claims a queue (see monitorQueue) as its
+// window approaches.  With rendezvous assignment the queue belongs to the live claimant with the highest weight for
+// the queue; the owner keeps the queue until it leaves or hands it over (see mayHandOver) so queues are only moved
+// between nodes at a controlled rate.  Otherwise the queue belongs to the node which claimed it first.
+func checkQueueOwnership(client *etcd.Client, queue gocql.UUID, node types.Node) bool {
+	if types.Configuration.QueueAssignment == types.QueueAssignmentFirst {
+		isMaster, _, _ := findMaster(client, getClusterPath()+"/queues/"+queue.String(), node)
+		if isMaster {
+			// recorded for the ownership report only
+			start := time.Now()
+			_, err := client.Set(ownerKey(queue), node.UUID.String(), ownerTTL)
+			observeEtcd("set", start, err)
+		}
+		return isMaster
+	}
+
+	claimants, err := queueClaimants(client, queue)
+	if err != nil {
+		log.WithFields(log.Fields{"queue": queue, "error": err}).Warn("Failed to query queue claimants")
+		return false
+	}
+	preferred, found := preferredOwner(queue, claimants)
+	pinned, isPinned := pinnedOwner(client, queue, claimants)
+	if isPinned {
+		// the queue was transferred to this node
+		preferred, found = pinned, true
+	}
+
+	start := time.Now()
+	resp, err := client.Get(ownerKey(queue), false, false)
+	observeEtcd("get", start, err)
+	if isKeyNotFound(err) {
+		// the queue is unowned.  only the preferred owner takes it
+		if !found || preferred.UUID != node.UUID {
+			return false
+		}
+		start := time.Now()
+		_, err := client.Create(ownerKey(queue), node.UUID.String(), ownerTTL)
+		observeEtcd("create", start, err)
+		if err == nil && isPinned {
+			// the transfer is complete
+			clearPin(client, queue, node)
+		}
+		return err == nil
+	} else if err != nil {
+		log.WithFields(log.Fields{"queue": queue, "error": err}).Warn("Failed to query queue owner")
+		return false
+	} else if resp.Node.Value != node.UUID.String() {
+		return false
+	}
+
+	if found && preferred.UUID != node.UUID && (isPinned || mayHandOver()) {
+		// a node with a better claim has joined, or the queue has been transferred.  release the queue so the
+		// preferred owner may take it at its next check
+		log.WithFields(log.Fields{"queue": queue, "owner": preferred.UUID}).Info("Handing queue to preferred owner")
+		releaseQueueOwnership(client, queue, node)
+		return false
+	}
+	if isPinned {
+		// the queue was transferred to its owner
+		clearPin(client, queue, node)
+	}
+	start = time.Now()
+	_, err = client.CompareAndSwap(ownerKey(queue), node.UUID.String(), ownerTTL, node.UUID.String(), 0)
+	observeEtcd("update", start, err)
+	return err == nil
+}
+
+// releaseQueueOwnership removes the record of this node as the owner of the queue
+func releaseQueueOwnership(client *etcd.Client, queue gocql.UUID, node types.Node) {
+	start := time.Now()
+	_, err := client.CompareAndDelete(ownerKey(queue), node.UUID.String(), 0)
+	observeEtcd("delete", start, err)
+}
+
+// queueClaimants returns the nodes which claim the queue and are still members of the cluster
+func queueClaimants(client *etcd.Client, queue gocql.UUID) ([]types.Node, error) {
+	live, err := liveNodes(client)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := nodesUnder(client, getClusterPath()+"/queues/"+queue.String())
+	if err != nil {
+		return nil, err
+	}
+	claimants := []types.Node{}
+	for _, claim := range claims {
+		if _, ok := live[claim.UUID]; ok {
+			claimants = append(claimants, claim)
+		}
+	}
+	return claimants, nil
+}
+
+// liveNodes returns the members of the cluster (as registered for the election) by UUID
+func liveNodes(client *etcd.Client) (map[gocql.UUID]types.Node, error) {
+	nodes, err := nodesUnder(client, getClusterPath()+"/nodes")
+	if err != nil {
+		return nil, err
+	}
+	live := map[gocql.UUID]types.Node{}
+	for _, node := range nodes {
+		live[node.UUID] = node
+	}
+	return live, nil
+}
+
+// nodesUnder returns the nodes registered under a directory such as /nodes or /queues/<Queue UUID>
+func nodesUnder(client *etcd.Client, dir string) ([]types.Node, error) {
+	start := time.Now()
+	resp, err := client.Get(dir, false, true)
+	observeEtcd("get", start, err)
+	if isKeyNotFound(err) {
+		return []types.Node{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	nodes := []types.Node{}
+	for _, entry := range resp.Node.Nodes {
+		var node types.Node
+		if json.Unmarshal([]byte(entry.Value), &node) == nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// preferredOwner returns the node with the highest rendezvous weight for the queue
+func preferredOwner(queue gocql.UUID, nodes []types.Node) (types.Node, bool) {
+	return preferredOwnerBy(queue, nodes, rendezvousWeight)
+}
+
+// preferredOwnerBy returns the node with the highest weight for the queue.  Of nodes with the same weight the node
+// with the lowest UUID is preferred, so every node makes the same choice whatever the order of the nodes.
+func preferredOwnerBy(queue gocql.UUID, nodes []types.Node, weigh func(gocql.UUID, gocql.UUID) uint64) (types.Node, bool) {
+	var preferred types.Node
+	var highest uint64
+	found := false
+	for _, node := range nodes {
+		weight := weigh(queue, node.UUID)
+		if !found || weight > highest || (weight == highest && node.UUID.String() < preferred.UUID.String()) {
+			preferred = node
+			highest = weight
+			found = true
+		}
+	}
+	return preferred, found
+}
+
+// rendezvousWeight is the weight of a node for a queue.  When a node joins or leaves only the queues for which it has
+// (or had) the highest weight change owner.
+func rendezvousWeight(queue gocql.UUID, node gocql.UUID) uint64 {
+	hash := fnv.New64a()
+	hash.Write(queue.Bytes())
+	hash.Write(node.Bytes())
+	return hash.Sum64()
+}
+
+func isKeyNotFound(err error) bool {
+	etcdErr, ok := err.(*etcd.EtcdError)
+	return ok && etcdErr.ErrorCode == etcdKeyNotFound
+}
+
+// reportOwnership reports the queues owned by each live node, and those which are unowned, to the requester
+func reportOwnership(request types.EunomiaRequest) {
+	client := getEtcdClient()
+	report := types.QueueOwnership{Assignment: types.Configuration.QueueAssignment, Nodes: []types.NodeOwnership{}, Unowned: []gocql.UUID{}}
+	live, err := liveNodes(client)
+	if err != nil {
+		report.Error = err.Error()
+		request.ChannelToOwnership <- report
+		return
+	}
+	owned, isOwned, err := queueOwners(client)
+	if err != nil {
+		report.Error = err.Error()
+		request.ChannelToOwnership <- report
+		return
+	}
+	for uuid := range live {
+		if _, ok := owned[uuid]; !ok {
+			owned[uuid] = []gocql.UUID{}
+		}
+	}
+	for uuid, queues := range owned {
+		sort.Sort(uuidsByString(queues))
+		// owners which have left the cluster are reported (without an address) until their ownership expires
+		report.Nodes = append(report.Nodes, types.NodeOwnership{UUID: uuid, Address: live[uuid].Address, Port: live[uuid].Port, Queues: queues, Count: len(queues)})
+	}
+	sort.Sort(nodeOwnershipsByUUID(report.Nodes))
+	for _, queue := range types.GetQueues() {
+		if queue.Status != types.QueueDeleted && !isOwned[queue.UUID] {
+			report.Unowned = append(report.Unowned, queue.UUID)
+		}
+	}
+	sort.Sort(uuidsByString(report.Unowned))
+	request.ChannelToOwnership <- report
+}
+
+// queueOwners returns the queues owned by each node and whether each queue is owned, as recorded under /owners
+func queueOwners(client *etcd.Client) (map[gocql.UUID][]gocql.UUID, map[gocql.UUID]bool, error) {
+	owned := map[gocql.UUID][]gocql.UUID{}
+	isOwned := map[gocql.UUID]bool{}
+	start := time.Now()
+	resp, err := client.Get(getClusterPath()+"/owners", false, true)
+	observeEtcd("get", start, err)
+	if isKeyNotFound(err) {
+		return owned, isOwned, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range resp.Node.Nodes {
+		queue, errQueue := gocql.ParseUUID(path.Base(entry.Key))
+		owner, errOwner := gocql.ParseUUID(entry.Value)
+		if errQueue == nil && errOwner == nil {
+			owned[owner] = append(owned[owner], queue)
+			isOwned[queue] = true
+		}
+	}
+	return owned, isOwned, nil
+}
+
+type uuidsByString []gocql.UUID
+
+func (u uuidsByString) Len() int           { return len(u) }
+func (u uuidsByString) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u uuidsByString) Less(i, j int) bool { return u[i].String() < u[j].String() }
+
+type nodeOwnershipsByUUID []types.NodeOwnership
+
+func (n nodeOwnershipsByUUID) Len() int           { return len(n) }
+func (n nodeOwnershipsByUUID) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n nodeOwnershipsByUUID) Less(i, j int) bool { return n[i].UUID.String() < n[j].UUID.String() }
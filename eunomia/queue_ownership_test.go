@@ -0,0 +1,138 @@
+package eunomia
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"testing"
+	"time"
+)
+
+func newNodes(count int) []types.Node {
+	nodes := []types.Node{}
+	for i := 0; i < count; i++ {
+		nodes = append(nodes, types.Node{UUID: gocql.TimeUUID()})
+	}
+	return nodes
+}
+
+func TestPreferredOwnerIsStable(t *testing.T) {
+	nodes := newNodes(5)
+	reversed := []types.Node{}
+	for idx := len(nodes) - 1; idx >= 0; idx-- {
+		reversed = append(reversed, nodes[idx])
+	}
+	for i := 0; i < 100; i++ {
+		queue := gocql.TimeUUID()
+		preferred, found := preferredOwner(queue, nodes)
+		if !found {
+			t.Fatal("expected a preferred owner")
+		}
+		if again, _ := preferredOwner(queue, nodes); again.UUID != preferred.UUID {
+			t.Errorf("queue %v: preferred %v and then %v", queue, preferred.UUID, again.UUID)
+		}
+		if other, _ := preferredOwner(queue, reversed); other.UUID != preferred.UUID {
+			t.Errorf("queue %v: preferred %v but %v with the nodes in another order", queue, preferred.UUID, other.UUID)
+		}
+	}
+	if _, found := preferredOwner(gocql.TimeUUID(), []types.Node{}); found {
+		t.Error("expected no preferred owner without nodes")
+	}
+}
+
+func TestPreferredOwnerMovesOnlyTheShareOfAJoiningNode(t *testing.T) {
+	nodes := newNodes(4)
+	queues := []gocql.UUID{}
+	before := map[gocql.UUID]gocql.UUID{}
+	for i := 0; i < 2000; i++ {
+		queue := gocql.TimeUUID()
+		queues = append(queues, queue)
+		preferred, _ := preferredOwner(queue, nodes)
+		before[queue] = preferred.UUID
+	}
+	joined := types.Node{UUID: gocql.TimeUUID()}
+	nodes = append(nodes, joined)
+	moved := 0
+	for _, queue := range queues {
+		preferred, _ := preferredOwner(queue, nodes)
+		if preferred.UUID != before[queue] {
+			moved++
+			if preferred.UUID != joined.UUID {
+				t.Errorf("queue %v moved from %v to %v rather than to the joining node", queue, before[queue], preferred.UUID)
+			}
+		}
+	}
+	// a fifth of the queues (400) belong to the joining node
+	if moved < 300 || moved > 500 {
+		t.Errorf("expected about 400 of 2000 queues to move to the joining node but %d did", moved)
+	}
+
+	// when the node leaves again its queues return to their previous owners
+	for _, queue := range queues {
+		if preferred, _ := preferredOwner(queue, nodes[:4]); preferred.UUID != before[queue] {
+			t.Errorf("queue %v did not return to %v", queue, before[queue])
+		}
+	}
+}
+
+func TestPreferredOwnerTieBreak(t *testing.T) {
+	nodes := newNodes(5)
+	lowest := nodes[0]
+	for _, node := range nodes {
+		if node.UUID.String() < lowest.UUID.String() {
+			lowest = node
+		}
+	}
+	same := func(gocql.UUID, gocql.UUID) uint64 { return 42 }
+	for _, order := range [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}, {2, 4, 0, 3, 1}} {
+		ordered := []types.Node{}
+		for _, idx := range order {
+			ordered = append(ordered, nodes[idx])
+		}
+		if preferred, _ := preferredOwnerBy(gocql.TimeUUID(), ordered, same); preferred.UUID != lowest.UUID {
+			t.Errorf("order %v: expected the lowest UUID %v to be preferred but was %v", order, lowest.UUID, preferred.UUID)
+		}
+	}
+	// a higher weight wins over a lower UUID
+	heaviest := nodes[3]
+	weigh := func(queue gocql.UUID, node gocql.UUID) uint64 {
+		if node == heaviest.UUID {
+			return 43
+		}
+		return 42
+	}
+	if preferred, _ := preferredOwnerBy(gocql.TimeUUID(), nodes, weigh); preferred.UUID != heaviest.UUID {
+		t.Errorf("expected the heaviest node %v to be preferred but was %v", heaviest.UUID, preferred.UUID)
+	}
+}
+
+func TestMayHandOverOncePerRebalanceInterval(t *testing.T) {
+	clock := types.NewFakeClock(time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC))
+	previous := types.GetClock()
+	types.SetClock(clock)
+	t.Cleanup(func() { types.SetClock(previous) })
+	lastHandover.Lock()
+	lastHandover.at = time.Time{}
+	lastHandover.Unlock()
+
+	if !mayHandOver() {
+		t.Fatal("expected the first handover to be allowed")
+	}
+	if mayHandOver() {
+		t.Error("expected a second handover at once to be refused")
+	}
+	clock.Advance(rebalanceInterval - time.Second)
+	if mayHandOver() {
+		t.Error("expected a handover within the rebalance interval to be refused")
+	}
+	clock.Advance(time.Second)
+	if !mayHandOver() {
+		t.Error("expected a handover once the rebalance interval has passed")
+	}
+	// a refused handover does not delay the next
+	clock.Advance(rebalanceInterval / 2)
+	mayHandOver()
+	clock.Advance(rebalanceInterval / 2)
+	if !mayHandOver() {
+		t.Error("expected a refused handover not to delay the next")
+	}
+}
@@ -0,0 +1,236 @@
+package eunomia
+
+import (
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gocql/gocql"
+	"github.com/kieranbroadfoot/horae/types"
+	"sort"
+	"time"
+)
+
+// the node designated master by a leader transfer.  It remains master while it is a member of the cluster
+func leaderKey() string {
+	return getClusterPath() + "/leader"
+}
+
+// the node to which a queue was transferred.  It is preferred as owner until it has taken the queue (see clearPin)
+func pinKey(queue gocql.UUID) string {
+	return getClusterPath() + "/pins/" + queue.String()
+}
+
+// a pin which is not taken up (e.g. the target stops claiming the queue) expires after this many seconds
+const pinTTL = 2 * ownerTTL
+
+// findLeader determines if this node is master of the cluster: the node designated by a leader transfer if it is still
+// a member, otherwise the member which registered first (see findMaster).  If not, the address and port of the master
+// are returned.
+func findLeader(client *etcd.Client, node types.Node) (bool, string, string) {
+	if leader, ok := designatedLeader(client); ok {
+		if leader.UUID == node.UUID {
+			return true, "", ""
+		}
+		return false, leader.Address, leader.Port
+	}
+	return findMaster(client, getClusterPath()+"/nodes", node)
+}
+
+// designatedLeader returns the node designated master by a leader transfer, if it is still a member of the cluster
+func designatedLeader(client *etcd.Client) (types.Node, bool) {
+	start := time.Now()
+	resp, err := client.Get(leaderKey(), false, false)
+	observeEtcd("get", start, err)
+	if err != nil {
+		return types.Node{}, false
+	}
+	designated, err := gocql.ParseUUID(resp.Node.Value)
+	if err != nil {
+		return types.Node{}, false
+	}
+	live, err := liveNodes(client)
+	if err != nil {
+		return types.Node{}, false
+	}
+	leader, ok := live[designated]
+	if !ok {
+		// the designated node has left the cluster.  the designation ends with it
+		start := time.Now()
+		_, err := client.CompareAndDelete(leaderKey(), resp.Node.Value, 0)
+		observeEtcd("delete", start, err)
+	}
+	return leader, ok
+}
+
+// pinnedOwner returns the node to which the queue was transferred, if it is one of the claimants
+func pinnedOwner(client *etcd.Client, queue gocql.UUID, claimants []types.Node) (types.Node, bool) {
+	start := time.Now()
+	resp, err := client.Get(pinKey(queue), false, false)
+	observeEtcd("get", start, err)
+	if err != nil {
+		return types.Node{}, false
+	}
+	for _, claimant := range claimants {
+		if claimant.UUID.String() == resp.Node.Value {
+			return claimant, true
+		}
+	}
+	return types.Node{}, false
+}
+
+// clearPin removes the pin of the queue to this node once the node owns the queue, so that the transfer does not
+// override rendezvous assignment (or the rate of handovers) from then on
+func clearPin(client *etcd.Client, queue gocql.UUID, node types.Node) {
+	start := time.Now()
+	_, err := client.CompareAndDelete(pinKey(queue), node.UUID.String(), 0)
+	observeEtcd("delete", start, err)
+}
+
+// electionOrder returns the members of the cluster in the order in which they registered.  The first is master
+// unless another node has been designated (see findLeader).
+func electionOrder(client *etcd.Client) ([]types.Node, error) {
+	start := time.Now()
+	resp, err := client.Get(getClusterPath()+"/nodes", false, true)
+	observeEtcd("get", start, err)
+	if err != nil {
+		return nil, err
+	}
+	members := membersByIndex{}
+	for _, entry := range resp.Node.Nodes {
+		var node types.Node
+		if json.Unmarshal([]byte(entry.Value), &node) == nil {
+			members = append(members, member{node: node, index: entry.CreatedIndex})
+		}
+	}
+	sort.Sort(members)
+	nodes := []types.Node{}
+	for _, m := range members {
+		nodes = append(nodes, m.node)
+	}
+	return nodes, nil
+}
+
+// transferLeader designates the target node (or, if none is given, the next node in election order) as master.  Every
+// node watches the designation so mastership moves at once.
+func transferLeader(request types.EunomiaRequest) {
+	client := getEtcdClient()
+	members, err := electionOrder(client)
+	if err != nil {
+		request.ChannelToTransfer <- types.TransferResult{Error: err.Error()}
+		return
+	} else if len(members) == 0 {
+		request.ChannelToTransfer <- types.TransferResult{Error: "The cluster has no members"}
+		return
+	}
+	current := members[0]
+	if leader, ok := designatedLeader(client); ok {
+		current = leader
+	}
+	target, found := types.Node{}, false
+	for _, member := range members {
+		if (request.Target == gocql.UUID{} && member.UUID != current.UUID) || member.UUID == request.Target {
+			target, found = member, true
+			break
+		}
+	}
+	if !found {
+		if (request.Target == gocql.UUID{}) {
+			request.ChannelToTransfer <- types.TransferResult{Error: "No other node may become master", Invalid: true}
+		} else {
+			request.ChannelToTransfer <- types.TransferResult{Error: "Unknown node", Invalid: true}
+		}
+		return
+	}
+	start := time.Now()
+	_, err = client.Set(leaderKey(), target.UUID.String(), 0)
+	observeEtcd("set", start, err)
+	if err != nil {
+		request.ChannelToTransfer <- types.TransferResult{Error: err.Error()}
+		return
+	}
+	log.WithFields(log.Fields{"from": current.UUID, "to": target.UUID}).Info("Transferred mastership")
+	request.ChannelToTransfer <- types.TransferResult{Node: target.UUID, Address: target.Address, Port: target.Port}
+}
+
+// transferQueue moves the queue to the target node (or, if none is given, the preferred claimant other than the current
+// owner).  The target is pinned as the preferred owner of the queue and the current owner told to hand it over at
+// once; it stops executing the queue and releases it, and the target takes it as soon as it sees the release.
+func transferQueue(request types.EunomiaRequest) {
+	if types.Configuration.QueueAssignment != types.QueueAssignmentRendezvous {
+		request.ChannelToTransfer <- types.TransferResult{Error: "Queues may only be transferred with rendezvous assignment", Invalid: true}
+		return
+	}
+	client := getEtcdClient()
+	queue := request.QueueUUID
+	owner := ""
+	start := time.Now()
+	resp, err := client.Get(ownerKey(queue), false, false)
+	observeEtcd("get", start, err)
+	if err == nil {
+		owner = resp.Node.Value
+	} else if !isKeyNotFound(err) {
+		request.ChannelToTransfer <- types.TransferResult{Error: err.Error()}
+		return
+	}
+
+	var target types.Node
+	if (request.Target == gocql.UUID{}) {
+		claimants, err := queueClaimants(client, queue)
+		if err != nil {
+			request.ChannelToTransfer <- types.TransferResult{Error: err.Error()}
+			return
+		}
+		others := []types.Node{}
+		for _, claimant := range claimants {
+			if claimant.UUID.String() != owner {
+				others = append(others, claimant)
+			}
+		}
+		preferred, found := preferredOwner(queue, others)
+		if !found {
+			request.ChannelToTransfer <- types.TransferResult{Error: "No other node claims the queue", Invalid: true}
+			return
+		}
+		target = preferred
+	} else {
+		live, err := liveNodes(client)
+		if err != nil {
+			request.ChannelToTransfer <- types.TransferResult{Error: err.Error()}
+			return
+		}
+		node, ok := live[request.Target]
+		if !ok {
+			request.ChannelToTransfer <- types.TransferResult{Error: "Unknown node", Invalid: true}
+			return
+		}
+		target = node
+	}
+
+	start = time.Now()
+	_, err = client.Set(pinKey(queue), target.UUID.String(), pinTTL)
+	observeEtcd("set", start, err)
+	if err != nil {
+		request.ChannelToTransfer <- types.TransferResult{Error: err.Error()}
+		return
+	}
+	start = time.Now()
+	_, err = client.Set(getClusterPath()+"/updates/queues/"+queue.String(), types.EunomiaActionTransfer, 20)
+	observeEtcd("set", start, err)
+	if err != nil {
+		request.ChannelToTransfer <- types.TransferResult{Error: err.Error()}
+		return
+	}
+	log.WithFields(log.Fields{"queue": queue, "from": owner, "to": target.UUID}).Info("Transferring queue")
+	request.ChannelToTransfer <- types.TransferResult{Node: target.UUID, Address: target.Address, Port: target.Port}
+}
+
+type member struct {
+	node  types.Node
+	index uint64
+}
+
+type membersByIndex []member
+
+func (m membersByIndex) Len() int           { return len(m) }
+func (m membersByIndex) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m membersByIndex) Less(i, j int) bool { return m[i].index < m[j].index }
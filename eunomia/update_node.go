@@ -11,13 +11,16 @@ import (
 func updateNode(killChannel chan bool, path string, node types.Node, nodeTTL int, updateRate int) {
 	// Function creates (and regularly updates) a node entry under /core/clusters/<cluster_name>/
 	client := getEtcdClient()
+	node.Heartbeat = time.Now()
 	nodeJson, err := json.Marshal(node)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Warn("Unable to generate node as json")
 	} else {
 		log.Debug("Creating node entry")
 		log.WithFields(log.Fields{"key": path + "/" + node.UUID.String()}).Info("Created node key")
+		start := time.Now()
 		_, err := client.Create(path+"/"+node.UUID.String(), string(nodeJson), uint64(nodeTTL))
+		observeEtcd("create", start, err)
 		if err != nil {
 			log.WithFields(log.Fields{"error": err}).Warn("Unable to create node")
 		}
@@ -28,7 +31,11 @@ func updateNode(killChannel chan bool, path string, node types.Node, nodeTTL int
 				return
 			case <-ticker.C:
 				log.WithFields(log.Fields{"key": path + "/" + node.UUID.String(), "ttl": fmt.Sprintf("%v", updateRate)}).Debug("Updating node key")
+				node.Heartbeat = time.Now()
+				nodeJson, _ := json.Marshal(node)
+				start := time.Now()
 				_, err := client.Update(path+"/"+node.UUID.String(), string(nodeJson), uint64(nodeTTL))
+				observeEtcd("update", start, err)
 				if err != nil {
 					log.WithFields(log.Fields{"error": err}).Warn("Unable to update node")
 				}
@@ -4,6 +4,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/kieranbroadfoot/horae/types"
 	"strings"
+	"time"
 )
 
 func updateWorker(nodeId int, workerCh chan types.EunomiaRequest) {
@@ -18,14 +19,18 @@ func updateWorker(nodeId int, workerCh chan types.EunomiaRequest) {
 				key = getClusterPath()+"/"+key
 			}
 			if request.Action == types.EunomiaStoreUpdate {
+				start := time.Now()
 				_, err := client.Set(key, request.Value, request.TTL)
+				observeEtcd("set", start, err)
 				if err != nil {
 					log.WithFields(log.Fields{"key": key, "value": request.Value, "error": err}).Warn("Unable to update key")
 				} else {
 					log.WithFields(log.Fields{"key": key, "value": request.Value, "worker": nodeId}).Info("Updated key")
 				}
 			} else if request.Action == types.EunomiaStoreDelete {
+				start := time.Now()
 				_, err := client.Delete(key, false)
+				observeEtcd("delete", start, err)
 				if err != nil {
 					log.WithFields(log.Fields{"key": key, "value": request.Value, "error": err}).Warn("Unable to delete key")
 				} else {
@@ -2,8 +2,15 @@ package main // import "github.com/kieranbroadfoot/horae"
 
 import (
 	"github.com/kieranbroadfoot/horae/core"
+	"os"
 )
 
 func main() {
-	core.StartServer()
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		core.StartSimulation(os.Args[2:])
+	} else if len(os.Args) > 1 && os.Args[1] == "reindex-tags" {
+		core.StartReindex(os.Args[2:])
+	} else {
+		core.StartServer()
+	}
 }
@@ -5,8 +5,9 @@ import (
 	"errors"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gocql/gocql"
-	"github.com/relops/cqlr"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 	"strings"
 )
@@ -19,11 +20,12 @@ type Action struct {
 	Status    string     `cql:"status" json:"status,omitempty"`
 	Failure   string     `cql:"failure" json:"failure,omitempty"`
 	OurTags   []string   `json:"tags,omitempty" description:"Tags assigned to the action."`
+	span      SpanContext `json:"-"`
 }
 
 func GetActions() []Action {
 	query := session.Query("select * from actions")
-	bind := cqlr.BindQuery(query)
+	bind := query.Binding()
 	var action Action
 	actions := []Action{}
 	for bind.Scan(&action) {
@@ -33,24 +35,55 @@ func GetActions() []Action {
 	return actions
 }
 
-func GetActionsByTag(tag string) []Action {
-	var id gocql.UUID
-	var action Action
+
+var actionSource = listSource{
+	table:   "actions",
+	key:     "action_uuid",
+	object:  "action",
+	columns: "action_uuid, status, uri",
+	row:     func() interface{} { return &Action{} },
+	item: func(row interface{}) listItem {
+		action := row.(*Action)
+		// actions have no name; they are filtered by the prefix of their URI
+		return listItem{UUID: action.UUID, Status: action.Status, Name: action.URI}
+	},
+}
+
+// ListActions returns a page of the actions matching the options
+func ListActions(options ListOptions) ([]Action, ListPage, error) {
+	items, page, err := actionSource.list(options)
+	if err != nil {
+		return nil, page, err
+	}
+	loaded := map[gocql.UUID]Action{}
+	for _, chunk := range inChunks(itemUUIDs(items)) {
+		placeholders, values := inClause(chunk)
+		bind := session.Query("select * from actions where action_uuid in ("+placeholders+")", values...).Binding()
+		var action Action
+		for bind.Scan(&action) {
+			loaded[action.UUID] = action
+		}
+		if err := bind.Close(); err != nil {
+			return nil, page, err
+		}
+	}
+	tags, err := loadTags(itemUUIDs(items))
+	if err != nil {
+		return nil, page, err
+	}
 	actions := []Action{}
-	iteration := session.Query("select object_uuid from tags where type = 'action' and tag = ? allow filtering", tag).Iter()
-	for iteration.Scan(&id) {
-		q := session.Query("select * from actions where action_uuid = ? allow filtering", id)
-		b := cqlr.BindQuery(q)
-		b.Scan(&action)
-		action.LoadTags()
-		actions = append(actions, action)
+	for _, item := range items {
+		if action, ok := loaded[item.UUID]; ok {
+			action.OurTags = tags[action.UUID]
+			actions = append(actions, action)
+		}
 	}
-	return actions
+	return actions, page, nil
 }
 
 func GetAction(actionUUID string) (Action, error) {
 	query := session.Query("select * from actions where action_uuid = ?", actionUUID)
-	bind := cqlr.BindQuery(query)
+	bind := query.Binding()
 	var action Action
 	if !bind.Scan(&action) {
 		return Action{}, errors.New("Unknown action")
@@ -64,8 +97,8 @@ func (action *Action) CreateOrUpdate() error {
 		// action was generated from json with an unknown UUID.  Fix up
 		action.UUID = gocql.TimeUUID()
 	}
-	bind := cqlr.Bind(`insert into actions (action_uuid, operation, uri, payload, status, failure) values (?, ?, ?, ?, ?, ?)`, action)
-	if err := bind.Exec(session); err != nil {
+	bind := session.Bind(`insert into actions (action_uuid, operation, uri, payload, status, failure) values (?, ?, ?, ?, ?, ?)`, action)
+	if err := bind.Within(action.span).Exec(); err != nil {
 		return err
 	} else {
 		return nil
@@ -74,8 +107,8 @@ func (action *Action) CreateOrUpdate() error {
 
 func (action *Action) Delete() error {
 	action.DeleteTags()
-	bind := cqlr.Bind(`delete from actions where action_uuid = ?`, action)
-	if err := bind.Exec(session); err != nil {
+	bind := session.Bind(`delete from actions where action_uuid = ?`, action)
+	if err := bind.Exec(); err != nil {
 		log.Print("received error from delete")
 		return err
 	} else {
@@ -96,33 +129,92 @@ func (a Action) DeleteTags() {
 }
 
 func (action *Action) Execute(task *Task) bool {
+	return action.execute(map[string]string{
+		"<<HORAE_API_URI>>": Configuration.PublicURL,
+		"<<HORAE_COMPLETION_URI>>": Configuration.PublicURL+"v1/task/"+task.UUID.String()+"/complete",
+		"<<HORAE_TASK_UUID>>": task.UUID.String(),
+		"<<HORAE_TASK_STATUS>>": task.Status,
+	}, task.span)
+}
+
+// ExecuteForBackpressure executes the backpressure action of a queue when pressure is raised or relieved.  The depth
+// of the queue and the age (in seconds) of its oldest pending task are available to the uri and payload.
+func (action *Action) ExecuteForBackpressure(q Queue, event string, depth uint64, age time.Duration) bool {
+	return action.execute(map[string]string{
+		"<<HORAE_API_URI>>": Configuration.PublicURL,
+		"<<HORAE_QUEUE_UUID>>": q.UUID.String(),
+		"<<HORAE_QUEUE_NAME>>": q.Name,
+		"<<HORAE_QUEUE_DEPTH>>": strconv.FormatUint(depth, 10),
+		"<<HORAE_QUEUE_OLDEST_AGE>>": strconv.FormatInt(int64(age/time.Second), 10),
+		"<<HORAE_BACKPRESSURE_EVENT>>": event,
+	}, SpanContext{})
+}
+
+// ExecuteForEvent executes the action of a subscription for an event.  The event (as json), its type and the queue and
+// task concerned are available to the uri and payload.
+func (action *Action) ExecuteForEvent(event Event, data string) bool {
+	configMap := map[string]string{
+		"<<HORAE_API_URI>>": Configuration.PublicURL,
+		"<<HORAE_EVENT>>": data,
+		"<<HORAE_EVENT_TYPE>>": event.Type,
+		"<<HORAE_EVENT_STATUS>>": event.Status,
+		"<<HORAE_QUEUE_UUID>>": "",
+		"<<HORAE_TASK_UUID>>": "",
+	}
+	if event.Queue != nil {
+		configMap["<<HORAE_QUEUE_UUID>>"] = event.Queue.String()
+	}
+	if event.Task != nil {
+		configMap["<<HORAE_TASK_UUID>>"] = event.Task.String()
+	}
+	return action.execute(configMap, SpanContext{})
+}
+
+// execute calls the action within the given span (if valid, otherwise a new trace is started).  The span of the call is
+// propagated to the action as a W3C traceparent.
+func (action *Action) execute(configMap map[string]string, parent SpanContext) bool {
+	startWork()
+	defer finishWork()
 	start := time.Now()
 	// create temp vars for uri and payload.  we don't want to save the resolved versions back to the DB
 	uri := action.URI
 	payload := action.Payload
-	configMap := map[string]string{
-		"<<HORAE_API_URI>>": Configuration.MasterURI,
-		"<<HORAE_COMPLETION_URI>>": Configuration.MasterURI+"v1/task/"+task.UUID.String()+"/complete",
-		"<<HORAE_TASK_UUID>>": task.UUID.String(),
-		"<<HORAE_TASK_STATUS>>": task.Status,
-	}
 	for k, v := range configMap {
 		uri = strings.Replace(uri, k, v, -1)
 		payload = strings.Replace(payload, k, v, -1)
 	}
 	// log later so we have a resolved URI
 	log.WithFields(log.Fields{"action": action.UUID, "URI": uri, "verb": action.Operation}).Info("Executing Action")
-	response, error := action.makeRequest(uri, payload)
+	span := StartSpan("Action.Execute", SpanClient, parent)
+	span.SetAttribute("horae.action.uuid", action.UUID.String())
+	span.SetAttribute("http.method", action.Operation)
+	span.SetAttribute("http.url", uri)
+	action.span = span.Context
+	defer span.Finish()
+	requestStart := time.Now()
+	response, error := action.makeRequest(uri, payload, span.Context.Traceparent())
+	host := ""
+	if parsed, err := url.Parse(uri); err == nil {
+		host = parsed.Host
+	}
+	MetricActionDuration.ObserveSince(requestStart, host)
 	if error != nil {
 		action.Status = TaskFailed
 		action.Failure = error.Error()
 	} else {
+		response.Body.Close()
+		span.SetAttribute("http.status_code", strconv.Itoa(response.StatusCode))
 		if response.StatusCode >= 200 && response.StatusCode < 300 {
 			action.Status = TaskComplete
+			action.Failure = ""
 		} else {
 			action.Status = TaskFailed
+			action.Failure = response.Status
 		}
 	}
+	if action.Status == TaskFailed {
+		span.SetError(action.Failure)
+	}
 	action.CreateOrUpdate()
 	log.WithFields(log.Fields{"action": action.UUID, "status": action.Status, "time": time.Since(start)}).Info("Finished Action Execution")
 	if action.Status == TaskComplete {
@@ -132,21 +224,24 @@ func (action *Action) Execute(task *Task) bool {
 	}
 }
 
-func (a Action) makeRequest(uri string, payload string) (resp *http.Response, err error) {
+func (a Action) makeRequest(uri string, payload string, traceparent string) (resp *http.Response, err error) {
+	var request *http.Request
 	switch {
-	case a.Operation == TaskGet:
-		return http.Get(uri)
+	case a.Operation == TaskGet, a.Operation == TaskHead, a.Operation == TaskDelete:
+		request, err = http.NewRequest(a.Operation, uri, nil)
 	case a.Operation == TaskPost:
-		return http.Post(uri, "application/json", bytes.NewBufferString(payload))
-	case a.Operation == TaskHead:
-		return http.Head(uri)
-	case a.Operation == TaskDelete:
-		request, err := http.NewRequest(TaskDelete, uri, nil)
-		if err != nil {
-			return http.DefaultClient.Do(request)
-		} else {
-			return nil, err
+		request, err = http.NewRequest(a.Operation, uri, bytes.NewBufferString(payload))
+		if err == nil {
+			request.Header.Set("Content-Type", "application/json")
 		}
+	default:
+		return nil, errors.New("No valided handler for " + a.Operation)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if traceparent != "" {
+		request.Header.Set(TraceparentHeader, traceparent)
 	}
-	return nil, errors.New("No valided handler for " + a.Operation)
+	return http.DefaultClient.Do(request)
 }
@@ -1,5 +1,9 @@
 package types
 
+import (
+	"github.com/gocql/gocql"
+)
+
 type Success struct {
 	Message string `json:"message,required" description:"Returned status message"`
 }
@@ -8,3 +12,9 @@ type Error struct {
 	Code    uint32 `json:"code,required" description:"The unique identifier of the returned error"`
 	Message string `json:"message,required" description:"An error message"`
 }
+
+// BulkResult reports the outcome of an operation on every object chosen by a selector
+type BulkResult struct {
+	Succeeded []gocql.UUID      `json:"succeeded" description:"The objects on which the operation succeeded"`
+	Failed    map[string]string `json:"failed,omitempty" description:"The error of each object (by UUID) on which the operation failed"`
+}
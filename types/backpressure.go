@@ -0,0 +1,119 @@
+package types
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gocql/gocql"
+	"time"
+)
+
+const (
+	BackpressureRaised   = "raised"
+	BackpressureRelieved = "relieved"
+
+	// the minimum interval between backpressure signals unless the queue defines its own
+	DefaultBackpressureInterval = 60 * time.Second
+	// how often the queue manager re-checks backpressure when no tasks change (e.g. for the age of the oldest task)
+	BackpressureCheckInterval = 30 * time.Second
+)
+
+// Backpressure is the backpressure state of a queue, held by the queue manager of the master.  Pressure is raised
+// when the number of waiting tasks exceeds the high watermark (the backpressure definition) or the oldest pending task
+// has waited longer than the maximum age.  It is relieved only once the number of waiting tasks has fallen to the low
+// watermark and the oldest task is within the maximum age, so a queue hovering around the high watermark does not
+// signal repeatedly.  Signals are never sent more often than the minimum interval of the queue; a change held back is
+// signalled by a later check.
+type Backpressure struct {
+	Raised     bool
+	LastSignal time.Time
+}
+
+// Check measures the queue and executes its backpressure action if pressure is raised or relieved.  The queue must
+// carry its effective settings (see Effective), which the caller looks up when the queue or its ancestors change
+// rather than on every check.
+func (b *Backpressure) Check(q Queue) {
+	if q.BackpressureDefinition == 0 && q.BackpressureMaxAge == 0 && !b.Raised {
+		// backpressure is not configured
+		return
+	}
+	depth := q.CountOfTasks()
+	age := q.OldestPendingAge()
+	event := b.evaluate(q, depth, age, GetClock().Now())
+	if event == "" {
+		return
+	}
+	log.WithFields(log.Fields{"queue": q.UUID, "event": event, "depth": depth, "oldestAge": age}).Info("Backpressure " + event)
+	published := NewQueueEvent(EventBackpressure, q)
+	published.Status = event
+	published.Detail = fmt.Sprintf("%d waiting tasks, oldest pending for %s", depth, age)
+	PublishEvent(published)
+	if q.BackPressureAction != nil && q.BackPressureAction.String() != "00000000-0000-0000-0000-000000000000" {
+		action, err := GetAction(q.BackPressureAction.String())
+		if err != nil {
+			log.WithFields(log.Fields{"queue": q.UUID, "action": q.BackPressureAction}).Info("Backpressure action not found")
+			return
+		}
+		go action.ExecuteForBackpressure(q, event, depth, age)
+	}
+}
+
+// evaluate returns the event (if any) to signal for the given depth and age, updating the state accordingly
+func (b *Backpressure) evaluate(q Queue, depth uint64, age time.Duration, now time.Time) string {
+	maxAge := time.Duration(q.BackpressureMaxAge) * time.Second
+	overDepth := q.BackpressureDefinition > 0 && depth > q.BackpressureDefinition
+	overAge := maxAge > 0 && age > maxAge
+	event := ""
+	if !b.Raised && (overDepth || overAge) {
+		event = BackpressureRaised
+	} else if b.Raised && (q.BackpressureDefinition == 0 || depth <= q.lowWatermark()) && !overAge {
+		event = BackpressureRelieved
+	}
+	if event == "" {
+		return ""
+	}
+	if !b.LastSignal.IsZero() && now.Sub(b.LastSignal) < q.backpressureInterval() {
+		// too soon after the last signal
+		return ""
+	}
+	b.Raised = event == BackpressureRaised
+	b.LastSignal = now
+	return event
+}
+
+// lowWatermark returns the depth at or below which raised pressure is relieved
+func (q Queue) lowWatermark() uint64 {
+	if q.BackpressureLowMark > 0 {
+		return q.BackpressureLowMark
+	}
+	return q.BackpressureDefinition / 2
+}
+
+func (q Queue) backpressureInterval() time.Duration {
+	if q.BackpressureInterval > 0 {
+		return time.Duration(q.BackpressureInterval) * time.Second
+	}
+	return DefaultBackpressureInterval
+}
+
+// OldestPendingAge returns how long the oldest pending task of the queue has been waiting: since it was created (for
+// sync queues) or since it fell due (for async queues)
+func (q Queue) OldestPendingAge() time.Duration {
+	now := GetClock().Now()
+	if q.QueueType == QueueSync {
+		var id gocql.UUID
+		oldest := now
+		iteration := session.Query("select task_uuid from sync_tasks where queue_uuid = ? and status = ?", q.UUID, TaskPending).Iter()
+		for iteration.Scan(&id) {
+			// task identifiers are time based
+			if id.Time().Before(oldest) {
+				oldest = id.Time()
+			}
+		}
+		return now.Sub(oldest)
+	}
+	var when time.Time
+	if err := session.Query("select when from async_tasks where queue_uuid = ? and status = ? and when < ? order by when asc limit 1", q.UUID, TaskPending, now).Scan(&when); err == nil {
+		return now.Sub(when)
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+type backpressureStep struct {
+	after time.Duration
+	depth uint64
+	age   time.Duration
+	event string
+}
+
+func TestBackpressureEvaluate(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue Queue
+		steps []backpressureStep
+	}{
+		{"raised above the high watermark", Queue{BackpressureDefinition: 10}, []backpressureStep{
+			{0, 10, 0, ""},
+			{time.Second, 11, 0, BackpressureRaised},
+		}},
+		{"relieved at half the high watermark", Queue{BackpressureDefinition: 10}, []backpressureStep{
+			{0, 11, 0, BackpressureRaised},
+			{2 * time.Minute, 6, 0, ""},
+			{3 * time.Minute, 5, 0, BackpressureRelieved},
+		}},
+		{"relieved at the low watermark", Queue{BackpressureDefinition: 10, BackpressureLowMark: 8}, []backpressureStep{
+			{0, 11, 0, BackpressureRaised},
+			{2 * time.Minute, 9, 0, ""},
+			{3 * time.Minute, 8, 0, BackpressureRelieved},
+		}},
+		{"hysteresis around the high watermark", Queue{BackpressureDefinition: 10}, []backpressureStep{
+			{0, 11, 0, BackpressureRaised},
+			{2 * time.Minute, 10, 0, ""},
+			{3 * time.Minute, 11, 0, ""},
+			{4 * time.Minute, 9, 0, ""},
+			{5 * time.Minute, 4, 0, BackpressureRelieved},
+			{6 * time.Minute, 10, 0, ""},
+			{7 * time.Minute, 11, 0, BackpressureRaised},
+		}},
+		{"held back for the default interval", Queue{BackpressureDefinition: 10}, []backpressureStep{
+			{0, 11, 0, BackpressureRaised},
+			{30 * time.Second, 0, 0, ""},
+			{59 * time.Second, 0, 0, ""},
+			{60 * time.Second, 0, 0, BackpressureRelieved},
+		}},
+		{"held back for the interval of the queue", Queue{BackpressureDefinition: 10, BackpressureInterval: 10}, []backpressureStep{
+			{0, 11, 0, BackpressureRaised},
+			{5 * time.Second, 0, 0, ""},
+			{10 * time.Second, 0, 0, BackpressureRelieved},
+			{15 * time.Second, 11, 0, ""},
+			{20 * time.Second, 11, 0, BackpressureRaised},
+		}},
+		{"raised by the age of the oldest task", Queue{BackpressureMaxAge: 300}, []backpressureStep{
+			{0, 1000, 300 * time.Second, ""},
+			{time.Second, 0, 301 * time.Second, BackpressureRaised},
+			{2 * time.Minute, 0, 300 * time.Second, BackpressureRelieved},
+		}},
+		{"held by age below the low watermark", Queue{BackpressureDefinition: 10, BackpressureMaxAge: 300}, []backpressureStep{
+			{0, 11, 0, BackpressureRaised},
+			{2 * time.Minute, 0, 301 * time.Second, ""},
+			{3 * time.Minute, 0, 10 * time.Second, BackpressureRelieved},
+			{4 * time.Minute, 0, 301 * time.Second, BackpressureRaised},
+		}},
+	}
+	start := time.Date(2026, time.October, 12, 9, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		b := Backpressure{}
+		for idx, step := range test.steps {
+			now := start.Add(step.after)
+			if event := b.evaluate(test.queue, step.depth, step.age, now); event != step.event {
+				t.Errorf("%s: step %d expected %q but was %q", test.name, idx, step.event, event)
+			}
+			if step.event != "" && (b.Raised != (step.event == BackpressureRaised) || !b.LastSignal.Equal(now)) {
+				t.Errorf("%s: step %d did not record the signal: %+v", test.name, idx, b)
+			}
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gocql/gocql"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// an entry may not cover more days than a window will search for an occurrence
+const maxCalendarEntryDays = maxDaysSearched
+
+var RE_CALENDAR_NAME = regexp.MustCompile("^[a-z0-9][a-z0-9_.-]*$")
+
+// A Calendar is a named set of dates, e.g. public holidays or change freezes, which may be referenced by a window of
+// operation, e.g. "9am - 5pm every weekday except calendar uk-holidays".
+type Calendar struct {
+	UUID        gocql.UUID      `cql:"calendar_uuid" json:"uuid,required" description:"The unique identifier of the calendar"`
+	Name        string          `cql:"name" json:"name,required" description:"The unique name of the calendar as used by windows of operation, e.g. uk-holidays"`
+	Description string          `cql:"description" json:"description,omitempty" description:"A description of the calendar"`
+	Entries     []CalendarEntry `json:"entries,omitempty" description:"The dates and date ranges within the calendar"`
+}
+
+// A CalendarEntry is a single date or an (inclusive) range of dates
+type CalendarEntry struct {
+	Start   string `cql:"start_date" json:"start,required" description:"The first date (DD/MM/YYYY) of the entry"`
+	End     string `cql:"end_date" json:"end,omitempty" description:"The last date (DD/MM/YYYY) of the entry. Defaults to the start date"`
+	Summary string `cql:"summary" json:"summary,omitempty" description:"A description of the entry, e.g. Christmas Day"`
+}
+
+// calendarDates is the expanded set of days covered by a calendar
+type calendarDates map[date]bool
+
+// Query
+func GetCalendars() []Calendar {
+	query := session.Query("select * from calendars")
+	bind := query.Binding()
+	var calendar Calendar
+	calendars := []Calendar{}
+	for bind.Scan(&calendar) {
+		calendar.LoadEntries()
+		calendars = append(calendars, calendar)
+	}
+	return calendars
+}
+
+func GetCalendar(calendarUUID string) (Calendar, error) {
+	query := session.Query("select * from calendars where calendar_uuid = ?", calendarUUID)
+	bind := query.Binding()
+	var calendar Calendar
+	if !bind.Scan(&calendar) {
+		return Calendar{}, errors.New("Unknown calendar")
+	}
+	calendar.LoadEntries()
+	return calendar, nil
+}
+
+func GetCalendarByName(name string) (Calendar, error) {
+	var id gocql.UUID
+	if err := session.Query(`select calendar_uuid from calendars where name = ? limit 1 allow filtering`, strings.ToLower(name)).Scan(&id); err != nil {
+		return Calendar{}, errors.New("Unknown calendar: " + name)
+	}
+	return GetCalendar(id.String())
+}
+
+// CRUD
+func (calendar *Calendar) CreateOrUpdate() error {
+	if calendar.UUID.String() == "00000000-0000-0000-0000-000000000000" {
+		// calendar was generated from json with an unknown UUID.  Fix up
+		calendar.UUID = gocql.TimeUUID()
+	}
+	calendar.Name = strings.ToLower(calendar.Name)
+	if !RE_CALENDAR_NAME.MatchString(calendar.Name) {
+		return errors.New("Invalid calendar name: names may only contain letters, numbers, \"-\", \"_\" and \".\"")
+	}
+	if existing, err := GetCalendarByName(calendar.Name); err == nil && existing.UUID != calendar.UUID {
+		return errors.New("Calendar name already in use")
+	}
+	if existing, err := GetCalendar(calendar.UUID.String()); err == nil && existing.Name != calendar.Name {
+		// windows refer to calendars by name so a rename would silently change them
+		if queues := existing.ReferencingQueues(); len(queues) > 0 {
+			return errors.New("Cannot rename calendar used by queue: " + queues[0].Name)
+		}
+	}
+	entries, err := normaliseCalendarEntries(calendar.Entries)
+	if err != nil {
+		return err
+	}
+	calendar.Entries = entries
+	bind := session.Bind(`insert into calendars (calendar_uuid, name, description) values (?, ?, ?)`, calendar)
+	if err := bind.Exec(); err != nil {
+		return err
+	}
+	return calendar.CreateOrUpdateEntries()
+}
+
+func (calendar Calendar) Delete() error {
+	if queues := calendar.ReferencingQueues(); len(queues) > 0 {
+		return errors.New("Calendar is used by queue: " + queues[0].Name)
+	}
+	calendar.DeleteEntries()
+	if err := session.Query(`delete from calendars where calendar_uuid = ?`, calendar.UUID).Exec(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Calendar) LoadEntries() {
+	entries := []CalendarEntry{}
+	query := session.Query("select start_date, end_date, summary from calendar_entries where calendar_uuid = ?", c.UUID)
+	bind := query.Binding()
+	var entry CalendarEntry
+	for bind.Scan(&entry) {
+		entries = append(entries, entry)
+	}
+	sortCalendarEntries(entries)
+	c.Entries = entries
+}
+
+func (c Calendar) CreateOrUpdateEntries() error {
+	c.DeleteEntries()
+	for _, entry := range c.Entries {
+		if err := session.Query(`insert into calendar_entries (calendar_uuid, start_date, end_date, summary) values (?, ?, ?, ?)`, c.UUID, entry.Start, entry.End, entry.Summary).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Calendar) DeleteEntries() {
+	session.Query(`delete from calendar_entries where calendar_uuid = ?`, c.UUID).Exec()
+}
+
+// Import adds the entries to the calendar.  Entries which are already known are ignored.  If replace is set the
+// existing entries are removed first.
+func (c *Calendar) Import(entries []CalendarEntry, replace bool) error {
+	if replace {
+		c.Entries = []CalendarEntry{}
+	}
+	known := map[string]bool{}
+	for _, entry := range c.Entries {
+		known[entry.Start+"-"+entry.End] = true
+	}
+	normalised, err := normaliseCalendarEntries(entries)
+	if err != nil {
+		return err
+	}
+	for _, entry := range normalised {
+		if !known[entry.Start+"-"+entry.End] {
+			known[entry.Start+"-"+entry.End] = true
+			c.Entries = append(c.Entries, entry)
+		}
+	}
+	return c.CreateOrUpdate()
+}
+
+// ReferencingQueues returns the queues whose window of operation refers to the calendar
+func (c Calendar) ReferencingQueues() []Queue {
+	queues := []Queue{}
+	for _, queue := range GetQueues() {
+		window, err := Parse(queue.WindowOfOperation)
+		if err == nil && isStringInSlice(c.Name, window.Calendars()) {
+			queues = append(queues, queue)
+		}
+	}
+	return queues
+}
+
+// dates expands the entries of the calendar into the set of days it covers
+func (c Calendar) dates() calendarDates {
+	dates := calendarDates{}
+	for _, entry := range c.Entries {
+		start, serr := parseCalendarDate(entry.Start)
+		end, eerr := parseCalendarDate(entry.End)
+		if serr != nil || eerr != nil {
+			continue
+		}
+		for day, i := start, 0; !dateAfter(day, end) && i < maxCalendarEntryDays; day, i = addDaysTodate(day, 1), i+1 {
+			dates[day] = true
+		}
+	}
+	return dates
+}
+
+// loadCalendarDates returns the days covered by the named calendar.  An unknown calendar (one deleted after the window
+// was parsed) covers no days.
+func loadCalendarDates(name string) *calendarDates {
+	dates := calendarDates{}
+	calendar, err := GetCalendarByName(name)
+	if err != nil {
+		log.WithFields(log.Fields{"calendar": name}).Warn("Window refers to an unknown calendar")
+	} else {
+		dates = calendar.dates()
+	}
+	return &dates
+}
+
+// ValidateCalendars ensures each of the calendars referenced by the window is known
+func (w Window) ValidateCalendars() error {
+	for _, name := range w.Calendars() {
+		if _, err := GetCalendarByName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normaliseCalendarEntries(entries []CalendarEntry) ([]CalendarEntry, error) {
+	normalised := []CalendarEntry{}
+	for _, entry := range entries {
+		if entry.End == "" {
+			entry.End = entry.Start
+		}
+		start, err := parseCalendarDate(entry.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseCalendarDate(entry.End)
+		if err != nil {
+			return nil, err
+		}
+		if dateAfter(start, end) {
+			return nil, fmt.Errorf("Invalid calendar entry: %s is after %s", entry.Start, entry.End)
+		}
+		if dateAfter(end, addDaysTodate(start, maxCalendarEntryDays)) {
+			return nil, fmt.Errorf("Invalid calendar entry: %s - %s covers too many days", entry.Start, entry.End)
+		}
+		entry.Start = formatCalendarDate(start)
+		entry.End = formatCalendarDate(end)
+		normalised = append(normalised, entry)
+	}
+	sortCalendarEntries(normalised)
+	return normalised, nil
+}
+
+// parseCalendarDate parses a date in the same form as the window grammar (DD/MM/YYYY, DD-MM-YYYY or DD/MM/YY)
+func parseCalendarDate(input string) (date, error) {
+	elements := strings.Split(strings.Replace(input, "-", "/", -1), "/")
+	if len(elements) != 3 {
+		return date{}, errors.New("Invalid calendar date: \"" + input + "\" (expected DD/MM/YYYY)")
+	}
+	if len(elements[2]) == 2 {
+		elements[2] = "20" + elements[2]
+	}
+	day, derr := strconv.Atoi(elements[0])
+	month, merr := strconv.Atoi(elements[1])
+	year, yerr := strconv.Atoi(elements[2])
+	if derr != nil || merr != nil || yerr != nil {
+		return date{}, errors.New("Invalid calendar date: \"" + input + "\" (expected DD/MM/YYYY)")
+	}
+	parsed := date{day: day, month: time.Month(month), year: year}
+	if addDaysTodate(parsed, 0) != parsed {
+		return date{}, errors.New("Invalid calendar date: \"" + input + "\"")
+	}
+	return parsed, nil
+}
+
+func formatCalendarDate(d date) string {
+	return fmt.Sprintf("%02d/%02d/%04d", d.day, int(d.month), d.year)
+}
+
+func dateAfter(a date, b date) bool {
+	return time.Date(a.year, a.month, a.day, 0, 0, 0, 0, time.UTC).After(time.Date(b.year, b.month, b.day, 0, 0, 0, 0, time.UTC))
+}
+
+type byCalendarStart []CalendarEntry
+
+func (e byCalendarStart) Len() int      { return len(e) }
+func (e byCalendarStart) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e byCalendarStart) Less(i, j int) bool {
+	a, _ := parseCalendarDate(e[i].Start)
+	b, _ := parseCalendarDate(e[j].Start)
+	return dateAfter(b, a)
+}
+
+func sortCalendarEntries(entries []CalendarEntry) {
+	sort.Sort(byCalendarStart(entries))
+}
@@ -0,0 +1,203 @@
+package types
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock is the source of time for the scheduler.  Windows, queues and the queue managers in dike use the current
+// clock (see GetClock) rather than the time package directly so their behaviour may be driven by a FakeClock.
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a timer which delivers the time on its channel once the duration has elapsed
+	NewTimer(d time.Duration) Timer
+	// AfterFunc calls f once the duration has elapsed
+	AfterFunc(d time.Duration, f func()) Timer
+	Sleep(d time.Duration)
+}
+
+// A Timer is a single event created by a Clock.  The channel of a timer created by AfterFunc is never used.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+var (
+	clockMutex   sync.RWMutex
+	currentClock Clock = RealClock{}
+)
+
+// GetClock returns the clock used by the scheduler.  Long running work (e.g. a queue manager) reads the clock once
+// as it starts.
+func GetClock() Clock {
+	clockMutex.RLock()
+	defer clockMutex.RUnlock()
+	return currentClock
+}
+
+// SetClock replaces the clock used by the scheduler.  It should be called before any queues are started as work
+// already running keeps the clock it started with.
+func SetClock(c Clock) {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	currentClock = c
+}
+
+// RealClock is a Clock backed by the time package
+type RealClock struct{}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) NewTimer(d time.Duration) Timer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{timer: time.AfterFunc(d, f)}
+}
+
+func (RealClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// FakeClock is a Clock whose time only moves when it is advanced.  Timers fire, in order of their deadline, as the
+// clock passes them and the clock reads the deadline of each timer as it fires.  Functions given to AfterFunc are
+// called synchronously by Advance so a simulation proceeds deterministically.
+type FakeClock struct {
+	mutex   sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	c        chan time.Time
+	f        func()
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.changed = sync.NewCond(&c.mutex)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.addTimer(d, nil)
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.addTimer(d, f)
+}
+
+// Sleep blocks until the clock has been advanced by at least the duration
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.NewTimer(d).C()
+}
+
+// Advance moves the clock forward by the duration, firing any timers which fall due on the way
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	target := c.now.Add(d)
+	c.mutex.Unlock()
+	c.AdvanceTo(target)
+}
+
+// AdvanceTo moves the clock forward to the given time, firing any timers which fall due on the way.  The clock never
+// moves backwards.
+func (c *FakeClock) AdvanceTo(target time.Time) {
+	for {
+		c.mutex.Lock()
+		next := -1
+		for idx, timer := range c.timers {
+			if !timer.deadline.After(target) && (next < 0 || timer.deadline.Before(c.timers[next].deadline)) {
+				next = idx
+			}
+		}
+		if next < 0 {
+			if target.After(c.now) {
+				c.now = target
+			}
+			c.changed.Broadcast()
+			c.mutex.Unlock()
+			return
+		}
+		timer := c.timers[next]
+		c.timers = append(c.timers[:next], c.timers[next+1:]...)
+		if timer.deadline.After(c.now) {
+			c.now = timer.deadline
+		}
+		now := c.now
+		c.changed.Broadcast()
+		c.mutex.Unlock()
+		if timer.f != nil {
+			timer.f()
+		} else {
+			timer.c <- now
+		}
+	}
+}
+
+// PendingTimers returns the number of timers which have not yet fired or been stopped
+func (c *FakeClock) PendingTimers() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil waits until at least n timers are pending.  Use it to wait for goroutines driven by the clock (e.g. a
+// queue manager) to reach their next timer before advancing.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+func (c *FakeClock) addTimer(d time.Duration, f func()) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	timer := &fakeTimer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1), f: f}
+	c.timers = append(c.timers, timer)
+	c.changed.Broadcast()
+	return timer
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	for idx, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:idx], t.clock.timers[idx+1:]...)
+			t.clock.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockFiresTimersInOrder(t *testing.T) {
+	from := time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(from)
+
+	// tasks scheduled across three weeks, out of order
+	delays := []time.Duration{
+		9 * 24 * time.Hour,
+		2 * time.Hour,
+		20*24*time.Hour + 30*time.Minute,
+		15 * time.Second,
+		2*time.Hour + time.Second,
+	}
+	fired := []time.Time{}
+	for _, delay := range delays {
+		clock.AfterFunc(delay, func() { fired = append(fired, clock.Now()) })
+	}
+	stopped := clock.AfterFunc(3*24*time.Hour, func() { t.Error("stopped timer fired") })
+	if !stopped.Stop() {
+		t.Error("expected a pending timer to stop")
+	}
+
+	clock.AdvanceTo(from.Add(21 * 24 * time.Hour))
+	expected := []time.Duration{15 * time.Second, 2 * time.Hour, 2*time.Hour + time.Second, 9 * 24 * time.Hour, 20*24*time.Hour + 30*time.Minute}
+	if len(fired) != len(expected) {
+		t.Fatalf("expected %d timers to fire but %d fired", len(expected), len(fired))
+	}
+	for idx, delay := range expected {
+		if !fired[idx].Equal(from.Add(delay)) {
+			t.Errorf("expected timer %d to fire at %v but fired at %v", idx, from.Add(delay), fired[idx])
+		}
+	}
+	if !clock.Now().Equal(from.Add(21 * 24 * time.Hour)) {
+		t.Errorf("expected clock to read %v but was %v", from.Add(21*24*time.Hour), clock.Now())
+	}
+	if clock.PendingTimers() != 0 {
+		t.Errorf("expected no pending timers but found %d", clock.PendingTimers())
+	}
+}
+
+func TestFakeClockTimersScheduledByTimers(t *testing.T) {
+	// a task which reschedules itself every 4 hours fires 42 times in a week
+	from := time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(from)
+	count := 0
+	var fire func()
+	fire = func() {
+		count++
+		clock.AfterFunc(4*time.Hour, fire)
+	}
+	clock.AfterFunc(4*time.Hour, fire)
+	clock.AdvanceTo(from.Add(7 * 24 * time.Hour))
+	if count != 42 {
+		t.Errorf("expected 42 firings but found %d", count)
+	}
+}
+
+func TestFakeClockSleep(t *testing.T) {
+	from := time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(from)
+	woken := make(chan time.Time)
+	go func() {
+		for i := 0; i < 3; i++ {
+			clock.Sleep(time.Hour)
+			woken <- clock.Now()
+		}
+	}()
+	for i := 1; i <= 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+		if at := <-woken; !at.Equal(from.Add(time.Duration(i) * time.Hour)) {
+			t.Errorf("expected sleep to end at %v but was %v", from.Add(time.Duration(i)*time.Hour), at)
+		}
+	}
+}
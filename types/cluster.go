@@ -0,0 +1,83 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+	"time"
+)
+
+const (
+	OwnershipAcquired = "acquired"
+	OwnershipReleased = "released"
+
+	// the number of ownership changes returned for a queue unless a limit is given
+	DefaultOwnershipHistory = 20
+)
+
+// ClusterStatus describes the members of the cluster
+type ClusterStatus struct {
+	Name   string        `json:"name,required" description:"The name of the cluster"`
+	Master *gocql.UUID   `json:"master,omitempty" description:"The unique identifier of the elected master, if any"`
+	Nodes  []ClusterNode `json:"nodes,required" description:"The live nodes of the cluster"`
+	Error  string        `json:"-"`
+}
+
+// ClusterNode describes a member of the cluster, as registered in etcd
+type ClusterNode struct {
+	UUID        gocql.UUID   `json:"uuid,required" description:"The unique identifier of the node"`
+	Address     string       `json:"address,required" description:"The address of the API of the node"`
+	Port        string       `json:"port,required" description:"The port of the API of the node"`
+	Version     string       `json:"version,omitempty" description:"The version of horae run by the node"`
+	Role        string       `json:"role,required" description:"master or slave"`
+	Started     time.Time    `json:"started,omitempty" description:"When the node started"`
+	Heartbeat   time.Time    `json:"heartbeat,omitempty" description:"When the node last refreshed its membership"`
+	OwnedQueues []gocql.UUID `json:"ownedQueues,required" description:"The queues owned by the node"`
+}
+
+// QueueOwner describes the current owner of a queue and the history of its ownership
+type QueueOwner struct {
+	Queue   gocql.UUID        `json:"queue,required" description:"The unique identifier of the queue"`
+	Owner   *NodeOwnership    `json:"owner,omitempty" description:"The node which owns the queue.  Absent if the queue has no owner (e.g. its window is closed)"`
+	Since   *time.Time        `json:"since,omitempty" description:"When the owner acquired the queue, if recorded"`
+	History []OwnershipChange `json:"history,required" description:"The most recent changes of ownership, newest first"`
+}
+
+// An OwnershipChange records a node acquiring or releasing a queue
+type OwnershipChange struct {
+	Queue   gocql.UUID `cql:"queue_uuid" json:"-"`
+	Changed gocql.UUID `cql:"changed" json:"-"`
+	When    time.Time  `json:"when,required" description:"When ownership changed"`
+	Node    gocql.UUID `cql:"node_uuid" json:"node,required" description:"The node which acquired or released the queue"`
+	Address string     `cql:"address" json:"address,omitempty" description:"The address of the API of the node"`
+	Port    string     `cql:"port" json:"port,omitempty" description:"The port of the API of the node"`
+	Event   string     `cql:"event" json:"event,required" description:"acquired or released"`
+	Reason  string     `cql:"reason" json:"reason,omitempty" description:"Why the queue was released, e.g. Window Closed, Lost Ownership or Node Draining"`
+}
+
+// RecordOwnershipChange records the node acquiring or releasing the queue
+func RecordOwnershipChange(queue gocql.UUID, node Node, event string, reason string) error {
+	change := OwnershipChange{Queue: queue, Changed: gocql.TimeUUID(), Node: node.UUID, Address: node.Address, Port: node.Port, Event: event, Reason: reason}
+	bind := session.Bind(`insert into queue_ownership (queue_uuid, changed, node_uuid, address, port, event, reason) values (?, ?, ?, ?, ?, ?, ?)`, change)
+	return bind.Exec()
+}
+
+// GetOwnershipHistory returns the most recent changes of ownership of the queue, newest first
+func GetOwnershipHistory(queue gocql.UUID, limit int) []OwnershipChange {
+	query := session.Query("select * from queue_ownership where queue_uuid = ? limit ?", queue, limit)
+	bind := query.Binding()
+	var change OwnershipChange
+	changes := []OwnershipChange{}
+	for bind.Scan(&change) {
+		change.When = change.Changed.Time()
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// TransferResult identifies the node to which mastership or a queue has been transferred
+type TransferResult struct {
+	Node    gocql.UUID `json:"node,required" description:"The unique identifier of the node"`
+	Address string     `json:"address,required" description:"The address of the API of the node"`
+	Port    string     `json:"port,required" description:"The port of the API of the node"`
+	Error   string     `json:"-"`
+	Invalid bool       `json:"-"` // the transfer was refused (e.g. an unknown target) rather than failed
+}
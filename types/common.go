@@ -21,20 +21,57 @@ func SetTagsForObject(uuid gocql.UUID, tags []string, typeOfObject string) {
 			tagsFromDB = findAndRemoveInSlice(tag, tagsFromDB)
 		} else {
 			session.Query(`insert into tags (object_uuid, tag, type) VALUES (?, ?, ?)`, uuid, tag, typeOfObject).Exec()
+			indexTag(uuid, tag, typeOfObject)
 		}
 	}
 	for _, tagToDelete := range tagsFromDB {
 		session.Query(`delete from tags where object_uuid = ? and type = ? and tag = ?`, uuid, typeOfObject, tagToDelete).Exec()
+		unindexTag(uuid, tagToDelete, typeOfObject)
 	}
 }
 
 func DeleteTagsForObject(uuid gocql.UUID) error {
+	var typeOfObject, tag string
+	iteration := session.Query("select type, tag from tags where object_uuid = ?", uuid).Iter()
+	for iteration.Scan(&typeOfObject, &tag) {
+		unindexTag(uuid, tag, typeOfObject)
+	}
+	if err := iteration.Close(); err != nil {
+		return err
+	}
 	if err := session.Query(`delete from tags where object_uuid = ?`, uuid).Exec(); err != nil {
 		return err
 	}
 	return nil
 }
 
+// the tag index records the objects of each type by tag key and value (see Selector)
+func indexTag(uuid gocql.UUID, tag string, typeOfObject string) error {
+	key, value := splitTag(tag)
+	return session.Query(`insert into tag_index (type, key, value, object_uuid) values (?, ?, ?, ?)`, typeOfObject, key, value, uuid).Exec()
+}
+
+func unindexTag(uuid gocql.UUID, tag string, typeOfObject string) error {
+	key, value := splitTag(tag)
+	return session.Query(`delete from tag_index where type = ? and key = ? and value = ? and object_uuid = ?`, typeOfObject, key, value, uuid).Exec()
+}
+
+// RebuildTagIndex indexes the tags of every object, returning the number indexed.  Tags are indexed as they are set, so
+// it is only needed for tags set before the index existed.
+func RebuildTagIndex() (int, error) {
+	var uuid gocql.UUID
+	var typeOfObject, tag string
+	count := 0
+	iteration := session.Query("select object_uuid, type, tag from tags").Iter()
+	for iteration.Scan(&uuid, &typeOfObject, &tag) {
+		if err := indexTag(uuid, tag, typeOfObject); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, iteration.Close()
+}
+
 func isStringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -14,21 +15,65 @@ type Config struct {
 	CassandraAddress string
 	ETCDAddress      string
 	StaticPort       bool
-	MasterURI        string
+	PublicURL        string
+	TraceExporter    string
+	TraceEndpoint    string
+	APIRouting       string
+	QueueAssignment  string
+	DrainTimeout     int
 }
 
+// how API requests are routed.  Every node serves the API itself (active) or slaves proxy requests to the master or
+// redirect clients to it
+const (
+	APIRoutingActive   = "active"
+	APIRoutingProxy    = "proxy"
+	APIRoutingRedirect = "redirect"
+)
+
+// how the owner of a queue is chosen from the nodes which claim it.  Rendezvous hashing spreads queues across the
+// cluster; first gives the queue to the node which claimed it first
+const (
+	QueueAssignmentRendezvous = "rendezvous"
+	QueueAssignmentFirst      = "first"
+)
+
 func InitConfig() {
 	Configuration = Config{}
 
 	flag.Usage = func() {
-		fmt.Printf("Usage of horae:\n\nAll params may be applied via OS environment variables as specified below. These\nvariables take precedence over the command line flags. Default port: 8015\n\n")
+		fmt.Printf("Usage of horae:\n\nAll params may be applied via OS environment variables as specified below. These\nvariables take precedence over the command line flags. Default port: 8015\n\nTo simulate the scheduler without starting a server run \"horae simulate -h\"\n\n")
 		flag.PrintDefaults()
 	}
 	flag.BoolVar(&Configuration.StaticPort, "static-port", true, "Should horae use a static port (HORAE_USE_STATIC_PORT)")
-	flag.StringVar(&Configuration.ClusterName, "clustername", "default", "The horae cluster name (HORAE_CLUSTERNAME)")
-	flag.StringVar(&Configuration.CassandraAddress, "cassandra-address", "127.0.0.1", "Our cassandra address (HORAE_CASSANDRA_ADDRESS)")
 	flag.StringVar(&Configuration.ETCDAddress, "etcd-address", "127.0.0.1:4001", "Our etcd address/port (HORAE_ETCD_ADDRESS)")
+	flag.StringVar(&Configuration.TraceExporter, "trace-exporter", "none", "Export traces to none, stdout or otlp (HORAE_TRACE_EXPORTER)")
+	flag.StringVar(&Configuration.TraceEndpoint, "trace-endpoint", "http://127.0.0.1:4318/v1/traces", "The OTLP/HTTP endpoint of the trace collector (HORAE_TRACE_ENDPOINT)")
+	flag.StringVar(&Configuration.APIRouting, "api-routing", APIRoutingActive, "Should every node serve the API (active) or should slaves proxy requests to the master (proxy) or redirect clients to it (redirect) (HORAE_API_ROUTING)")
+	flag.StringVar(&Configuration.PublicURL, "public-url", "", "The URL at which actions reach the horae API, e.g. a load balancer in front of the cluster.  Defaults to the API of this node (HORAE_PUBLIC_URL)")
+	flag.StringVar(&Configuration.QueueAssignment, "queue-assignment", QueueAssignmentRendezvous, "How queues are assigned to nodes: rendezvous or first (HORAE_QUEUE_ASSIGNMENT)")
+	flag.IntVar(&Configuration.DrainTimeout, "drain-timeout", 30, "How long (in seconds) a draining node waits for running tasks and actions to finish before releasing its queues (HORAE_DRAIN_TIMEOUT)")
+	AddStoreFlags(flag.CommandLine)
 	flag.Parse()
+	applyEnvironment()
+}
+
+// AddStoreFlags adds the flags required to connect to the store (as used by tools such as "horae simulate")
+func AddStoreFlags(flags *flag.FlagSet) {
+	flags.StringVar(&Configuration.ClusterName, "clustername", "default", "The horae cluster name (HORAE_CLUSTERNAME)")
+	flags.StringVar(&Configuration.CassandraAddress, "cassandra-address", "127.0.0.1", "Our cassandra address (HORAE_CASSANDRA_ADDRESS)")
+}
+
+// InitStoreConfig parses the store flags from the given arguments (see AddStoreFlags) and the environment
+func InitStoreConfig(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	applyEnvironment()
+	return nil
+}
+
+func applyEnvironment() {
 	if os.Getenv("HORAE_USE_STATIC_PORT") != "" {
 		value := strings.ToLower(os.Getenv("HORAE_USE_STATIC_PORT"))
 		if value == "true" {
@@ -46,4 +91,28 @@ func InitConfig() {
 	if os.Getenv("HORAE_ETCD_ADDRESS") != "" {
 		Configuration.ETCDAddress = os.Getenv("HORAE_ETCD_ADDRESS")
 	}
+	if os.Getenv("HORAE_TRACE_EXPORTER") != "" {
+		Configuration.TraceExporter = os.Getenv("HORAE_TRACE_EXPORTER")
+	}
+	if os.Getenv("HORAE_TRACE_ENDPOINT") != "" {
+		Configuration.TraceEndpoint = os.Getenv("HORAE_TRACE_ENDPOINT")
+	}
+	if os.Getenv("HORAE_API_ROUTING") != "" {
+		Configuration.APIRouting = os.Getenv("HORAE_API_ROUTING")
+	}
+	if os.Getenv("HORAE_QUEUE_ASSIGNMENT") != "" {
+		Configuration.QueueAssignment = os.Getenv("HORAE_QUEUE_ASSIGNMENT")
+	}
+	if os.Getenv("HORAE_DRAIN_TIMEOUT") != "" {
+		if timeout, err := strconv.Atoi(os.Getenv("HORAE_DRAIN_TIMEOUT")); err == nil {
+			Configuration.DrainTimeout = timeout
+		}
+	}
+	if os.Getenv("HORAE_PUBLIC_URL") != "" {
+		Configuration.PublicURL = os.Getenv("HORAE_PUBLIC_URL")
+	}
+	if Configuration.PublicURL != "" && !strings.HasSuffix(Configuration.PublicURL, "/") {
+		// action templates append paths such as v1/task/...
+		Configuration.PublicURL += "/"
+	}
 }
@@ -1,11 +1,17 @@
 package types
 
 import (
+	"errors"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gocql/gocql"
+	"time"
 )
 
-var session *gocql.Session
+var session *store
+
+// Version is the version of horae, reported by each node.  Set at build time with
+// -ldflags "-X github.com/kieranbroadfoot/horae/types.Version=<version>"
+var Version = "dev"
 
 // type defines the core data set of the running node
 type Node struct {
@@ -14,6 +20,9 @@ type Node struct {
 	Address   string
 	Port      string
 	MasterURI string
+	Version   string
+	Started   time.Time
+	Heartbeat time.Time // when the node last refreshed its key in etcd
 }
 
 func InitDAO(cassandraAddress string, clusterName string) {
@@ -24,6 +33,15 @@ func InitDAO(cassandraAddress string, clusterName string) {
 	if err != nil {
 		log.WithFields(log.Fields{"reason": err}).Fatal("Unable to init DB connection")
 	} else {
-		session = sess
+		session = &store{Session: sess, keyspace: cluster.Keyspace}
+	}
+}
+
+// PingStore checks that the store is reachable
+func PingStore() error {
+	if session == nil {
+		return errors.New("Not connected to the store")
 	}
+	var now gocql.UUID
+	return session.Query("select now() from system.local").Scan(&now)
 }
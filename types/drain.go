@@ -0,0 +1,65 @@
+package types
+
+import (
+	"sync"
+	"time"
+)
+
+// inFlight counts the tasks and actions being executed by this node so a draining node may wait for them to finish.
+// idle is closed whenever the count falls to zero.
+var inFlight = struct {
+	sync.Mutex
+	count int64
+	idle  chan bool
+}{idle: closedChannel()}
+
+func closedChannel() chan bool {
+	ch := make(chan bool)
+	close(ch)
+	return ch
+}
+
+func startWork() {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+	if inFlight.count == 0 {
+		inFlight.idle = make(chan bool)
+	}
+	inFlight.count++
+}
+
+func finishWork() {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+	inFlight.count--
+	if inFlight.count == 0 {
+		close(inFlight.idle)
+	}
+}
+
+// InFlight returns the number of tasks and actions being executed by this node
+func InFlight() int64 {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+	return inFlight.count
+}
+
+// WaitForInFlight waits until no tasks or actions are being executed or the deadline passes.  It returns false if work
+// remains at the deadline.
+func WaitForInFlight(deadline time.Time) bool {
+	inFlight.Lock()
+	idle := inFlight.idle
+	inFlight.Unlock()
+	clock := GetClock()
+	if !clock.Now().Before(deadline) {
+		return InFlight() == 0
+	}
+	timer := clock.NewTimer(deadline.Sub(clock.Now()))
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C():
+		return InFlight() == 0
+	}
+}
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitForInFlight(t *testing.T) {
+	clock := useFakeClock(t, time.Date(2026, time.October, 12, 9, 0, 0, 0, time.UTC))
+	deadline := clock.Now().Add(time.Minute)
+	if !WaitForInFlight(deadline) {
+		t.Error("expected no work to be waited for")
+	}
+
+	// the wait ends as the last work finishes
+	startWork()
+	startWork()
+	done := make(chan bool)
+	go func() { done <- WaitForInFlight(deadline) }()
+	clock.BlockUntil(1)
+	finishWork()
+	select {
+	case <-done:
+		t.Fatal("expected the wait to continue while work remains")
+	case <-time.After(50 * time.Millisecond):
+	}
+	finishWork()
+	if !<-done {
+		t.Error("expected the wait to succeed once the work finished")
+	}
+
+	// or at the deadline
+	startWork()
+	defer finishWork()
+	go func() { done <- WaitForInFlight(deadline) }()
+	clock.BlockUntil(1)
+	clock.AdvanceTo(deadline)
+	if <-done {
+		t.Error("expected the wait to fail at the deadline")
+	}
+	if WaitForInFlight(deadline) {
+		t.Error("expected the wait to fail once the deadline has passed")
+	}
+	if InFlight() != 1 {
+		t.Errorf("expected one piece of work in flight but was %d", InFlight())
+	}
+}
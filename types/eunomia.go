@@ -9,8 +9,16 @@ const (
 	EunomiaTask                      = "task"
 	EunomiaStoreUpdate               = "store_update"
 	EunomiaStoreDelete               = "store_delete"
-	EunomiaQueuesMonitor             = "action_queues_monitor" // monitor all queues for changes
-	EunomiaQueueMonitor              = "action_queue_monitor"  // monitor a specific queue for changes
+	EunomiaQueuesMonitor             = "action_queues_monitor"     // monitor all queues for changes
+	EunomiaQueueMonitor              = "action_queue_monitor"      // monitor a specific queue for changes
+	EunomiaEventsSubscribe           = "action_events_subscribe"   // receive events published across the cluster
+	EunomiaEventsUnsubscribe         = "action_events_unsubscribe" // stop receiving events
+	EunomiaHealthCheck               = "action_health_check"       // check that etcd is reachable
+	EunomiaOwnershipReport           = "action_ownership_report"   // report the queues owned by each node
+	EunomiaClusterReport             = "action_cluster_report"     // report the members of the cluster
+	EunomiaTransferLeader            = "action_transfer_leader"    // designate another node as master
+	EunomiaTransferQueue             = "action_transfer_queue"     // move a queue to another node
+	EunomiaElectionCheck             = "action_election_check"     // determine the master at once, e.g. when it is unreachable
 	EunomiaRequestBecomeMaster       = "state_master"
 	EunomiaRequestReleaseMaster      = "state_release"
 	EunomiaResponseBecameQueueMaster = "became_queue_master"
@@ -19,6 +27,7 @@ const (
 	EunomiaActionUpdate              = "eunomia_action_update"
 	EunomiaActionDelete              = "eunomia_action_delete"
 	EunomiaActionComplete            = "eunomia_action_complete"
+	EunomiaActionTransfer            = "eunomia_action_transfer"
 )
 
 type EunomiaRequest struct {
@@ -31,12 +40,19 @@ type EunomiaRequest struct {
 	QueueUUID               gocql.UUID // additional fields required for queue monitor setup
 	ChannelFromQueueManager chan EunomiaQueueRequest
 	ChannelToQueueManager   chan EunomiaResponse
+	ChannelToEvents         chan Event          // for event subscriptions
+	ChannelToHealth         chan error          // for health checks
+	ChannelToOwnership      chan QueueOwnership // for ownership reports
+	ChannelToCluster        chan ClusterStatus  // for cluster reports
+	Target                  gocql.UUID          // for transfers, the node to transfer to (if not zero)
+	ChannelToTransfer       chan TransferResult // for transfers
 }
 
 type EunomiaQueueRequest struct {
 	// used to signal a desire to become or release master ownership of a queue
 	Action    string
 	QueueUUID gocql.UUID
+	Done      chan bool // if set, closed once a release has completed
 }
 
 type EunomiaResponse struct {
@@ -0,0 +1,116 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventTaskStatus   = "task.status"        // a task changed status, e.g. Pending to Running
+	EventQueueOpened  = "queue.opened"       // a queue opened and is executing tasks
+	EventQueuePaused  = "queue.paused"       // the window of a queue is open but a queue containing it is closed
+	EventQueueClosed  = "queue.closed"       // the window of a queue closed
+	EventQueueOwner   = "queue.owner"        // a node became (or ceased to be) master of a queue
+	EventBackpressure = "queue.backpressure" // backpressure on a queue was raised or relieved
+
+	// events are held in etcd for long enough for every node to receive them
+	EventTTL = 60
+)
+
+// An Event records scheduler activity.  Events are published cluster-wide and may be streamed from any node.
+type Event struct {
+	ID     gocql.UUID  `json:"id,required" description:"The unique identifier of the event"`
+	Time   time.Time   `json:"time,required" description:"The time of the event"`
+	Type   string      `json:"type,required" description:"task.status, queue.opened, queue.paused, queue.closed, queue.owner or queue.backpressure"`
+	Node   gocql.UUID  `json:"node,required" description:"The node which published the event"`
+	Queue  *gocql.UUID `json:"queue,omitempty" description:"The UUID of the queue"`
+	Task   *gocql.UUID `json:"task,omitempty" description:"The UUID of the task"`
+	Paths  []string    `json:"paths,omitempty" description:"The paths of the queue"`
+	Tags   []string    `json:"tags,omitempty" description:"The tags of the task (for task events) or queue"`
+	Status string      `json:"status,omitempty" description:"The new task status, the ownership (master or slave) or the backpressure signal (raised or relieved)"`
+	Detail string      `json:"detail,omitempty" description:"Further details of the event, e.g. the previous status of a task"`
+}
+
+// An EventFilter selects the events sent to a stream.  Empty fields match every event.
+type EventFilter struct {
+	Queue      string
+	PathPrefix string
+	Tag        string
+	Selector   Selector
+	Task       string
+}
+
+// the publisher and recorder are set as eunomia and dike start, while other components may already be publishing
+var (
+	eventHooks     sync.RWMutex
+	eventPublisher func(Event)
+	eventRecorder  func(Event)
+)
+
+// SetEventPublisher sets the function used to publish events cluster-wide.  Until it is called events are dropped.
+func SetEventPublisher(publisher func(Event)) {
+	eventHooks.Lock()
+	defer eventHooks.Unlock()
+	eventPublisher = publisher
+}
+
+// SetEventRecorder sets a function called with every event before it is published.  Publishing may drop events (e.g.
+// when etcd falls behind) so anything which must not be lost, such as the deliveries of the event, is recorded here.
+func SetEventRecorder(recorder func(Event)) {
+	eventHooks.Lock()
+	defer eventHooks.Unlock()
+	eventRecorder = recorder
+}
+
+// PublishEvent records the event (see SetEventRecorder) and publishes it cluster-wide.  It does not wait for the event
+// to be published.
+func PublishEvent(event Event) {
+	eventHooks.RLock()
+	publisher, recorder := eventPublisher, eventRecorder
+	eventHooks.RUnlock()
+	event.ID = gocql.TimeUUID()
+	event.Time = GetClock().Now()
+	if recorder != nil {
+		recorder(event)
+	}
+	if publisher != nil {
+		publisher(event)
+	}
+}
+
+// NewQueueEvent returns an event of the given type for the queue
+func NewQueueEvent(eventType string, q Queue) Event {
+	uuid := q.UUID
+	return Event{Type: eventType, Queue: &uuid, Paths: q.OurPaths, Tags: q.OurTags}
+}
+
+func (f EventFilter) Matches(event Event) bool {
+	if f.Queue != "" && (event.Queue == nil || event.Queue.String() != f.Queue) {
+		return false
+	}
+	if f.Task != "" && (event.Task == nil || event.Task.String() != f.Task) {
+		return false
+	}
+	if f.Tag != "" && !isStringInSlice(f.Tag, event.Tags) {
+		return false
+	}
+	if !f.Selector.Matches(event.Tags) {
+		return false
+	}
+	if f.PathPrefix != "" {
+		matched := false
+		prefix := strings.TrimSuffix(f.PathPrefix, "/")
+		for _, p := range event.Paths {
+			if prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
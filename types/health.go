@@ -0,0 +1,37 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+	"time"
+)
+
+const (
+	NodeRoleMaster      = "master"
+	NodeRoleSlave       = "slave"
+	NodeRoleUnavailable = "unavailable"
+
+	HealthOK       = "ok"
+	HealthReady    = "ready"
+	HealthNotReady = "not ready"
+)
+
+// Health is the result of a liveness or readiness probe
+type Health struct {
+	Status string            `json:"status,required" description:"ok (alive), ready or not ready"`
+	Checks map[string]string `json:"checks,omitempty" description:"For readiness, the result of each check (store, coordinator, election and, while the node drains, drain)"`
+}
+
+// NodeStatus describes the node serving the request
+type NodeStatus struct {
+	UUID          gocql.UUID   `json:"uuid,required" description:"The unique identifier of the node, generated when it starts"`
+	Cluster       string       `json:"cluster,required" description:"The name of the cluster"`
+	Address       string       `json:"address,omitempty" description:"The address of the API of the node"`
+	Port          string       `json:"port,omitempty" description:"The port of the API of the node"`
+	Role          string       `json:"role,required" description:"master, slave or unavailable (the election has not settled)"`
+	Master        string       `json:"master,omitempty" description:"The URI of the current master"`
+	OwnedQueues   []gocql.UUID `json:"ownedQueues,required" description:"The queues of which the node is master"`
+	Draining      bool         `json:"draining" description:"True once the node has started to drain (see POST /v1/node/drain)"`
+	InFlight      int64        `json:"inFlight" description:"The number of tasks and actions the node is executing"`
+	Started       time.Time    `json:"started,required" description:"When the node started"`
+	UptimeSeconds int64        `json:"uptimeSeconds,required" description:"The number of seconds since the node started"`
+}
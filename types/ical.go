@@ -0,0 +1,175 @@
+package types
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// yearly events without a COUNT or UNTIL are expanded for this many years
+	defaultICSRepeats = 10
+	// and no event is expanded for more than this many
+	maxICSRepeats = 100
+)
+
+// ParseICS reads the events of an iCalendar (RFC 5545) file as calendar entries.  Only the dates of each event are used;
+// an all day event covers DTSTART up to (but not including) DTEND.  Recurring events are supported for yearly
+// recurrences (e.g. fixed date holidays) only.
+func ParseICS(reader io.Reader) ([]CalendarEntry, error) {
+	lines, err := unfoldICSLines(reader)
+	if err != nil {
+		return nil, err
+	}
+	entries := []CalendarEntry{}
+	var event map[string]string
+	for _, line := range lines {
+		name, value := splitICSLine(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = map[string]string{}
+		case name == "END" && value == "VEVENT" && event != nil:
+			eventEntries, err := icsEventToEntries(event)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, eventEntries...)
+			event = nil
+		case event != nil:
+			event[name] = value
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("No events found in calendar")
+	}
+	return entries, nil
+}
+
+// unfoldICSLines joins lines which have been folded (continuation lines begin with a space or tab)
+func unfoldICSLines(reader io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// splitICSLine returns the (upper case) property name, without any parameters, and its value
+func splitICSLine(line string) (string, string) {
+	idx := strings.Index(line, ":")
+	if idx < 0 {
+		return strings.ToUpper(line), ""
+	}
+	name := line[:idx]
+	if params := strings.Index(name, ";"); params >= 0 {
+		name = name[:params]
+	}
+	return strings.ToUpper(name), line[idx+1:]
+}
+
+func icsEventToEntries(event map[string]string) ([]CalendarEntry, error) {
+	summary := unescapeICSText(event["SUMMARY"])
+	start, allDay, err := parseICSDate(event["DTSTART"])
+	if err != nil {
+		return nil, errors.New("Invalid event \"" + summary + "\": " + err.Error())
+	}
+	end := start
+	if value, ok := event["DTEND"]; ok {
+		end, _, err = parseICSDate(value)
+		if err != nil {
+			return nil, errors.New("Invalid event \"" + summary + "\": " + err.Error())
+		}
+		if allDay || strings.HasSuffix(value, "T000000") || strings.HasSuffix(value, "T000000Z") {
+			// the end of an all day event (or one ending at midnight) is exclusive
+			end = addDaysTodate(end, -1)
+		}
+		if dateAfter(start, end) {
+			end = start
+		}
+	}
+	repeats := 1
+	if rule, ok := event["RRULE"]; ok {
+		repeats, err = icsYearlyRepeats(rule, start)
+		if err != nil {
+			return nil, errors.New("Invalid event \"" + summary + "\": " + err.Error())
+		}
+	}
+	entries := []CalendarEntry{}
+	for i := 0; i < repeats; i++ {
+		entries = append(entries, CalendarEntry{
+			// addDaysTodate normalises a 29/02 which falls outside a leap year
+			Start:   formatCalendarDate(addDaysTodate(date{day: start.day, month: start.month, year: start.year + i}, 0)),
+			End:     formatCalendarDate(addDaysTodate(date{day: end.day, month: end.month, year: end.year + i}, 0)),
+			Summary: summary,
+		})
+	}
+	return entries, nil
+}
+
+// parseICSDate parses a DATE (YYYYMMDD) or DATE-TIME (YYYYMMDDTHHMMSS) value.  Only the date is used.
+func parseICSDate(value string) (date, bool, error) {
+	if len(value) < 8 {
+		return date{}, false, errors.New("invalid date \"" + value + "\"")
+	}
+	parsed, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return date{}, false, errors.New("invalid date \"" + value + "\"")
+	}
+	return date{day: parsed.Day(), month: parsed.Month(), year: parsed.Year()}, len(value) == 8, nil
+}
+
+// icsYearlyRepeats returns the number of occurrences of a yearly recurrence rule
+func icsYearlyRepeats(rule string, start date) (int, error) {
+	parts := map[string]string{}
+	for _, part := range strings.Split(rule, ";") {
+		elements := strings.SplitN(part, "=", 2)
+		if len(elements) == 2 {
+			parts[strings.ToUpper(elements[0])] = elements[1]
+		}
+	}
+	if parts["FREQ"] != "YEARLY" || (parts["INTERVAL"] != "" && parts["INTERVAL"] != "1") || parts["BYDAY"] != "" || parts["BYMONTHDAY"] != "" || parts["BYMONTH"] != "" {
+		return 0, errors.New("only simple yearly recurrences are supported (\"" + rule + "\")")
+	}
+	if value, ok := parts["COUNT"]; ok {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 1 {
+			return 0, errors.New("invalid COUNT in \"" + rule + "\"")
+		}
+		if count > maxICSRepeats {
+			count = maxICSRepeats
+		}
+		return count, nil
+	}
+	if value, ok := parts["UNTIL"]; ok {
+		until, _, err := parseICSDate(value)
+		if err != nil {
+			return 0, err
+		}
+		repeats := until.year - start.year + 1
+		if dateAfter(date{day: start.day, month: start.month, year: until.year}, until) {
+			repeats--
+		}
+		if repeats < 1 {
+			repeats = 1
+		}
+		if repeats > maxICSRepeats {
+			repeats = maxICSRepeats
+		}
+		return repeats, nil
+	}
+	return defaultICSRepeats, nil
+}
+
+func unescapeICSText(text string) string {
+	replacer := strings.NewReplacer("\\n", " ", "\\N", " ", "\\,", ",", "\\;", ";", "\\\\", "\\")
+	return replacer.Replace(text)
+}
@@ -0,0 +1,147 @@
+package types
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// icsFixture wraps the properties of events in a calendar, with the CRLF line endings of RFC 5545
+func icsFixture(lines ...string) string {
+	all := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//horae//test//EN"}, lines...)
+	return strings.Join(append(all, "END:VCALENDAR"), "\r\n") + "\r\n"
+}
+
+func TestParseICS(t *testing.T) {
+	tests := []struct {
+		name     string
+		ics      string
+		expected []CalendarEntry
+	}{
+		{"all day event", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20261225",
+			"DTEND;VALUE=DATE:20261227",
+			"SUMMARY:Christmas",
+			"END:VEVENT",
+		), []CalendarEntry{{"25/12/2026", "26/12/2026", "Christmas"}}},
+		{"all day event without an end", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20260504",
+			"SUMMARY:Early May Bank Holiday",
+			"END:VEVENT",
+		), []CalendarEntry{{"04/05/2026", "04/05/2026", "Early May Bank Holiday"}}},
+		{"folded lines", icsFixture(
+			"BEGIN:VEVENT",
+			"DTST",
+			" ART;VALUE=DATE:20260504",
+			"SUMMARY:Early May",
+			"  Bank Holiday",
+			"END:VEVENT",
+		), []CalendarEntry{{"04/05/2026", "04/05/2026", "Early May Bank Holiday"}}},
+		{"folded with a tab", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20260831",
+			"SUMMARY:Summer",
+			"\t Bank Holiday",
+			"END:VEVENT",
+		), []CalendarEntry{{"31/08/2026", "31/08/2026", "Summer Bank Holiday"}}},
+		{"times with a timezone", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;TZID=Europe/London:20261013T090000",
+			"DTEND;TZID=Europe/London:20261014T170000",
+			"SUMMARY:Patching",
+			"END:VEVENT",
+		), []CalendarEntry{{"13/10/2026", "14/10/2026", "Patching"}}},
+		{"times in UTC ending at midnight", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART:20261013T220000Z",
+			"DTEND:20261014T000000Z",
+			"SUMMARY:Maintenance",
+			"END:VEVENT",
+		), []CalendarEntry{{"13/10/2026", "13/10/2026", "Maintenance"}}},
+		{"escaped text", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20261225",
+			"SUMMARY:Christmas\\, Boxing Day\\; closed",
+			"END:VEVENT",
+		), []CalendarEntry{{"25/12/2026", "25/12/2026", "Christmas, Boxing Day; closed"}}},
+		{"yearly event", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20280229",
+			"RRULE:FREQ=YEARLY;COUNT=2",
+			"SUMMARY:Leap day",
+			"END:VEVENT",
+		), []CalendarEntry{{"29/02/2028", "29/02/2028", "Leap day"}, {"01/03/2029", "01/03/2029", "Leap day"}}},
+		{"several events", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20261225",
+			"SUMMARY:Christmas",
+			"END:VEVENT",
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20261226",
+			"SUMMARY:Boxing Day",
+			"END:VEVENT",
+		), []CalendarEntry{{"25/12/2026", "25/12/2026", "Christmas"}, {"26/12/2026", "26/12/2026", "Boxing Day"}}},
+	}
+	for _, test := range tests {
+		entries, err := ParseICS(strings.NewReader(test.ics))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(entries, test.expected) {
+			t.Errorf("%s: expected %v but was %v", test.name, test.expected, entries)
+		}
+	}
+}
+
+func TestParseICSErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		ics      string
+		expected string
+	}{
+		{"not a calendar", "this is not a calendar", "No events found in calendar"},
+		{"no events", icsFixture(), "No events found in calendar"},
+		{"unterminated event", icsFixture("BEGIN:VEVENT", "DTSTART;VALUE=DATE:20261225"), "No events found in calendar"},
+		{"missing start", icsFixture(
+			"BEGIN:VEVENT",
+			"SUMMARY:Christmas",
+			"END:VEVENT",
+		), "Invalid event \"Christmas\": invalid date \"\""},
+		{"invalid start", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:2026-12-25",
+			"SUMMARY:Christmas",
+			"END:VEVENT",
+		), "Invalid event \"Christmas\": invalid date \"2026-12-25\""},
+		{"invalid end", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20261225",
+			"DTEND;VALUE=DATE:2026",
+			"SUMMARY:Christmas",
+			"END:VEVENT",
+		), "Invalid event \"Christmas\": invalid date \"2026\""},
+		{"unsupported recurrence", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20261013",
+			"RRULE:FREQ=MONTHLY;BYDAY=2TU",
+			"SUMMARY:Patching",
+			"END:VEVENT",
+		), "Invalid event \"Patching\": only simple yearly recurrences are supported (\"FREQ=MONTHLY;BYDAY=2TU\")"},
+		{"invalid count", icsFixture(
+			"BEGIN:VEVENT",
+			"DTSTART;VALUE=DATE:20261225",
+			"RRULE:FREQ=YEARLY;COUNT=0",
+			"SUMMARY:Christmas",
+			"END:VEVENT",
+		), "Invalid event \"Christmas\": invalid COUNT in \"FREQ=YEARLY;COUNT=0\""},
+	}
+	for _, test := range tests {
+		entries, err := ParseICS(strings.NewReader(test.ics))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%s: expected the error %q but was %v (%v)", test.name, test.expected, err, entries)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+	"path"
+	"sort"
+)
+
+// Effective returns the queue with the settings it inherits applied.  A queue which inherits takes its backpressure
+// settings, where they are not set, from the nearest ancestor queue and adds the tags of that queue to
+// its own.  The ancestor may itself inherit from its ancestors.
+//
+// Inherited tags are only part of the effective queue: they are not written to the tag index, so tag filters and
+// selectors match the queue's own tags only.
+func (q Queue) Effective() Queue {
+	return q.effective(map[gocql.UUID]bool{}, GetQueuesByPath)
+}
+
+// effective applies the settings inherited from the queues found by queuesAt, which returns the queues at a path
+func (q Queue) effective(seen map[gocql.UUID]bool, queuesAt func(string) []Queue) Queue {
+	seen[q.UUID] = true
+	if !q.Inherit {
+		return q
+	}
+	ancestor, ok := q.nearestAncestor(seen, queuesAt)
+	if !ok {
+		return q
+	}
+	ancestor = ancestor.effective(seen, queuesAt)
+	if q.BackPressureAction == nil || q.BackPressureAction.String() == "00000000-0000-0000-0000-000000000000" {
+		q.BackPressureAction = ancestor.BackPressureAction
+	}
+	if q.BackpressureDefinition == 0 {
+		q.BackpressureDefinition = ancestor.BackpressureDefinition
+	}
+	if q.BackpressureLowMark == 0 {
+		q.BackpressureLowMark = ancestor.BackpressureLowMark
+	}
+	if q.BackpressureMaxAge == 0 {
+		q.BackpressureMaxAge = ancestor.BackpressureMaxAge
+	}
+	if q.BackpressureInterval == 0 {
+		q.BackpressureInterval = ancestor.BackpressureInterval
+	}
+	tags := append([]string{}, q.OurTags...)
+	for _, tag := range ancestor.OurTags {
+		if !isStringInSlice(tag, tags) {
+			tags = append(tags, tag)
+		}
+	}
+	q.OurTags = tags
+	q.InheritedFrom = &ancestor.UUID
+	return q
+}
+
+// nearestAncestor finds the queue at the closest parent of any of the queue's paths, ignoring those already seen
+func (q Queue) nearestAncestor(seen map[gocql.UUID]bool, queuesAt func(string) []Queue) (Queue, bool) {
+	nearest := Queue{}
+	distance := -1
+	for _, ourPath := range q.OurPaths {
+		steps := 1
+		for thepath := path.Dir(path.Clean(ourPath)); distance < 0 || steps < distance; thepath = path.Dir(thepath) {
+			candidates := []Queue{}
+			for _, candidate := range queuesAt(thepath) {
+				if !seen[candidate.UUID] {
+					candidates = append(candidates, candidate)
+				}
+			}
+			if len(candidates) > 0 {
+				// if several queues share the path the choice must at least be stable
+				sort.Sort(queuesByName(candidates))
+				nearest = candidates[0]
+				distance = steps
+				break
+			}
+			if thepath == "/" || thepath == "." {
+				// a relative path ends at "." rather than the root
+				break
+			}
+			steps++
+		}
+	}
+	return nearest, distance > 0
+}
+
+type queuesByName []Queue
+
+func (q queuesByName) Len() int           { return len(q) }
+func (q queuesByName) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q queuesByName) Less(i, j int) bool { return q[i].Name < q[j].Name }
@@ -0,0 +1,114 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+	"reflect"
+	"testing"
+)
+
+// queuesAtPaths returns a lookup of the given queues by path, in place of GetQueuesByPath
+func queuesAtPaths(queues ...Queue) func(string) []Queue {
+	return func(thepath string) []Queue {
+		found := []Queue{}
+		for _, queue := range queues {
+			if isStringInSlice(thepath, queue.OurPaths) {
+				found = append(found, queue)
+			}
+		}
+		return found
+	}
+}
+
+func inheritingQueue(name string, paths ...string) Queue {
+	return Queue{UUID: gocql.TimeUUID(), Name: name, OurPaths: paths, Inherit: true}
+}
+
+func TestNearestAncestor(t *testing.T) {
+	root := inheritingQueue("root", "/a")
+	parent := inheritingQueue("parent", "/a/b")
+	other := inheritingQueue("other", "/x")
+	first := inheritingQueue("first", "/s")
+	second := inheritingQueue("second", "/s")
+	tests := []struct {
+		name     string
+		queue    Queue
+		queues   []Queue
+		expected string
+	}{
+		{"nearest wins", inheritingQueue("q", "/a/b/c/q"), []Queue{root, parent}, "parent"},
+		{"further up the path", inheritingQueue("q", "/a/z/q"), []Queue{root, parent}, "root"},
+		{"nearest of several paths", inheritingQueue("q", "/x/y/z/q", "/a/b/q"), []Queue{root, parent, other}, "parent"},
+		{"first of several paths at the same distance", inheritingQueue("q", "/x/q", "/a/q"), []Queue{root, other}, "other"},
+		{"queues sharing a path", inheritingQueue("q", "/s/q"), []Queue{second, first}, "first"},
+		{"no ancestor", inheritingQueue("q", "/elsewhere/q"), []Queue{root, parent}, ""},
+		{"without paths", inheritingQueue("q"), []Queue{root}, ""},
+		{"relative path", inheritingQueue("q", "a/b/q"), []Queue{root}, ""},
+	}
+	for _, test := range tests {
+		ancestor, ok := test.queue.nearestAncestor(map[gocql.UUID]bool{test.queue.UUID: true}, queuesAtPaths(append(test.queues, test.queue)...))
+		if ok != (test.expected != "") || ancestor.Name != test.expected {
+			t.Errorf("%s: expected the ancestor %q but was %q", test.name, test.expected, ancestor.Name)
+		}
+	}
+}
+
+func TestNearestAncestorIgnoresQueuesSeen(t *testing.T) {
+	// the queue is also at its own parent path
+	q := inheritingQueue("q", "/a", "/a/b/q")
+	root := inheritingQueue("root", "/")
+	ancestor, ok := q.nearestAncestor(map[gocql.UUID]bool{q.UUID: true}, queuesAtPaths(q, root))
+	if !ok || ancestor.Name != "root" {
+		t.Errorf("expected the queue to skip itself and inherit from root but was %q", ancestor.Name)
+	}
+	ancestor, ok = q.nearestAncestor(map[gocql.UUID]bool{q.UUID: true, root.UUID: true}, queuesAtPaths(q, root))
+	if ok {
+		t.Errorf("expected no ancestor once every queue has been seen but was %q", ancestor.Name)
+	}
+}
+
+func TestEffective(t *testing.T) {
+	action := gocql.TimeUUID()
+	root := Queue{UUID: gocql.TimeUUID(), Name: "root", OurPaths: []string{"/apps"}, OurTags: []string{"team:platform", "tier:1"}, BackPressureAction: &action, BackpressureDefinition: 100, BackpressureMaxAge: 600}
+	parent := inheritingQueue("parent", "/apps/payments")
+	parent.OurTags = []string{"team:payments"}
+	parent.BackpressureDefinition = 50
+	q := inheritingQueue("q", "/apps/payments/q")
+	q.OurTags = []string{"tier:1", "billing"}
+	q.BackpressureInterval = 10
+	lookup := queuesAtPaths(root, parent, q)
+
+	effective := q.effective(map[gocql.UUID]bool{}, lookup)
+	if effective.BackpressureDefinition != 50 || effective.BackpressureMaxAge != 600 || effective.BackpressureInterval != 10 || effective.BackPressureAction == nil || *effective.BackPressureAction != action {
+		t.Errorf("unexpected backpressure settings %+v", effective)
+	}
+	if expected := []string{"tier:1", "billing", "team:payments", "team:platform"}; !reflect.DeepEqual(effective.OurTags, expected) {
+		t.Errorf("expected the tags %v but were %v", expected, effective.OurTags)
+	}
+	if effective.InheritedFrom == nil || *effective.InheritedFrom != parent.UUID {
+		t.Errorf("expected the queue to inherit from its parent but was %v", effective.InheritedFrom)
+	}
+	if len(q.OurTags) != 2 {
+		t.Errorf("expected the queue itself to be unchanged but its tags were %v", q.OurTags)
+	}
+
+	// a queue which does not inherit keeps its own settings
+	q.Inherit = false
+	if effective := q.effective(map[gocql.UUID]bool{}, lookup); !reflect.DeepEqual(effective, q) {
+		t.Errorf("expected a queue which does not inherit to be unchanged but was %+v", effective)
+	}
+}
+
+func TestEffectiveWithCycle(t *testing.T) {
+	// each queue is at the parent path of the other, so b would inherit from a were a not already seen
+	a := inheritingQueue("a", "/x", "/y/a")
+	a.OurTags = []string{"a"}
+	b := inheritingQueue("b", "/y", "/x/b")
+	b.OurTags = []string{"b"}
+	effective := a.effective(map[gocql.UUID]bool{}, queuesAtPaths(a, b))
+	if effective.InheritedFrom == nil || *effective.InheritedFrom != b.UUID {
+		t.Errorf("expected a to inherit from b but was %v", effective.InheritedFrom)
+	}
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(effective.OurTags, expected) {
+		t.Errorf("expected the tags %v but were %v", expected, effective.OurTags)
+	}
+}
@@ -10,6 +10,8 @@ import (
 var mapper map[string]itemType
 var RE_TIME *regexp.Regexp
 var RE_CALENDAR *regexp.Regexp
+var RE_TIME_RANGE *regexp.Regexp
+var RE_NUMBER *regexp.Regexp
 
 func init() {
 	mapper = map[string]itemType{
@@ -69,14 +71,30 @@ func init() {
 		"october":   itemMonth,
 		"november":  itemMonth,
 		"december":  itemMonth,
+		"first":     itemOrdinal,
+		"second":    itemOrdinal,
+		"third":     itemOrdinal,
+		"fourth":    itemOrdinal,
+		"last":      itemOrdinal,
+		"for":       itemFor,
+		"from":      itemFrom,
+		"minute":    itemUnit,
+		"minutes":   itemUnit,
+		"min":       itemUnit,
+		"mins":      itemUnit,
+		"hour":      itemUnit,
+		"hours":     itemUnit,
 		"day":       itemRecurringByDayMonthYear,
 		"month":     itemRecurringByDayMonthYear,
 		"year":      itemRecurringByDayMonthYear,
 		"monthly":   itemRecurringByDayMonthYear,
 		"yearly":    itemRecurringByDayMonthYear,
+		"calendar":  itemCalendarRef,
 	}
-	RE_TIME = regexp.MustCompile("(?P<hour>\\d{1,2}):?(?P<minute>\\d{2})?\\s?(?P<mod>am|pm)?")
+	RE_TIME = regexp.MustCompile("(?P<hour>\\d{1,2})[:.]?(?P<minute>\\d{2})?\\s?(?P<mod>am|pm)?")
 	RE_CALENDAR = regexp.MustCompile("\\d+(st|nd|rd|th)$|\\d{1,2}(/|-)\\d{1,2}(\\d{1,4})$")
+	RE_NUMBER = regexp.MustCompile("^\\d+$")
+	RE_TIME_RANGE = regexp.MustCompile("^(\\d{1,2}(:\\d{2})?(am|pm)?)-(\\d{1,2}(:\\d{2})?(am|pm)?)$")
 }
 
 func lexer(input string) ([]item, error) {
@@ -85,6 +103,31 @@ func lexer(input string) ([]item, error) {
 	tokens := strings.Split(input, " ")
 	idx := 0
 	for idx < len(tokens) {
+		if output[len(output)-1].typ == itemEquals {
+			// the only assignment in the grammar is "timezone =".  IANA zone names are case sensitive so the
+			// original token is kept rather than the lower case version used for everything else
+			output = append(output, item{itemTimeZone, canonicalTimeZone(tokens[idx])})
+			idx++
+			continue
+		}
+		tokens[idx] = strings.ToLower(tokens[idx])
+		if output[len(output)-1].typ == itemCalendarRef {
+			// the name of a calendar may contain anything (e.g. "2015-freeze") so it is not matched against the grammar
+			output = append(output, item{itemCalendarName, tokens[idx]})
+			idx++
+			continue
+		}
+		if isTimeRange(tokens[idx]) {
+			// split "2-4am" into "2", "-" and "4am" so it is handled the same as "2 - 4am"
+			elements := strings.SplitN(tokens[idx], "-", 2)
+			tokens = append(tokens[:idx], append([]string{elements[0], "-", elements[1]}, tokens[idx+1:]...)...)
+		}
+		if RE_NUMBER.MatchString(tokens[idx]) && idx+1 < len(tokens) && mapper[strings.ToLower(tokens[idx+1])] == itemUnit {
+			// a number which qualifies a unit, e.g. "15 minutes", rather than a time
+			output = append(output, item{itemNumber, tokens[idx]})
+			idx++
+			continue
+		}
 		found := false
 		for key, val := range mapper {
 			if key == tokens[idx] {
@@ -122,7 +165,7 @@ func lexer(input string) ([]item, error) {
 }
 
 func normalize(content string) string {
-	content = strings.ToLower(content)
+	// note: case is normalised per token by the lexer
 	content = strings.TrimSpace(content)
 	r, _ := regexp.Compile("\\s+")
 	return r.ReplaceAllString(content, " ")
@@ -157,6 +200,11 @@ func isTime(potentialTime string) (string, string) {
 	return outputStr, additionalElement
 }
 
+func isTimeRange(potentialRange string) bool {
+	// a range such as 10-11 is ambiguous with a date so we require a modifier or minutes to be present
+	return RE_TIME_RANGE.MatchString(potentialRange) && strings.ContainsAny(potentialRange, ":m")
+}
+
 func isCalendar(potentialCalendar string) bool {
 	if RE_CALENDAR.MatchString(potentialCalendar) {
 		return true
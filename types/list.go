@@ -0,0 +1,521 @@
+package types
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gocql/gocql"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the number of rows in a page of a list endpoint unless a limit is given, and the largest page
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+
+	SortWhen     = "when"
+	SortPriority = "priority"
+	SortName     = "name"
+
+	// the most values in the in clause of a single query
+	maxInClause = 100
+	// the fewest rows read by a query of an unsorted list.  a query which ends part way through a partition is
+	// followed by one which reads the partition again, so this exceeds the rows of any partition (e.g. the statuses of
+	// a queue)
+	minListBatch = 10
+)
+
+// ListOptions selects a page of tasks, queues or actions (see ListTasks, ListQueues and ListActions).  Pages are
+// unsorted (in the order of the store) unless a sort is given, which requires a queue or a selector with a positive
+// requirement.
+type ListOptions struct {
+	Limit      int         // the number of rows in the page
+	Cursor     string      // the cursor returned with the previous page, if any
+	Statuses   []string    // any of these statuses
+	Queue      *gocql.UUID // tasks of this queue
+	Selector   string      // rows whose tags are selected (see ParseSelector)
+	Tag        string      // rows with exactly this tag
+	Since      time.Time   // tasks due at or after this time
+	Until      time.Time   // tasks due before this time
+	Prefix     string      // rows whose name (or, for actions, URI) starts with the prefix
+	Sort       string      // when, priority or name
+	Descending bool
+}
+
+// ListPage describes the page returned by a list
+type ListPage struct {
+	Next      string // the cursor of the next page, empty on the last page
+	Total     int64  // the number of matching rows, -1 if unknown
+	Estimated bool   // the total is an estimate
+}
+
+// A ListError reports invalid list options (as opposed to a failure of the store)
+type ListError string
+
+func (e ListError) Error() string {
+	return string(e)
+}
+
+// the fields of a row by which it may be filtered and sorted
+type listItem struct {
+	UUID     gocql.UUID
+	Status   string
+	Queue    *gocql.UUID
+	Name     string
+	When     time.Time
+	Priority uint64
+}
+
+// a listSource describes the table listed by a list endpoint
+type listSource struct {
+	table    string   // e.g. tasks
+	key      string   // the partition key of the table, e.g. task_uuid
+	object   string   // the type of object recorded against its tags
+	columns  string   // the columns needed to filter and sort
+	sorts    []string // the supported sorts
+	timed    bool     // rows may be filtered by queue and time range
+	statuses []string // the statuses listed unless others are given (all if empty)
+	// row returns a new row into which every row of a query is scanned (a binding scans into the struct it is first
+	// given) and item its filtering and sorting fields
+	row  func() interface{}
+	item func(row interface{}) listItem
+	// partitions, if set, returns the UUIDs of the rows of a queue with any of the statuses (all if none are given)
+	// from the tables partitioned by queue, so listing the rows of a queue does not scan the whole table
+	partitions func(queue gocql.UUID, statuses []string) ([]gocql.UUID, error)
+}
+
+// a listCursor records the last row of a page.  It is opaque to clients.
+type listCursor struct {
+	After      gocql.UUID `json:"after"`
+	Key        string     `json:"key,omitempty"` // the sort key of the row
+	Sort       string     `json:"sort,omitempty"`
+	Descending bool       `json:"desc,omitempty"`
+	Returned   int64      `json:"returned"` // the rows returned by this and previous pages
+	Scanned    int64      `json:"scanned"`  // the rows scanned to find them
+}
+
+func (c listCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.URLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (listCursor, error) {
+	var c listCursor
+	data, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return c, ListError("Invalid cursor")
+	}
+	return c, nil
+}
+
+// list returns the rows of the page selected by the options, in order.  The rows of a single queue are read from the
+// partitions of the queue, and rows chosen by a selector with a positive requirement from the tag index (see
+// listUUIDs).  Otherwise pages are read in token order, resuming after the last row of the previous page, so only the
+// rows of the page (and those filtered out on the way) are read.  Pages may only be sorted when their rows are read
+// from a queue or the tag index, as sorting any other list would read the whole table for every page.
+//
+// The cursor of an unsorted page records the last row rather than the paging state of the query as the driver does
+// not expose paging state.  Rows are listed in token order, which does not change as rows are added or removed, so
+// no row is listed twice or missed other than those added or removed meanwhile.
+func (s listSource) list(o ListOptions) ([]listItem, ListPage, error) {
+	page := ListPage{Total: -1}
+	if o.Limit <= 0 {
+		o.Limit = DefaultPageSize
+	} else if o.Limit > MaxPageSize {
+		o.Limit = MaxPageSize
+	}
+	if o.Sort != "" && !isStringInSlice(o.Sort, s.sorts) {
+		if len(s.sorts) == 0 {
+			return nil, page, ListError("The " + s.table + " may not be sorted")
+		}
+		return nil, page, ListError("Invalid sort: expected " + strings.Join(s.sorts, " or "))
+	}
+	if !s.timed && (o.Queue != nil || !o.Since.IsZero() || !o.Until.IsZero()) {
+		return nil, page, ListError("The " + s.table + " may not be filtered by queue or time")
+	}
+	if len(o.Statuses) == 0 {
+		o.Statuses = s.statuses
+	}
+	var cursor *listCursor
+	if o.Cursor != "" {
+		c, err := decodeCursor(o.Cursor)
+		if err != nil {
+			return nil, page, err
+		} else if c.Sort != o.Sort || c.Descending != o.Descending {
+			return nil, page, ListError("The cursor belongs to a different sort")
+		}
+		cursor = &c
+	}
+	selector, err := ParseSelector(o.Selector)
+	if err != nil {
+		return nil, page, ListError(err.Error())
+	}
+	if o.Tag != "" {
+		selector = selector.And(TagSelector(o.Tag))
+	}
+	if o.Queue != nil && s.partitions != nil {
+		uuids, err := s.partitions(*o.Queue, o.Statuses)
+		if err != nil {
+			return nil, page, err
+		}
+		return s.listUUIDs(o, cursor, selector, uuids)
+	}
+	if o.Sort != "" && !selector.indexed() {
+		if s.partitions != nil {
+			return nil, page, ListError("Sorting the " + s.table + " requires a queue or a selector with a positive requirement (e.g. env=prod)")
+		}
+		return nil, page, ListError("Sorting the " + s.table + " requires a selector with a positive requirement (e.g. env=prod)")
+	}
+	if uuids, ok, err := selector.candidates(s.object); err != nil {
+		return nil, page, err
+	} else if ok {
+		return s.listUUIDs(o, cursor, selector, uuids)
+	}
+	return s.listInOrder(o, cursor, selector)
+}
+
+// selected returns the items which match the options and whose tags are selected, in order
+func (s listSource) selected(o ListOptions, selector Selector, items []listItem) ([]listItem, error) {
+	matching := []listItem{}
+	for _, item := range items {
+		if o.matches(item) {
+			matching = append(matching, item)
+		}
+	}
+	if selector.Empty() || len(matching) == 0 {
+		return matching, nil
+	}
+	chosen, err := selector.filter(itemUUIDs(matching))
+	if err != nil {
+		return nil, err
+	}
+	selected := []listItem{}
+	for _, item := range matching {
+		if chosen[item.UUID] {
+			selected = append(selected, item)
+		}
+	}
+	return selected, nil
+}
+
+func (s listSource) listInOrder(o ListOptions, cursor *listCursor, selector Selector) ([]listItem, ListPage, error) {
+	page := ListPage{Total: -1}
+	var returned, scanned int64
+	if cursor != nil {
+		returned, scanned = cursor.Returned, cursor.Scanned
+	}
+	batch := o.Limit + 1
+	if batch < minListBatch {
+		batch = minListBatch
+	}
+	items := []listItem{}
+	exhausted := false
+	// the last row listed.  the other rows of its partition (e.g. the statuses of a queue) are not listed again
+	var listed gocql.UUID
+	// set when a query ends part way through a partition, which the next query then reads from its start
+	var partial *gocql.UUID
+	// one row more than the page is read to learn if there is a next page
+	for len(items) <= o.Limit && !exhausted {
+		var query *storeQuery
+		if partial != nil {
+			query = session.Query("select "+s.columns+" from "+s.table+" where token("+s.key+") >= token(?) limit ?", *partial, batch)
+		} else if cursor == nil {
+			query = session.Query("select "+s.columns+" from "+s.table+" limit ?", batch)
+		} else {
+			query = session.Query("select "+s.columns+" from "+s.table+" where token("+s.key+") > token(?) limit ?", cursor.After, batch)
+		}
+		bind := query.Binding()
+		row := s.row()
+		rows := []listItem{}
+		// the position of the first row of each partition in the batch
+		positions := map[gocql.UUID]int{}
+		for bind.Scan(row) {
+			item := s.item(row)
+			if _, ok := positions[item.UUID]; !ok {
+				positions[item.UUID] = len(rows)
+			}
+			rows = append(rows, item)
+		}
+		if err := bind.Close(); err != nil {
+			return nil, page, err
+		}
+		exhausted = len(rows) < batch
+		if len(rows) == 0 {
+			break
+		}
+		// the tags of the rows of the batch are read together
+		selected, err := s.selected(o, selector, rows)
+		if err != nil {
+			return nil, page, err
+		}
+		read := len(rows)
+		for _, item := range selected {
+			if item.UUID == listed {
+				continue
+			}
+			items = append(items, item)
+			listed = item.UUID
+			if len(items) > o.Limit {
+				// the rest of the batch is read again by the next page
+				read = positions[item.UUID] + 1
+				break
+			}
+		}
+		scanned += int64(read)
+		partial = &rows[len(rows)-1].UUID
+	}
+	if len(items) > o.Limit {
+		items = items[:o.Limit]
+		returned += int64(len(items))
+		next := listCursor{After: items[len(items)-1].UUID, Returned: returned, Scanned: scanned}
+		page.Next = next.encode()
+		// extrapolate from the rows matched so far to the size of the table
+		if rows, ok := estimateRows(s.table); ok && scanned > 0 {
+			page.Total = rows * returned / scanned
+			if page.Total <= returned {
+				page.Total = returned + 1
+			}
+			page.Estimated = true
+		}
+	} else {
+		page.Total = returned + int64(len(items))
+	}
+	return items, page, nil
+}
+
+// listUUIDs lists the rows with the given UUIDs (e.g. those read from the partitions of a queue or from the tag index)
+// by reading their filtering and sorting columns.  Unsorted pages are listed in order of UUID.
+func (s listSource) listUUIDs(o ListOptions, cursor *listCursor, selector Selector, uuids []gocql.UUID) ([]listItem, ListPage, error) {
+	page := ListPage{Total: -1}
+	var after *listItem
+	if cursor != nil {
+		item, err := cursorItem(o.Sort, *cursor)
+		if err != nil {
+			return nil, page, err
+		}
+		after = &item
+	}
+	kept := &listHeap{sort: o.Sort, descending: o.Descending}
+	var total int64
+	for _, chunk := range inChunks(uuids) {
+		placeholders, values := inClause(chunk)
+		bind := session.Query("select "+s.columns+" from "+s.table+" where "+s.key+" in ("+placeholders+")", values...).Binding()
+		row := s.row()
+		rows := []listItem{}
+		for bind.Scan(row) {
+			rows = append(rows, s.item(row))
+		}
+		if err := bind.Close(); err != nil {
+			return nil, page, err
+		}
+		selected, err := s.selected(o, selector, rows)
+		if err != nil {
+			return nil, page, err
+		}
+		// the other rows of a partition (e.g. the statuses of a queue) are not listed again
+		var listed gocql.UUID
+		for _, item := range selected {
+			if item.UUID == listed {
+				continue
+			}
+			listed = item.UUID
+			total++
+			kept.keep(item, after, o.Limit)
+		}
+	}
+	items, page := kept.page(o, total)
+	return items, page, nil
+}
+
+func (o ListOptions) matches(item listItem) bool {
+	if len(o.Statuses) > 0 && !isStringInSlice(item.Status, o.Statuses) {
+		return false
+	}
+	if o.Queue != nil && (item.Queue == nil || *item.Queue != *o.Queue) {
+		return false
+	}
+	if !o.Since.IsZero() && item.When.Before(o.Since) {
+		return false
+	}
+	if !o.Until.IsZero() && !item.When.Before(o.Until) {
+		return false
+	}
+	return strings.HasPrefix(item.Name, o.Prefix)
+}
+
+// sortKey returns the value by which the item is sorted, as recorded in a cursor
+func sortKey(field string, item listItem) string {
+	switch field {
+	case SortWhen:
+		return item.When.Format(time.RFC3339Nano)
+	case SortPriority:
+		return strconv.FormatUint(item.Priority, 10)
+	}
+	return item.Name
+}
+
+// cursorItem returns the last row of the previous page as recorded in the cursor
+func cursorItem(field string, cursor listCursor) (listItem, error) {
+	item := listItem{UUID: cursor.After, Name: cursor.Key}
+	var err error
+	switch field {
+	case SortWhen:
+		item.When, err = time.Parse(time.RFC3339Nano, cursor.Key)
+	case SortPriority:
+		item.Priority, err = strconv.ParseUint(cursor.Key, 10, 64)
+	}
+	if err != nil {
+		return item, ListError("Invalid cursor")
+	}
+	return item, nil
+}
+
+// compareItems orders rows by the sort field and then by UUID, so rows with the same value are listed in a stable order
+func compareItems(field string, descending bool, a listItem, b listItem) int {
+	result := 0
+	switch field {
+	case SortWhen:
+		if a.When.Before(b.When) {
+			result = -1
+		} else if a.When.After(b.When) {
+			result = 1
+		}
+	case SortPriority:
+		if a.Priority < b.Priority {
+			result = -1
+		} else if a.Priority > b.Priority {
+			result = 1
+		}
+	case SortName:
+		result = compareStrings(a.Name, b.Name)
+	}
+	if result == 0 {
+		result = compareStrings(a.UUID.String(), b.UUID.String())
+	}
+	if descending {
+		return -result
+	}
+	return result
+}
+
+func compareStrings(a string, b string) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// a listHeap keeps the first rows in sort order, with the last of them at the top
+type listHeap struct {
+	items      []listItem
+	sort       string
+	descending bool
+}
+
+func (h *listHeap) Len() int      { return len(h.items) }
+func (h *listHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *listHeap) Less(i, j int) bool {
+	return compareItems(h.sort, h.descending, h.items[i], h.items[j]) > 0
+}
+func (h *listHeap) Push(x interface{}) { h.items = append(h.items, x.(listItem)) }
+func (h *listHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// page returns the rows of the page in order, and the page of which total rows matched
+func (h *listHeap) page(o ListOptions, total int64) ([]listItem, ListPage) {
+	sort.Sort(sort.Reverse(h))
+	items := h.items
+	page := ListPage{Total: total}
+	if len(items) > o.Limit {
+		items = items[:o.Limit]
+		last := items[len(items)-1]
+		next := listCursor{After: last.UUID, Sort: o.Sort, Descending: o.Descending}
+		if o.Sort != "" {
+			next.Key = sortKey(o.Sort, last)
+		}
+		page.Next = next.encode()
+	}
+	return items, page
+}
+
+// keep adds the item if it follows the last row of the previous page (if any), keeping at most one row more than the
+// page
+func (h *listHeap) keep(item listItem, after *listItem, limit int) {
+	if after != nil && compareItems(h.sort, h.descending, item, *after) <= 0 {
+		return
+	}
+	heap.Push(h, item)
+	if h.Len() > limit+1 {
+		heap.Pop(h)
+	}
+}
+
+// estimateRows returns the number of partitions of the table as estimated by Cassandra (2.1.5 onwards)
+func estimateRows(table string) (int64, bool) {
+	var count, total int64
+	found := false
+	iteration := session.Query("select partitions_count from system.size_estimates where keyspace_name = ? and table_name = ?", session.keyspace, table).Iter()
+	for iteration.Scan(&count) {
+		total += count
+		found = true
+	}
+	return total, found && iteration.Close() == nil
+}
+
+// loadTags returns the tags of each of the objects, using one query per maxInClause objects rather than one per object
+func loadTags(uuids []gocql.UUID) (map[gocql.UUID][]string, error) {
+	tags := map[gocql.UUID][]string{}
+	for _, chunk := range inChunks(uuids) {
+		var id gocql.UUID
+		var tag string
+		placeholders, values := inClause(chunk)
+		iteration := session.Query("select object_uuid, tag from tags where object_uuid in ("+placeholders+")", values...).Iter()
+		for iteration.Scan(&id, &tag) {
+			tags[id] = append(tags[id], tag)
+		}
+		if err := iteration.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+func itemUUIDs(items []listItem) []gocql.UUID {
+	uuids := []gocql.UUID{}
+	for _, item := range items {
+		uuids = append(uuids, item.UUID)
+	}
+	return uuids
+}
+
+// inChunks splits the uuids into chunks small enough for an in clause
+func inChunks(uuids []gocql.UUID) [][]gocql.UUID {
+	chunks := [][]gocql.UUID{}
+	for len(uuids) > maxInClause {
+		chunks = append(chunks, uuids[:maxInClause])
+		uuids = uuids[maxInClause:]
+	}
+	if len(uuids) > 0 {
+		chunks = append(chunks, uuids)
+	}
+	return chunks
+}
+
+// inClause returns the placeholders and values of an in clause for the uuids
+func inClause(uuids []gocql.UUID) (string, []interface{}) {
+	placeholders := []string{}
+	values := []interface{}{}
+	for _, uuid := range uuids {
+		placeholders = append(placeholders, "?")
+		values = append(values, uuid)
+	}
+	return strings.Join(placeholders, ", "), values
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+	"testing"
+	"time"
+)
+
+// pageThrough lists the items a page at a time as listUUIDs does, following the cursor of each page
+func pageThrough(t *testing.T, items []listItem, o ListOptions) []listItem {
+	listed := []listItem{}
+	for pages := 0; pages < len(items)+1; pages++ {
+		var after *listItem
+		if o.Cursor != "" {
+			cursor, err := decodeCursor(o.Cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			item, err := cursorItem(o.Sort, cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after = &item
+		}
+		kept := &listHeap{sort: o.Sort, descending: o.Descending}
+		for _, item := range items {
+			kept.keep(item, after, o.Limit)
+		}
+		page, info := kept.page(o, int64(len(items)))
+		if len(page) > o.Limit {
+			t.Fatalf("expected at most %d rows but found %d", o.Limit, len(page))
+		}
+		listed = append(listed, page...)
+		if info.Next == "" {
+			return listed
+		}
+		o.Cursor = info.Next
+	}
+	t.Fatal("paging did not finish")
+	return nil
+}
+
+func TestListPagesInSortOrder(t *testing.T) {
+	base := time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC)
+	items := []listItem{}
+	for i := 0; i < 25; i++ {
+		// several rows share each time and priority so rows are also ordered by UUID
+		items = append(items, listItem{UUID: gocql.TimeUUID(), Name: string(rune('a' + i%7)), When: base.Add(time.Duration(i%5) * time.Hour), Priority: uint64(i % 3)})
+	}
+	for _, sort := range []string{"", SortWhen, SortPriority, SortName} {
+		for _, descending := range []bool{false, true} {
+			listed := pageThrough(t, items, ListOptions{Limit: 4, Sort: sort, Descending: descending})
+			if len(listed) != len(items) {
+				t.Errorf("sort %q: expected %d rows but listed %d", sort, len(items), len(listed))
+				continue
+			}
+			seen := map[gocql.UUID]bool{}
+			for idx, item := range listed {
+				if seen[item.UUID] {
+					t.Errorf("sort %q: row %v listed twice", sort, item.UUID)
+				}
+				seen[item.UUID] = true
+				if idx > 0 && compareItems(sort, descending, listed[idx-1], item) >= 0 {
+					t.Errorf("sort %q: rows %d and %d out of order", sort, idx-1, idx)
+				}
+			}
+		}
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	cursor := listCursor{After: gocql.TimeUUID(), Key: "2026-10-19T09:00:00Z", Sort: SortWhen, Descending: true, Returned: 200, Scanned: 1234}
+	decoded, err := decodeCursor(cursor.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != cursor {
+		t.Errorf("expected %+v but decoded %+v", cursor, decoded)
+	}
+	item, err := cursorItem(SortWhen, decoded)
+	if err != nil || item.UUID != cursor.After || !item.When.Equal(time.Date(2026, time.October, 19, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the row of the cursor but was %+v (%v)", item, err)
+	}
+
+	for _, invalid := range []string{"not base64!", "bm90IGpzb24=", listCursor{Key: "soon", Sort: SortWhen}.encode(), listCursor{Key: "-1", Sort: SortPriority}.encode()} {
+		c, err := decodeCursor(invalid)
+		if err == nil {
+			_, err = cursorItem(c.Sort, c)
+		}
+		if _, ok := err.(ListError); !ok || err.Error() != "Invalid cursor" {
+			t.Errorf("%q: expected an invalid cursor but was %v", invalid, err)
+		}
+	}
+}
+
+func TestListRejectsOptionsBeforeReading(t *testing.T) {
+	queue := gocql.TimeUUID()
+	tests := []struct {
+		source   listSource
+		options  ListOptions
+		expected string
+	}{
+		{taskSource, ListOptions{Sort: SortName, Cursor: listCursor{Sort: SortWhen}.encode()}, "The cursor belongs to a different sort"},
+		{taskSource, ListOptions{Sort: SortWhen, Descending: true, Queue: &queue, Cursor: listCursor{Sort: SortWhen}.encode()}, "The cursor belongs to a different sort"},
+		{taskSource, ListOptions{Cursor: listCursor{Sort: SortName}.encode()}, "The cursor belongs to a different sort"},
+		{taskSource, ListOptions{Cursor: "not base64!"}, "Invalid cursor"},
+		{taskSource, ListOptions{Sort: "size"}, "Invalid sort: expected when or priority or name"},
+		{taskSource, ListOptions{Sort: SortWhen}, "Sorting the tasks requires a queue or a selector with a positive requirement (e.g. env=prod)"},
+		{taskSource, ListOptions{Sort: SortWhen, Selector: "!deprecated"}, "Sorting the tasks requires a queue or a selector with a positive requirement (e.g. env=prod)"},
+		{queueSource, ListOptions{Sort: SortName}, "Sorting the queues requires a selector with a positive requirement (e.g. env=prod)"},
+		{queueSource, ListOptions{Queue: &queue}, "The queues may not be filtered by queue or time"},
+		{actionSource, ListOptions{Sort: SortName}, "The actions may not be sorted"},
+		{actionSource, ListOptions{Selector: "env in prod"}, "Invalid selector: expected ( after in"},
+	}
+	for _, test := range tests {
+		_, _, err := test.source.list(test.options)
+		if _, ok := err.(ListError); !ok || err.Error() != test.expected {
+			t.Errorf("%+v: expected %q but was %v", test.options, test.expected, err)
+		}
+	}
+}
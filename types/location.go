@@ -0,0 +1,79 @@
+package types
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// loadLocation resolves the timezone of a window definition.  IANA names (e.g. Europe/London) are loaded from the
+// zoneinfo database and so follow daylight saving transitions.  Anything else is treated as an abbreviation (e.g. GMT
+// or GMT+3) which is parsed as a fixed offset, as horae has always done.
+func loadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+	if location, err := time.LoadLocation(timezone); err == nil {
+		return location, nil
+	}
+	if !strings.Contains(timezone, "/") && isTimeZone(timezone) {
+		parsed, err := time.Parse("15:04 MST", "00:00 "+strings.ToUpper(timezone))
+		if err == nil {
+			return parsed.Location(), nil
+		}
+	}
+	return nil, errors.New("Unknown timezone: " + timezone)
+}
+
+// canonicalTimeZone returns the zone name as it should be stored in the window.  The window input is case insensitive
+// but IANA names are not so try the name as given and then as a capitalised path (europe/london -> Europe/London)
+// before falling back to an upper case abbreviation.
+func canonicalTimeZone(timezone string) string {
+	if _, err := time.LoadLocation(timezone); err == nil {
+		return timezone
+	}
+	if strings.Contains(timezone, "/") {
+		capitalised := []byte(strings.ToLower(timezone))
+		for idx := range capitalised {
+			if (idx == 0 || strings.IndexByte("/_-", capitalised[idx-1]) >= 0) && capitalised[idx] >= 'a' && capitalised[idx] <= 'z' {
+				capitalised[idx] -= 'a' - 'A'
+			}
+		}
+		if _, err := time.LoadLocation(string(capitalised)); err == nil {
+			return string(capitalised)
+		}
+		return timezone
+	}
+	return strings.ToUpper(timezone)
+}
+
+// timeInLocation returns the instant at which the wall clock in location reads hour:minute on the given date.
+//
+// Daylight saving transitions make this ambiguous so the behaviour is fixed as follows:
+//   - a local time which does not exist (skipped by a forward transition) is moved forward by the length of the
+//     transition, e.g. 01:30 on the last sunday of march in Europe/London becomes 02:30 BST
+//   - a local time which occurs twice (repeated by a backward transition) resolves to the first occurrence, e.g.
+//     01:30 on the last sunday of october in Europe/London is 01:30 BST rather than 01:30 GMT
+func timeInLocation(d date, hour int, minute int, location *time.Location) time.Time {
+	wall := time.Date(d.year, d.month, d.day, hour, minute, 0, 0, time.UTC)
+	// the offsets in force either side of any transition on this date
+	_, offsetBefore := wall.Add(-24 * time.Hour).In(location).Zone()
+	_, offsetAfter := wall.Add(24 * time.Hour).In(location).Zone()
+	first := wall.Add(-time.Duration(offsetBefore) * time.Second).In(location)
+	second := wall.Add(-time.Duration(offsetAfter) * time.Second).In(location)
+	firstValid := first.Hour() == hour && first.Minute() == minute
+	secondValid := second.Hour() == hour && second.Minute() == minute
+	switch {
+	case firstValid && secondValid:
+		if second.Before(first) {
+			return second
+		}
+		return first
+	case firstValid:
+		return first
+	case secondValid:
+		return second
+	}
+	// the local time was skipped.  using the offset from before the transition moves us forward by the gap
+	return first
+}
@@ -0,0 +1,84 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeInLocationAcrossDaylightSaving(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		day      date
+		hour     int
+		minute   int
+		expected time.Time // in UTC
+	}{
+		// Europe/London: 01:00 GMT -> 02:00 BST on 29/03/2026 and 02:00 BST -> 01:00 GMT on 25/10/2026
+		{"london before spring transition", "Europe/London", date{29, time.March, 2026}, 0, 30, time.Date(2026, time.March, 29, 0, 30, 0, 0, time.UTC)},
+		{"london skipped hour", "Europe/London", date{29, time.March, 2026}, 1, 30, time.Date(2026, time.March, 29, 1, 30, 0, 0, time.UTC)},
+		{"london first time after spring transition", "Europe/London", date{29, time.March, 2026}, 2, 0, time.Date(2026, time.March, 29, 1, 0, 0, 0, time.UTC)},
+		{"london after spring transition", "Europe/London", date{29, time.March, 2026}, 12, 0, time.Date(2026, time.March, 29, 11, 0, 0, 0, time.UTC)},
+		{"london before autumn transition", "Europe/London", date{25, time.October, 2026}, 0, 30, time.Date(2026, time.October, 24, 23, 30, 0, 0, time.UTC)},
+		{"london repeated hour", "Europe/London", date{25, time.October, 2026}, 1, 30, time.Date(2026, time.October, 25, 0, 30, 0, 0, time.UTC)},
+		{"london after autumn transition", "Europe/London", date{25, time.October, 2026}, 2, 0, time.Date(2026, time.October, 25, 2, 0, 0, 0, time.UTC)},
+		// America/New_York: 02:00 EST -> 03:00 EDT on 08/03/2026 and 02:00 EDT -> 01:00 EST on 01/11/2026
+		{"new york before spring transition", "America/New_York", date{8, time.March, 2026}, 1, 30, time.Date(2026, time.March, 8, 6, 30, 0, 0, time.UTC)},
+		{"new york skipped hour", "America/New_York", date{8, time.March, 2026}, 2, 30, time.Date(2026, time.March, 8, 7, 30, 0, 0, time.UTC)},
+		{"new york after spring transition", "America/New_York", date{8, time.March, 2026}, 3, 0, time.Date(2026, time.March, 8, 7, 0, 0, 0, time.UTC)},
+		{"new york before autumn transition", "America/New_York", date{1, time.November, 2026}, 0, 30, time.Date(2026, time.November, 1, 4, 30, 0, 0, time.UTC)},
+		{"new york repeated hour", "America/New_York", date{1, time.November, 2026}, 1, 30, time.Date(2026, time.November, 1, 5, 30, 0, 0, time.UTC)},
+		{"new york after autumn transition", "America/New_York", date{1, time.November, 2026}, 12, 0, time.Date(2026, time.November, 1, 17, 0, 0, 0, time.UTC)},
+		// fixed offsets have no transitions
+		{"utc", "", date{29, time.March, 2026}, 1, 30, time.Date(2026, time.March, 29, 1, 30, 0, 0, time.UTC)},
+		{"eastern standard time in summer", "EST", date{1, time.July, 2026}, 9, 0, time.Date(2026, time.July, 1, 14, 0, 0, 0, time.UTC)},
+		{"gmt with offset", "GMT+3", date{1, time.July, 2026}, 9, 0, time.Date(2026, time.July, 1, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		location, err := loadLocation(canonicalTimeZone(test.timezone))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		actual := timeInLocation(test.day, test.hour, test.minute, location)
+		if !actual.Equal(test.expected) {
+			t.Errorf("%s: expected %v but was %v", test.name, test.expected, actual.UTC())
+		}
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	tests := []struct {
+		timezone string
+		offset   int // in seconds, on 01/01/2026
+		valid    bool
+	}{
+		{"Europe/London", 0, true},
+		{"europe/london", 0, true},
+		{"America/New_York", -5 * 3600, true},
+		{"america/new_york", -5 * 3600, true},
+		{"EST", -5 * 3600, true},
+		{"est", -5 * 3600, true},
+		{"GMT", 0, true},
+		{"GMT+3", 3 * 3600, true},
+		{"gmt-2", -2 * 3600, true},
+		{"Nowhere/Place", 0, false},
+		{"XY", 0, false},
+	}
+	for _, test := range tests {
+		location, err := loadLocation(canonicalTimeZone(test.timezone))
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.timezone)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.timezone, err)
+			continue
+		}
+		if _, offset := time.Date(2026, time.January, 1, 12, 0, 0, 0, location).Zone(); offset != test.offset {
+			t.Errorf("%s: expected an offset of %d but was %d", test.timezone, test.offset, offset)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package types
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// DefaultBuckets are the upper bounds (in seconds) of the buckets of the latency histograms
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// The metrics of this node, exposed in the Prometheus text format by GET /metrics.  Queues are labelled by UUID.
+var (
+	MetricTaskExecutions    = NewCounter("horae_task_executions_total", "Tasks which finished executing, by queue and outcome (the final task status)", "queue", "outcome")
+	MetricActionDuration    = NewHistogram("horae_action_duration_seconds", "The time taken to call actions, by the host of the action uri", DefaultBuckets, "host")
+	MetricQueueTasks        = NewGauge("horae_queue_tasks", "Tasks waiting in (pending) or executing on (running) the queues owned by this node", "queue", "status")
+	MetricQueueOpen         = NewGauge("horae_queue_open", "1 if the queue is open (its window is open and it is contained), reported by the owner of the queue", "queue")
+	MetricQueuesOwned       = NewGauge("horae_queues_owned", "The number of queues owned by the node", "node")
+	MetricWindowTransitions = NewCounter("horae_window_transitions_total", "The number of times the window of operation of a queue opened or closed", "queue", "state")
+	MetricEtcdDuration      = NewHistogram("horae_etcd_request_duration_seconds", "The time taken by etcd requests, by operation", DefaultBuckets, "operation")
+	MetricEtcdErrors        = NewCounter("horae_etcd_errors_total", "etcd requests which failed, by operation", "operation")
+	MetricCassandraDuration = NewHistogram("horae_cassandra_query_duration_seconds", "The time taken by Cassandra queries, by operation and table", DefaultBuckets, "operation", "table")
+	MetricCassandraErrors   = NewCounter("horae_cassandra_errors_total", "Cassandra queries which failed, by operation and table", "operation", "table")
+	MetricAPIRequests       = NewCounter("horae_api_requests_total", "API requests, by method, route and response status", "method", "route", "status")
+)
+
+var metrics = struct {
+	mutex    sync.Mutex
+	families []*metricFamily
+}{}
+
+type metricFamily struct {
+	mutex   sync.Mutex
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+}
+
+// A Counter is a value which only increases, e.g. a number of requests
+type Counter struct {
+	family *metricFamily
+}
+
+// A Gauge is a value which may go up and down, e.g. the depth of a queue
+type Gauge struct {
+	family *metricFamily
+}
+
+// A Histogram counts observations, e.g. latencies, in buckets
+type Histogram struct {
+	family *metricFamily
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{family: newMetricFamily(name, help, metricCounter, nil, labels)}
+}
+
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{family: newMetricFamily(name, help, metricGauge, nil, labels)}
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{family: newMetricFamily(name, help, metricHistogram, buckets, labels)}
+}
+
+func newMetricFamily(name string, help string, kind string, buckets []float64, labels []string) *metricFamily {
+	family := &metricFamily{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: map[string]*metricSeries{}}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.families = append(metrics.families, family)
+	return family
+}
+
+// Inc adds one to the counter with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.family.update(labelValues, func(s *metricSeries) { s.value += value })
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *metricSeries) { s.value = value })
+}
+
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *metricSeries) { s.value += value })
+}
+
+// Delete removes the gauge with the given label values, e.g. once a queue is deleted
+func (g *Gauge) Delete(labelValues ...string) {
+	g.family.mutex.Lock()
+	defer g.family.mutex.Unlock()
+	delete(g.family.series, seriesKey(labelValues))
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.family.update(labelValues, func(s *metricSeries) {
+		for idx, bound := range h.family.buckets {
+			if value <= bound {
+				s.counts[idx]++
+			}
+		}
+		s.value += value
+		s.count++
+	})
+}
+
+// ObserveSince records the time elapsed since start, in seconds
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (f *metricFamily) update(labelValues []string, change func(*metricSeries)) {
+	if len(labelValues) != len(f.labels) {
+		panic("metric " + f.name + " expects labels " + strings.Join(f.labels, ", "))
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	key := seriesKey(labelValues)
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: append([]string{}, labelValues...), counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	change(s)
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// WriteMetrics writes every metric in the Prometheus text exposition format (version 0.0.4)
+func WriteMetrics(w io.Writer) error {
+	metrics.mutex.Lock()
+	families := append([]*metricFamily{}, metrics.families...)
+	metrics.mutex.Unlock()
+	buffered := bufio.NewWriter(w)
+	for _, family := range families {
+		family.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+func (f *metricFamily) write(w *bufio.Writer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	w.WriteString("# HELP " + f.name + " " + strings.Replace(strings.Replace(f.help, "\\", "\\\\", -1), "\n", "\\n", -1) + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+	keys := []string{}
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != metricHistogram {
+			writeSample(w, f.name, f.labels, s.labelValues, "", "", s.value)
+			continue
+		}
+		for idx, bound := range f.buckets {
+			writeSample(w, f.name+"_bucket", f.labels, s.labelValues, "le", formatMetricValue(bound), float64(s.counts[idx]))
+		}
+		writeSample(w, f.name+"_bucket", f.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(w, f.name+"_sum", f.labels, s.labelValues, "", "", s.value)
+		writeSample(w, f.name+"_count", f.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels []string, labelValues []string, extraLabel string, extraValue string, value float64) {
+	w.WriteString(name)
+	pairs := []string{}
+	for idx, label := range labels {
+		pairs = append(pairs, label+"=\""+escapeLabelValue(labelValues[idx])+"\"")
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, extraLabel+"=\""+extraValue+"\"")
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatMetricValue(value) + "\n")
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, "\\", "\\\\", -1)
+	value = strings.Replace(value, "\"", "\\\"", -1)
+	return strings.Replace(value, "\n", "\\n", -1)
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	} else if math.IsInf(value, -1) {
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,86 @@
+package types
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// useMetrics starts the test without any registered metrics, restoring those of the node once the test completes
+func useMetrics(t *testing.T) {
+	metrics.mutex.Lock()
+	previous := metrics.families
+	metrics.families = nil
+	metrics.mutex.Unlock()
+	t.Cleanup(func() {
+		metrics.mutex.Lock()
+		metrics.families = previous
+		metrics.mutex.Unlock()
+	})
+}
+
+func TestWriteMetrics(t *testing.T) {
+	useMetrics(t)
+	requests := NewCounter("test_requests_total", "Requests, by method and path", "method", "path")
+	depth := NewGauge("test_depth", "The depth of the queue\nwith a \\ in the help", "queue")
+	latency := NewHistogram("test_latency_seconds", "Latency", []float64{0.1, 0.5, 1, 2.5}, "host")
+	NewCounter("test_unused_total", "A counter without any samples")
+	uptime := NewGauge("test_uptime_seconds", "A gauge without labels")
+
+	requests.Inc("GET", "/v1/queue")
+	requests.Add(2, "GET", "/v1/queue")
+	requests.Inc("PUT", "/v1/\"quoted\"\\path\nnext")
+	depth.Set(7, "a")
+	depth.Set(3, "b")
+	depth.Add(-1, "b")
+	depth.Set(1, "deleted")
+	depth.Delete("deleted")
+	for _, value := range []float64{0.25, 0.5, 20} {
+		latency.Observe(value, "example.com")
+	}
+	uptime.Set(1.5)
+
+	expected := strings.Join([]string{
+		`# HELP test_requests_total Requests, by method and path`,
+		`# TYPE test_requests_total counter`,
+		`test_requests_total{method="GET",path="/v1/queue"} 3`,
+		`test_requests_total{method="PUT",path="/v1/\"quoted\"\\path\nnext"} 1`,
+		`# HELP test_depth The depth of the queue\nwith a \\ in the help`,
+		`# TYPE test_depth gauge`,
+		`test_depth{queue="a"} 7`,
+		`test_depth{queue="b"} 2`,
+		`# HELP test_latency_seconds Latency`,
+		`# TYPE test_latency_seconds histogram`,
+		`test_latency_seconds_bucket{host="example.com",le="0.1"} 0`,
+		`test_latency_seconds_bucket{host="example.com",le="0.5"} 2`,
+		`test_latency_seconds_bucket{host="example.com",le="1"} 2`,
+		`test_latency_seconds_bucket{host="example.com",le="2.5"} 2`,
+		`test_latency_seconds_bucket{host="example.com",le="+Inf"} 3`,
+		`test_latency_seconds_sum{host="example.com"} 20.75`,
+		`test_latency_seconds_count{host="example.com"} 3`,
+		`# HELP test_unused_total A counter without any samples`,
+		`# TYPE test_unused_total counter`,
+		`# HELP test_uptime_seconds A gauge without labels`,
+		`# TYPE test_uptime_seconds gauge`,
+		`test_uptime_seconds 1.5`,
+	}, "\n") + "\n"
+
+	var output bytes.Buffer
+	if err := WriteMetrics(&output); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\nbut was:\n%s", expected, output.String())
+	}
+}
+
+func TestMetricLabelsMustMatch(t *testing.T) {
+	useMetrics(t)
+	counter := NewCounter("test_labelled_total", "A counter with a label", "queue")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a sample with the wrong number of labels to panic")
+		}
+	}()
+	counter.Inc()
+}
@@ -0,0 +1,22 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+)
+
+// QueueOwnership reports how the queues are distributed across the nodes of the cluster
+type QueueOwnership struct {
+	Assignment string          `json:"assignment,required" description:"How queues are assigned to nodes (rendezvous or first)"`
+	Nodes      []NodeOwnership `json:"nodes,required" description:"The live nodes of the cluster and the queues each owns"`
+	Unowned    []gocql.UUID    `json:"unowned,required" description:"The queues which no node currently owns (e.g. their window is closed)"`
+	Error      string          `json:"-"`
+}
+
+// NodeOwnership lists the queues owned by a node
+type NodeOwnership struct {
+	UUID    gocql.UUID   `json:"uuid,required" description:"The unique identifier of the node"`
+	Address string       `json:"address,omitempty" description:"The address of the API of the node.  Empty if the node has left the cluster but its ownership has not yet expired"`
+	Port    string       `json:"port,omitempty" description:"The port of the API of the node"`
+	Queues  []gocql.UUID `json:"queues,required" description:"The queues owned by the node"`
+	Count   int          `json:"count,required" description:"The number of queues owned by the node"`
+}
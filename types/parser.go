@@ -33,17 +33,25 @@ func (p *parser) run() {
 
 // DAG
 
+// states which may follow a complete clause, e.g. "9am - 5pm every weekday"
+var endOfPeriodStates = []itemType{itemAnd, itemException, itemWhere, itemEnd}
+
 func parseStart(p *parser) stateFn {
-	return switchOnValidStates(p, []itemType{itemTime, itemAnyAlways, itemNever})
+	return switchOnValidStates(p, []itemType{itemTime, itemAnyAlways, itemNever, itemFor, itemCalendarRef})
 }
 
 func parseTime(p *parser) stateFn {
 	second := false
-	if p.window.Start == "" {
-		p.window.Start = p.items[p.pos].val
+	if p.period.Interval > 0 {
+		// the time anchors an interval recurrence, e.g. "for 5 minutes every hour from 9am"
+		p.period.Start = p.items[p.pos].val
+		return switchOnValidStates(p, append([]itemType{itemTimeModifier, itemOn}, endOfPeriodStates...))
+	}
+	if p.period.Start == "" {
+		p.period.Start = p.items[p.pos].val
 	} else {
 		second = true
-		p.window.End = p.items[p.pos].val
+		p.period.End = p.items[p.pos].val
 	}
 	if second {
 		return switchOnValidStates(p, []itemType{itemTimeModifier, itemRecurrence, itemOn})
@@ -53,8 +61,8 @@ func parseTime(p *parser) stateFn {
 }
 
 func parseAny(p *parser) stateFn {
-	p.window.AlwaysOn = true
-	return switchOnValidStates(p, []itemType{itemAnyAlwaysClarification, itemException, itemEnd})
+	p.period.AlwaysOn = true
+	return switchOnValidStates(p, []itemType{itemAnyAlwaysClarification, itemOn, itemException, itemEnd})
 }
 
 func parseAnyAlwaysClarification(p *parser) stateFn {
@@ -62,12 +70,65 @@ func parseAnyAlwaysClarification(p *parser) stateFn {
 }
 
 func parseNever(p *parser) stateFn {
-	p.window.AlwaysOff = true
+	p.period.AlwaysOff = true
 	return switchOnValidStates(p, []itemType{itemEnd})
 }
 
 func parseException(p *parser) stateFn {
-	return switchOnValidStates(p, []itemType{itemTime, itemCalendar})
+	p.completePeriod()
+	p.exception = true
+	return switchOnValidStates(p, []itemType{itemTime, itemCalendar, itemOrdinal, itemFor, itemCalendarRef})
+}
+
+func parseAnd(p *parser) stateFn {
+	p.completePeriod()
+	return switchOnValidStates(p, []itemType{itemTime, itemCalendar, itemOrdinal, itemFor, itemCalendarRef, itemException})
+}
+
+func parseFor(p *parser) stateFn {
+	return switchOnValidStates(p, []itemType{itemNumber, itemUnit})
+}
+
+func parseNumber(p *parser) stateFn {
+	number, err := strconv.Atoi(p.items[p.pos].val)
+	if err != nil || number == 0 {
+		p.window.Error = fmt.Sprintf("Not a valid number: \"%s\"", p.items[p.pos].val)
+		return nil
+	}
+	p.number = number
+	return switchOnValidStates(p, []itemType{itemUnit})
+}
+
+func parseUnit(p *parser) stateFn {
+	// "every hour" is equivalent to "every 1 hour"
+	minutes := 1
+	if p.number > 0 {
+		minutes = p.number
+		p.number = 0
+	}
+	if strings.HasPrefix(p.items[p.pos].val, "hour") {
+		minutes = minutes * 60
+	}
+	if p.period.Duration == 0 {
+		// "for N minutes"
+		p.period.Duration = minutes
+		return switchOnValidStates(p, []itemType{itemRecurrence})
+	}
+	// "every M hours"
+	p.period.Interval = minutes
+	if p.period.Interval > 24*60 {
+		p.window.Error = "Not a valid interval: intervals longer than a day should use a daily recurrence"
+		return nil
+	}
+	if p.period.Duration >= p.period.Interval {
+		p.window.Error = fmt.Sprintf("Not a valid interval: the window (%d minutes) must be shorter than the interval (%d minutes)", p.period.Duration, p.period.Interval)
+		return nil
+	}
+	return switchOnValidStates(p, append([]itemType{itemFrom, itemOn}, endOfPeriodStates...))
+}
+
+func parseFrom(p *parser) stateFn {
+	return switchOnValidStates(p, []itemType{itemTime})
 }
 
 func parseRange(p *parser) stateFn {
@@ -75,9 +136,9 @@ func parseRange(p *parser) stateFn {
 }
 
 func parseTimeModifier(p *parser) stateFn {
-	timeToUpdateStr := p.window.Start
-	if p.window.End != "" {
-		timeToUpdateStr = p.window.End
+	timeToUpdateStr := p.period.Start
+	if p.period.End != "" {
+		timeToUpdateStr = p.period.End
 	}
 	elements := strings.Split(timeToUpdateStr, ":")
 	timeToUpdate, err := strconv.Atoi(elements[0])
@@ -92,38 +153,82 @@ func parseTimeModifier(p *parser) stateFn {
 				timeToUpdate = timeToUpdate + 12
 			}
 		}
-		if p.window.End == "" {
-			p.window.Start = fmt.Sprintf("%02d:%s", timeToUpdate, elements[1])
+		if p.period.End == "" {
+			p.period.Start = fmt.Sprintf("%02d:%s", timeToUpdate, elements[1])
 		} else {
-			p.window.End = fmt.Sprintf("%02d:%s", timeToUpdate, elements[1])
+			p.period.End = fmt.Sprintf("%02d:%s", timeToUpdate, elements[1])
 		}
 	}
+	if p.period.Interval > 0 {
+		return switchOnValidStates(p, append([]itemType{itemOn}, endOfPeriodStates...))
+	}
 	return switchOnValidStates(p, []itemType{itemTimeRange, itemOn, itemRecurrence})
 }
 
 func parseRecurrence(p *parser) stateFn {
-	return switchOnValidStates(p, []itemType{itemDay, itemCalendar, itemRecurringByDayMonthYear})
+	if p.period.Duration > 0 {
+		// an interval recurrence, e.g. "for 5 minutes every 2 hours"
+		return switchOnValidStates(p, []itemType{itemNumber, itemUnit})
+	}
+	return switchOnValidStates(p, []itemType{itemDay, itemCalendar, itemOrdinal, itemRecurringByDayMonthYear, itemCalendarRef})
+}
+
+func parseCalendarRef(p *parser) stateFn {
+	// a named calendar, e.g. "calendar uk-holidays" or "9am - 5pm every calendar patch-days"
+	return switchOnValidStates(p, []itemType{itemCalendarName})
+}
+
+func parseCalendarName(p *parser) stateFn {
+	if !RE_CALENDAR_NAME.MatchString(p.items[p.pos].val) {
+		p.window.Error = fmt.Sprintf("Not a valid calendar name: \"%s\"", p.items[p.pos].val)
+		return nil
+	}
+	p.period.Calendar = p.items[p.pos].val
+	return switchOnValidStates(p, endOfPeriodStates)
+}
+
+func parseOrdinal(p *parser) stateFn {
+	// e.g. "second tuesday of the month" or "last day of the month"
+	ordinal := p.items[p.pos].val
+	n := p.next()
+	if !(n.typ == itemDay && isDay(n.val)) && !(n.typ == itemRecurringByDayMonthYear && n.val == "day" && ordinal == "last") {
+		p.window.Error = fmt.Sprintf("Not a valid recurrence for: \"%s %s\" (expected a day of the week, e.g. \"%s tuesday of the month\", or \"last day of the month\")", ordinal, n.val, ordinal)
+		return nil
+	}
+	p.updateRecurrence(ordinal)
+	p.updateRecurrence(n.val)
+	return switchOnValidStates(p, []itemType{itemClarification, itemRecurringByDayMonthYear, itemMonth})
 }
 
 func parseDayMonth(p *parser) stateFn {
 	p.updateRecurrence(p.items[p.pos].val)
-	return switchOnValidStates(p, []itemType{itemWhere, itemEnd})
+	return switchOnValidStates(p, endOfPeriodStates)
 }
 
 func parseCalendar(p *parser) stateFn {
 	elements := strings.Split(p.items[p.pos].val, "/")
 	if len(elements) == 3 {
 		if len(elements[2]) == 2 {
-			p.window.OnDate = elements[0] + "/" + elements[1] + "/20" + elements[2]
+			p.period.OnDate = elements[0] + "/" + elements[1] + "/20" + elements[2]
 		} else {
-			p.window.OnDate = p.items[p.pos].val
+			p.period.OnDate = p.items[p.pos].val
 		}
-		return switchOnValidStates(p, []itemType{itemWhere, itemEnd})
+		return switchOnValidStates(p, endOfPeriodStates)
 	} else {
 		newStr := strings.Replace(p.items[p.pos].val, "st", "", -1)
 		newStr = strings.Replace(newStr, "nd", "", -1)
 		newStr = strings.Replace(newStr, "rd", "", -1)
 		newStr = strings.Replace(newStr, "th", "", -1)
+		if p.pos+1 < len(p.items) && p.items[p.pos+1].typ == itemDay {
+			// a numbered day of the week, e.g. "2nd tuesday of the month", is read as its ordinal
+			ordinal := ordinalFor(newStr)
+			if ordinal == "" {
+				p.window.Error = fmt.Sprintf("Not a valid recurrence for: \"%s %s\" (expected one of 1st to 4th, or last)", p.items[p.pos].val, p.items[p.pos+1].val)
+				return nil
+			}
+			p.items[p.pos].val = ordinal
+			return parseOrdinal(p)
+		}
 		p.updateRecurrence(newStr)
 		return switchOnValidStates(p, []itemType{itemRecurringByDayMonthYear, itemMonth, itemClarification})
 	}
@@ -134,24 +239,48 @@ func parseClarification(p *parser) stateFn {
 }
 
 func parseRecurringByDayMonthYear(p *parser) stateFn {
-	item_ := p.getLastElement(itemCalendar)
-	elements := strings.Split(item_.val, "/")
+	// the recurrence holds the calendar entry (if any) which qualifies this item, e.g. "1" from "1st of the month"
+	elements := strings.Split(p.period.Recurrence, "/")
+	if p.items[p.pos].val != "day" && p.period.Recurrence == "" {
+		// not valid.  not qualified at all, e.g. "every month"
+		p.window.Error = fmt.Sprintf("Not a valid recurrence for: \"%s\"", p.items[p.pos].val)
+		return nil
+	}
+	if p.items[p.pos].val == "day" && p.period.Recurrence != "" {
+		// not valid.  a day cannot be qualified, e.g. "1st of the day"
+		p.window.Error = fmt.Sprintf("Not a valid recurrence for: \"%s day\"", p.period.Recurrence)
+		return nil
+	}
+	if isOrdinal(strings.Split(p.period.Recurrence, " ")[0]) && p.items[p.pos].val != "month" && p.items[p.pos].val != "monthly" {
+		// not valid.  ordinals are only meaningful within a month, e.g. "second tuesday yearly"
+		p.window.Error = fmt.Sprintf("Not a valid recurrence for: \"%s %s\" (expected \"of the month\")", p.period.Recurrence, p.items[p.pos].val)
+		return nil
+	}
 	if p.items[p.pos].val == "year" || p.items[p.pos].val == "yearly" {
 		if len(elements) != 2 {
 			// not valid.  not properly qualified, e.g. "1st yearly"
-			p.window.Error = fmt.Sprintf("Not a valid recurrence for: \"%s\"", item_.val)
+			p.window.Error = fmt.Sprintf("Not a valid recurrence for: \"%s\"", p.period.Recurrence)
 			return nil
 		}
 	}
 	p.updateRecurrence(p.items[p.pos].val)
-	return switchOnValidStates(p, []itemType{itemWhere, itemEnd})
+	return switchOnValidStates(p, endOfPeriodStates)
 }
 
 func parseOn(p *parser) stateFn {
+	if p.period.AlwaysOn {
+		// "always on" rather than "on <date>"
+		return switchOnValidStates(p, []itemType{itemException, itemEnd})
+	}
+	if p.period.Interval > 0 {
+		// restrict an interval recurrence to a given day, e.g. "on weekday"
+		return switchOnValidStates(p, []itemType{itemDay})
+	}
 	return switchOnValidStates(p, []itemType{itemCalendar})
 }
 
 func parseWhere(p *parser) stateFn {
+	p.completePeriod()
 	return switchOnValidStates(p, []itemType{itemTimeZoneParam})
 }
 
@@ -164,11 +293,16 @@ func parseEquals(p *parser) stateFn {
 }
 
 func parseTimeZone(p *parser) stateFn {
+	if _, err := loadLocation(p.items[p.pos].val); err != nil {
+		p.window.Error = err.Error()
+		return nil
+	}
 	p.window.Timezone = p.items[p.pos].val
 	return switchOnValidStates(p, []itemType{itemEnd})
 }
 
 func parseEnd(p *parser) stateFn {
+	p.completePeriod()
 	return nil
 }
 
@@ -182,23 +316,25 @@ func (p *parser) next() item {
 	return p.items[p.pos]
 }
 
-func (p *parser) getLastElement(typ itemType) item {
-	for i := p.pos; i >= 0; i-- {
-		item_ := p.items[i]
-		if item_.typ == typ {
-			return item_
-		}
+func (p *parser) updateRecurrence(item string) {
+	if p.period.Recurrence == "" {
+		p.period.Recurrence += item
+	} else {
+		p.period.Recurrence += " " + item
 	}
-	// we shouldnt reach this position (typically) because the DAG should ensure we are able to find a valid item
-	return item{}
 }
 
-func (p *parser) updateRecurrence(item string) {
-	if p.window.Recurrence == "" {
-		p.window.Recurrence += item
+// completePeriod adds the clause which has just been parsed to the window
+func (p *parser) completePeriod() {
+	if p.period == (Period{}) {
+		return
+	}
+	if p.exception {
+		p.window.Exceptions = append(p.window.Exceptions, p.period)
 	} else {
-		p.window.Recurrence += " " + item
+		p.window.Periods = append(p.window.Periods, p.period)
 	}
+	p.period = Period{}
 }
 
 func switchOnValidStates(p *parser, validStates []itemType) stateFn {
@@ -224,6 +360,8 @@ func switchOnValidStates(p *parser, validStates []itemType) stateFn {
 			return parseWhere
 		case n.typ == itemEquals:
 			return parseEquals
+		case n.typ == itemAnd:
+			return parseAnd
 		case n.typ == itemRecurrence:
 			return parseRecurrence
 		case n.typ == itemAnyAlways:
@@ -250,6 +388,20 @@ func switchOnValidStates(p *parser, validStates []itemType) stateFn {
 			return parseRecurringByDayMonthYear
 		case n.typ == itemClarification:
 			return parseClarification
+		case n.typ == itemOrdinal:
+			return parseOrdinal
+		case n.typ == itemFor:
+			return parseFor
+		case n.typ == itemFrom:
+			return parseFrom
+		case n.typ == itemNumber:
+			return parseNumber
+		case n.typ == itemUnit:
+			return parseUnit
+		case n.typ == itemCalendarRef:
+			return parseCalendarRef
+		case n.typ == itemCalendarName:
+			return parseCalendarName
 		}
 	}
 	p.window.Error = fmt.Sprintf("Invalid parse at: \"%s\"", n.val)
@@ -10,9 +10,12 @@ type item struct {
 }
 
 type parser struct {
-	pos    int // current position in the input.
-	items  []item
-	window Window
+	pos       int // current position in the input.
+	items     []item
+	window    Window
+	period    Period // the clause currently being parsed
+	exception bool   // true once "except" has been seen; subsequent clauses are exceptions
+	number    int    // the most recent number, waiting for its unit
 }
 
 const (
@@ -38,4 +41,11 @@ const (
 	itemMonth
 	itemRecurringByDayMonthYear
 	itemClarification
+	itemOrdinal
+	itemFor
+	itemFrom
+	itemNumber
+	itemUnit
+	itemCalendarRef
+	itemCalendarName
 )
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+)
+
+const (
+	// the state of a queue: open (its window is open and it is contained), paused (its window is open but a queue
+	// containing it is closed) or closed (its window is closed)
+	PathQueueOpen   = "open"
+	PathQueuePaused = "paused"
+	PathQueueClosed = "closed"
+)
+
+// A PathNode is a single element of the path hierarchy, e.g. /datacenters/dc2, with the queues found at that path
+type PathNode struct {
+	Path     string      `json:"path,required" description:"The path of the node"`
+	Queues   []PathQueue `json:"queues,required" description:"The queues found at the path"`
+	Children []PathNode  `json:"children,required" description:"The paths beneath the node"`
+}
+
+type PathQueue struct {
+	UUID        gocql.UUID `json:"uuid,required" description:"The unique identifier of the queue"`
+	Name        string     `json:"name,omitempty" description:"The name of the queue"`
+	Status      string     `json:"status,required" description:"Active or Deleting"`
+	State       string     `json:"state,required" description:"open, paused (the window of the queue is open but a queue containing it is closed) or closed"`
+	Contained   bool       `json:"contained" description:"True if the queues containing the queue are open, i.e. the queue may run whenever its window is open"`
+	Containment string     `json:"containment,required" description:"all-paths or any-path"`
+	Blocked     []string   `json:"blocked,omitempty" description:"When the queue is not contained, the reasons why, e.g. parent /apps closed until 04:00 on 24/10/2026"`
+}
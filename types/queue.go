@@ -4,7 +4,7 @@ import (
 	"errors"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gocql/gocql"
-	"github.com/relops/cqlr"
+	"strings"
 	"time"
 )
 
@@ -14,30 +14,41 @@ const (
 	QueueActive   = "Active"
 	QueueDeleted  = "Deleted"
 	QueueDeleting = "Deleting"
+
+	// a queue with several paths runs when it is contained along all of them, or along any one of them
+	QueueContainmentAll = "all-paths"
+	QueueContainmentAny = "any-path"
 )
 
 type Queue struct {
-	UUID                   gocql.UUID             `cql:"queue_uuid" json:"uuid,required" description:"The unique identifier of the queue"`
-	Name                   string                 `cql:"name" json:"name,omitempty" description:"The unique name of the queue"`
-	QueueType              string                 `cql:"queue_type" json:"queueType,omitempty" description:"The type of queue: sync or async"`
-	WindowOfOperation      string                 `cql:"window_of_operation" json:"windowOfOperation,omitempty" description:"The window of operation for the queue if defined as sync"`
-	ShouldDrain            bool                   `cql:"should_drain" json:"shouldDrain,omitempty" description:"The expected behaviour of the queue when it is deleted. If true the queue will drain (and no longer accept new requests) before it is deleted.  Defaults to true"`
-	BackPressureAction     *gocql.UUID            `cql:"backpressure_action" json:"backpressureAction,omitempty" description:"The unique identifier of an action to be called in the event that the backpressure definition is breached"`
-	BackpressureDefinition uint64                 `cql:"backpressure_definition" json:"backpressureDefinition,omitempty" description:"For queues the backpressure definition defines the number of waiting task slots before the backpressure API endpoint is called."`
-	OurTags                []string               `json:"tags,omitempty" description:"Tags assigned to the queue."`
-	OurPaths               []string               `json:"paths,omitempty" description:"Paths assigned to the queue."`
-	Tasks                  []Task                 `json:"-"`
-	Window                 Window                 `json:"-"`
-	Running                bool                   `json:"-"`
-	Status                 string                 `json:"-"`
-	asyncTimerMap          map[string]*time.Timer `json:"-"`
-	asyncTimeWindow        time.Time              `json:"-"`
+	UUID                   gocql.UUID       `cql:"queue_uuid" json:"uuid,required" description:"The unique identifier of the queue"`
+	Name                   string           `cql:"name" json:"name,omitempty" description:"The unique name of the queue"`
+	QueueType              string           `cql:"queue_type" json:"queueType,omitempty" description:"The type of queue: sync or async"`
+	WindowOfOperation      string           `cql:"window_of_operation" json:"windowOfOperation,omitempty" description:"The window of operation for the queue if defined as sync"`
+	ShouldDrain            bool             `cql:"should_drain" json:"shouldDrain,omitempty" description:"The expected behaviour of the queue when it is deleted. If true the queue will drain (and no longer accept new requests) before it is deleted.  Defaults to true"`
+	BackPressureAction     *gocql.UUID      `cql:"backpressure_action" json:"backpressureAction,omitempty" description:"The unique identifier of an action to be called in the event that the backpressure definition is breached"`
+	BackpressureDefinition uint64           `cql:"backpressure_definition" json:"backpressureDefinition,omitempty" description:"For queues the backpressure definition defines the number of waiting task slots before the backpressure API endpoint is called."`
+	BackpressureLowMark    uint64           `cql:"backpressure_low_watermark" json:"backpressureLowWatermark,omitempty" description:"Once raised, backpressure is relieved when the number of waiting tasks falls to this level.  Defaults to half the backpressure definition"`
+	BackpressureMaxAge     uint64           `cql:"backpressure_max_age" json:"backpressureMaxAge,omitempty" description:"Backpressure is also raised when the oldest pending task has waited longer than this many seconds"`
+	BackpressureInterval   uint64           `cql:"backpressure_interval" json:"backpressureInterval,omitempty" description:"The minimum number of seconds between backpressure signals.  Defaults to 60"`
+	Containment            string           `cql:"containment" json:"containment,omitempty" description:"For queues with several paths: all-paths (the default) if the queue only runs when the queues along all of its paths are open or any-path if one open path is sufficient"`
+	Inherit                bool             `cql:"inherit" json:"inherit,omitempty" description:"If true the backpressure settings and tags which are not set on the queue are inherited from the nearest ancestor queue (via its paths)"`
+	InheritedFrom          *gocql.UUID      `json:"inheritedFrom,omitempty" description:"For the effective configuration of a queue, the ancestor queue from which settings were inherited"`
+	OurTags                []string         `json:"tags,omitempty" description:"Tags assigned to the queue."`
+	OurPaths               []string         `json:"paths,omitempty" description:"Paths assigned to the queue."`
+	Tasks                  []Task           `json:"-"`
+	Window                 Window           `json:"-"`
+	Running                bool             `json:"-"`
+	Status                 string           `json:"-"`
+	Transition             SpanContext      `json:"-"` // only read or written by the queue manager; execution is given a copy
+	asyncTimerMap          map[string]Timer `json:"-"`
+	asyncTimeWindow        time.Time        `json:"-"`
 }
 
 // Query
 func GetQueues() []Queue {
 	query := session.Query("select * from queues where status in (?, ?) allow filtering", QueueActive, QueueDeleting)
-	bind := cqlr.BindQuery(query)
+	bind := query.Binding()
 	var queue Queue
 	queues := []Queue{}
 	for bind.Scan(&queue) {
@@ -48,25 +59,62 @@ func GetQueues() []Queue {
 	return queues
 }
 
-func GetQueuesByTag(tag string) []Queue {
-	var id gocql.UUID
-	var queue Queue
+
+var queueSource = listSource{
+	table:    "queues",
+	key:      "queue_uuid",
+	object:   "queue",
+	columns:  "queue_uuid, status, name",
+	sorts:    []string{SortName},
+	statuses: []string{QueueActive, QueueDeleting},
+	row:      func() interface{} { return &Queue{} },
+	item: func(row interface{}) listItem {
+		queue := row.(*Queue)
+		return listItem{UUID: queue.UUID, Status: queue.Status, Name: queue.Name}
+	},
+}
+
+// ListQueues returns a page of the queues matching the options.  Deleted queues are only listed if asked for by status.
+func ListQueues(options ListOptions) ([]Queue, ListPage, error) {
+	items, page, err := queueSource.list(options)
+	if err != nil {
+		return nil, page, err
+	}
+	// a queue may have a row for each status
+	loaded := map[string]Queue{}
+	for _, chunk := range inChunks(itemUUIDs(items)) {
+		placeholders, values := inClause(chunk)
+		bind := session.Query("select * from queues where queue_uuid in ("+placeholders+")", values...).Binding()
+		var queue Queue
+		for bind.Scan(&queue) {
+			loaded[queue.UUID.String()+queue.Status] = queue
+		}
+		if err := bind.Close(); err != nil {
+			return nil, page, err
+		}
+	}
+	tags, err := loadTags(itemUUIDs(items))
+	if err != nil {
+		return nil, page, err
+	}
+	paths, err := loadPaths(itemUUIDs(items))
+	if err != nil {
+		return nil, page, err
+	}
 	queues := []Queue{}
-	iteration := session.Query("select object_uuid from tags where type = 'queue' and tag = ? allow filtering", tag).Iter()
-	for iteration.Scan(&id) {
-		q := session.Query("select * from queues where queue_uuid = ?", id)
-		b := cqlr.BindQuery(q)
-		b.Scan(&queue)
-		queue.LoadTags()
-		queue.LoadPaths()
-		queues = append(queues, queue)
+	for _, item := range items {
+		if queue, ok := loaded[item.UUID.String()+item.Status]; ok {
+			queue.OurTags = tags[queue.UUID]
+			queue.OurPaths = paths[queue.UUID]
+			queues = append(queues, queue)
+		}
 	}
-	return queues
+	return queues, page, nil
 }
 
 func GetQueue(queueUUID string) (Queue, error) {
 	query := session.Query("select * from queues where queue_uuid = ?", queueUUID)
-	bind := cqlr.BindQuery(query)
+	bind := query.Binding()
 	var queue Queue
 	if !bind.Scan(&queue) {
 		return Queue{}, errors.New("Unknown queue")
@@ -82,7 +130,7 @@ func GetQueueByPath(path string) (Queue, error) {
 		return Queue{}, errors.New("No queue found")
 	}
 	query := session.Query("select * from queues where queue_uuid = ?", id)
-	bind := cqlr.BindQuery(query)
+	bind := query.Binding()
 	var queue Queue
 	bind.Scan(&queue)
 	queue.LoadTags()
@@ -90,6 +138,19 @@ func GetQueueByPath(path string) (Queue, error) {
 	return queue, nil
 }
 
+func GetQueuesByPath(path string) []Queue {
+	var id gocql.UUID
+	queues := []Queue{}
+	iteration := session.Query(`select queue_uuid from paths where path = ? allow filtering`, path).Iter()
+	for iteration.Scan(&id) {
+		queue, err := GetQueue(id.String())
+		if err == nil && queue.Status == QueueActive {
+			queues = append(queues, queue)
+		}
+	}
+	return queues
+}
+
 // CRUD
 func (queue *Queue) CreateOrUpdate() error {
 	// ensure paths are unique for object
@@ -100,18 +161,34 @@ func (queue *Queue) CreateOrUpdate() error {
 	if queue.QueueType != "sync" && queue.QueueType != "async" {
 		return errors.New("Invalid queue type")
 	}
-	_, parseErr := Parse(queue.WindowOfOperation)
+	if queue.Containment == "" {
+		queue.Containment = QueueContainmentAll
+	} else if queue.Containment != QueueContainmentAll && queue.Containment != QueueContainmentAny {
+		return errors.New("Invalid containment: expected all-paths or any-path")
+	}
+	if queue.BackpressureLowMark > 0 && queue.BackpressureLowMark >= queue.BackpressureDefinition {
+		return errors.New("The backpressure low watermark must be below the backpressure definition")
+	}
+	if queue.BackPressureAction != nil && queue.BackPressureAction.String() != "00000000-0000-0000-0000-000000000000" {
+		if _, err := GetAction(queue.BackPressureAction.String()); err != nil {
+			return errors.New("Unknown backpressure action")
+		}
+	}
+	window, parseErr := Parse(queue.WindowOfOperation)
 	if parseErr != nil {
 		return errors.New("Invalid window definition: " + parseErr.Error())
 	}
+	if calendarErr := window.ValidateCalendars(); calendarErr != nil {
+		return errors.New("Invalid window definition: " + calendarErr.Error())
+	}
 	pathErr := queue.CreateOrUpdatePaths()
 	if pathErr != nil {
 		return pathErr
 	}
 	queue.CreateOrUpdateTags()
 	queue.Status = QueueActive
-	bind := cqlr.Bind(`insert into queues (queue_uuid, name, queue_type, window_of_operation, should_drain, backpressure_action, backpressure_definition, status) values (?, ?, ?, ?, ?, ?, ?, ?)`, queue)
-	if err := bind.Exec(session); err != nil {
+	bind := session.Bind(`insert into queues (queue_uuid, name, queue_type, window_of_operation, should_drain, backpressure_action, backpressure_definition, backpressure_low_watermark, backpressure_max_age, backpressure_interval, containment, inherit, status) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, queue)
+	if err := bind.Exec(); err != nil {
 		return err
 	} else {
 		return nil
@@ -130,8 +207,8 @@ func (queue Queue) Delete() error {
 	} else {
 		queue.Status = QueueDeleted
 	}
-	bind := cqlr.Bind(`insert into queues (queue_uuid, name, queue_type, window_of_operation, should_drain, backpressure_action, backpressure_definition, status) values (?, ?, ?, ?, ?, ?, ?, ?)`, queue)
-	if err := bind.Exec(session); err != nil {
+	bind := session.Bind(`insert into queues (queue_uuid, name, queue_type, window_of_operation, should_drain, backpressure_action, backpressure_definition, backpressure_low_watermark, backpressure_max_age, backpressure_interval, containment, inherit, status) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, queue)
+	if err := bind.Exec(); err != nil {
 		return err
 	} else {
 		return nil
@@ -176,16 +253,40 @@ func LoadPathsFromDB(uuid gocql.UUID) []string {
 	return paths
 }
 
+// loadPaths returns the paths of each of the queues, using one query per maxInClause queues
+func loadPaths(uuids []gocql.UUID) (map[gocql.UUID][]string, error) {
+	paths := map[gocql.UUID][]string{}
+	for _, chunk := range inChunks(uuids) {
+		var id gocql.UUID
+		var path string
+		placeholders, values := inClause(chunk)
+		iteration := session.Query("select queue_uuid, path from paths where queue_uuid in ("+placeholders+")", values...).Iter()
+		for iteration.Scan(&id, &path) {
+			paths[id] = append(paths[id], path)
+		}
+		if err := iteration.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
 func (q Queue) CreateOrUpdatePaths() error {
 	// set paths on queue
-	pathsFromDB := LoadPathsFromDB(q.UUID)
 	for _, path := range q.OurPaths {
 		if path == "/" {
 			return errors.New("Cannot define queue with root path")
 		}
+		if !strings.HasPrefix(path, "/") {
+			// this includes the empty path
+			return errors.New("Cannot define path without a leading slash")
+		}
 		if path[len(path)-1:] == "/" {
 			return errors.New("Cannot define path with trailing slash")
 		}
+	}
+	pathsFromDB := LoadPathsFromDB(q.UUID)
+	for _, path := range q.OurPaths {
 		if isStringInSlice(path, pathsFromDB) {
 			pathsFromDB = findAndRemoveInSlice(path, pathsFromDB)
 		} else {
@@ -218,29 +319,21 @@ func (q Queue) MatchesPath(path string) bool {
 }
 
 func (q Queue) CountOfTasks() uint64 {
+	return q.CountOfTasksWithStatus(TaskPending)
+}
+
+func (q Queue) CountOfTasksWithStatus(status string) uint64 {
 	var count uint64
-	query := "select count(*) from async_tasks where queue_uuid = ? and status = 'Pending' limit 1000000"
+	query := "select count(*) from async_tasks where queue_uuid = ? and status = ? limit 1000000"
 	if q.QueueType == QueueSync {
-		query = "select count(*) from sync_tasks where queue_uuid = ? and status = 'Pending' limit 1000000"
+		query = "select count(*) from sync_tasks where queue_uuid = ? and status = ? limit 1000000"
 	}
-	if err := session.Query(query, q.UUID).Scan(&count); err == nil {
+	if err := session.Query(query, q.UUID, status).Scan(&count); err == nil {
 		return count
 	}
 	return 0
 }
 
-func (q Queue) CheckBackpressure() {
-	if q.CountOfTasks() > q.BackpressureDefinition {
-		// the depth of the queue exceeds our expectations.
-		if q.BackPressureAction.String() == "00000000-0000-0000-0000-000000000000" {
-			task, err := GetTask(q.BackPressureAction.String())
-			if err == nil {
-				task.Execute(true)
-			}
-		}
-	}
-}
-
 func (q Queue) ReceivedCompletionForTask(task_uuid string) {
 	// in a sync model we only execute a promise (if defined) when a completion message is received.
 	task, err := GetTask(task_uuid)
@@ -258,7 +351,7 @@ func (q *Queue) UpdatedTask(action string, task_uuid string) {
 			if err == nil {
 				if !q.asyncTimeWindow.IsZero() && t.When.Before(q.asyncTimeWindow) {
 					// task is within scope of the current time slice
-					q.addToTimerMap(task_uuid)
+					q.addToTimerMap(task_uuid, q.Transition)
 				}
 			}
 		} else if action == EunomiaActionUpdate {
@@ -266,7 +359,7 @@ func (q *Queue) UpdatedTask(action string, task_uuid string) {
 			// the task may be executing but the key isn't remove from the map until this has
 			// completed.  the chances of this are slim but greater than 0
 			q.removeFromTimerMap(task_uuid)
-			q.addToTimerMap(task_uuid)
+			q.addToTimerMap(task_uuid, q.Transition)
 		} else if action == EunomiaActionDelete {
 			// if currently in our asyncTimerMap, stop timer and remove
 			_, ok := q.asyncTimerMap[task_uuid]
@@ -278,11 +371,15 @@ func (q *Queue) UpdatedTask(action string, task_uuid string) {
 	}
 }
 
-func (q *Queue) addToTimerMap(task string) {
+// addToTimerMap schedules the task.  decision is the span of the transition which opened the queue, under which the
+// task is traced
+func (q *Queue) addToTimerMap(task string, decision SpanContext) {
 	t, err := GetTask(task)
 	if err == nil {
 		// execute task at specified time.
-		q.asyncTimerMap[t.UUID.String()] = time.AfterFunc(t.When.Sub(time.Now()), func() {
+		clock := GetClock()
+		q.asyncTimerMap[t.UUID.String()] = clock.AfterFunc(t.When.Sub(clock.Now()), func() {
+			t.decision = decision
 			t.Execute(false)
 			delete(q.asyncTimerMap, t.UUID.String())
 		})
@@ -290,28 +387,37 @@ func (q *Queue) addToTimerMap(task string) {
 }
 
 func (q *Queue) removeFromTimerMap(task string) {
-	timer := q.asyncTimerMap[task]
-	timer.Stop()
-	delete(q.asyncTimerMap, task)
+	if timer, ok := q.asyncTimerMap[task]; ok {
+		timer.Stop()
+		delete(q.asyncTimerMap, task)
+	}
 }
 
-func (q *Queue) StartOrContinueExecution(starting bool) {
+// StartOrContinueExecution executes the tasks of the queue until it is stopped.  decision is the span of the transition
+// which opened the queue, passed by value as the queue manager may replace queue.Transition meanwhile.
+func (q *Queue) StartOrContinueExecution(starting bool, decision SpanContext) {
 	if starting {
 		log.WithFields(log.Fields{"name": q.Name, "UUID": q.UUID.String()}).Info("Starting execution on Queue")
 	} else {
 		log.WithFields(log.Fields{"name": q.Name, "UUID": q.UUID.String()}).Info("Continuing execution on Queue")
 	}
 	q.Running = true
+	clock := GetClock()
 	if q.QueueType == QueueSync {
 		// sync mode
 		// execute each task in order.  wait for completion and then execute the next
 		for {
+			if !q.Running {
+				// execution was stopped while we waited
+				return
+			}
 			var id gocql.UUID
 			if err := session.Query(`select task_uuid from sync_tasks where queue_uuid = ? and status = ? limit 1;`, q.UUID, TaskPending).Scan(&id); err == nil {
 				// found a valid task in the queue.  execute and return.  we'll rely on the queue manager to start us up again when the completion message is received
 				task, err := GetTask(id.String())
 				if err == nil {
 					// found a matching task. now execute and immediately return
+					task.decision = decision
 					if !task.Execute(true) {
 						// the action failed.  which means we wont ever receive a completion message
 						task.ExecutePromise()
@@ -321,30 +427,33 @@ func (q *Queue) StartOrContinueExecution(starting bool) {
 				}
 			}
 			// we didnt find a task for this queue in scope.  so wait, and try again.
-			time.Sleep(15 * time.Second)
+			clock.Sleep(15 * time.Second)
 		}
 	} else if q.QueueType == QueueAsync {
 		// async mode
 		// execute each task independently based on timestamp
 		// reset the timer map
-		q.asyncTimerMap = make(map[string]*time.Timer)
+		q.asyncTimerMap = make(map[string]Timer)
 		for {
-			timeForQuery := time.Now().Add(5 * time.Minute)
+			if !q.Running {
+				return
+			}
+			timeForQuery := clock.Now().Add(5 * time.Minute)
 			if timeForQuery.After(q.Window.GetNextEndTime()) {
 				timeForQuery = q.Window.GetNextEndTime()
 			}
 			q.asyncTimeWindow = timeForQuery
 			var id gocql.UUID
-			iteration := session.Query("select task_uuid from async_tasks where queue_uuid = ? and status = ? and when > ? and when < ?", q.UUID, TaskPending, time.Now(), timeForQuery).Iter()
+			iteration := session.Query("select task_uuid from async_tasks where queue_uuid = ? and status = ? and when > ? and when < ?", q.UUID, TaskPending, clock.Now(), timeForQuery).Iter()
 			for iteration.Scan(&id) {
 				_, ok := q.asyncTimerMap[id.String()]
 				if !ok {
 					// we don't currently know about this task.
-					q.addToTimerMap(id.String())
+					q.addToTimerMap(id.String(), decision)
 				}
 			}
 			// every 4 minutes, check for new tasks
-			time.Sleep(4 * time.Minute)
+			clock.Sleep(4 * time.Minute)
 		}
 	}
 }
@@ -0,0 +1,15 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestCreateOrUpdatePathsRejectsInvalidPaths(t *testing.T) {
+	// invalid paths are rejected before the store is used
+	for _, invalid := range []string{"", "/", "relative", "relative/path", "./path", "/trailing/"} {
+		q := Queue{OurPaths: []string{"/valid", invalid}}
+		if err := q.CreateOrUpdatePaths(); err == nil {
+			t.Errorf("expected path %q to be rejected", invalid)
+		}
+	}
+}
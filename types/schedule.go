@@ -0,0 +1,283 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultScheduleCount = 5
+	MaxScheduleCount     = 100
+)
+
+// An Interval is a single period during which a window (or queue) is open
+type Interval struct {
+	Start time.Time `json:"start,required" description:"The time at which the window opens"`
+	End   time.Time `json:"end,required" description:"The time at which the window closes"`
+}
+
+type WindowExplainRequest struct {
+	Window string    `json:"window,required" description:"The window of operation to explain, e.g. \"9am - 5pm every weekday\""`
+	From   time.Time `json:"from,omitempty" description:"The reference time from which intervals are generated. Defaults to now"`
+	Count  int       `json:"count,omitempty" description:"The number of intervals to generate. Defaults to 5, maximum of 100"`
+}
+
+type WindowExplanation struct {
+	Window     string     `json:"window,required" description:"The canonical form of the window of operation"`
+	Definition Window     `json:"definition,required" description:"The parsed window of operation"`
+	Contained  []string   `json:"containedBy,omitempty" description:"For queues, the windows of the queues which contain it (via its paths)"`
+	Intervals  []Interval `json:"intervals,required" description:"The next open and close times of the window"`
+}
+
+// ExplainWindow parses the window and generates the next count intervals from the given time
+func ExplainWindow(definition string, from time.Time, count int) (WindowExplanation, error) {
+	window, err := Parse(definition)
+	if err != nil {
+		return WindowExplanation{}, err
+	}
+	if err := window.ValidateCalendars(); err != nil {
+		return WindowExplanation{}, err
+	}
+	return WindowExplanation{Window: window.String(), Definition: window, Intervals: window.Intervals(from, count)}, nil
+}
+
+// Schedule returns the next count intervals in which the queue will be open from the given time.  Unlike the window
+// alone this includes containment: along each of its paths the queue is only open when, at every parent holding
+// queues, one of those queues is open.  The queue must be contained along all of its paths or, for any-path queues,
+// along one of them.
+func (q Queue) Schedule(from time.Time, count int) (WindowExplanation, error) {
+	window, err := Parse(q.WindowOfOperation)
+	if err != nil {
+		return WindowExplanation{}, errors.New("Invalid window definition: " + err.Error())
+	}
+	contained := []string{}
+	seen := map[string]bool{}
+	chains := anyOf{}
+	sources := allOf{&window}
+	for _, ourPath := range q.OurPaths {
+		chain := allOf{}
+		for thepath := path.Dir(path.Clean(ourPath)); thepath != "/" && thepath != "."; thepath = path.Dir(thepath) {
+			containers := anyOf{}
+			for _, container := range GetQueuesByPath(thepath) {
+				if container.UUID == q.UUID {
+					// the queue contains itself at this path so the path is open whenever the queue is
+					containers = nil
+					break
+				}
+				containerWindow, err := Parse(container.WindowOfOperation)
+				if err != nil {
+					continue
+				}
+				containers = append(containers, &containerWindow)
+				if !seen[container.UUID.String()] {
+					seen[container.UUID.String()] = true
+					contained = append(contained, fmt.Sprintf("%s (%s): %s", container.Name, strings.Join(container.OurPaths, ", "), containerWindow.String()))
+				}
+			}
+			if len(containers) > 0 {
+				chain = append(chain, containers)
+			}
+		}
+		if q.Containment == QueueContainmentAny {
+			chains = append(chains, chain)
+		} else {
+			sources = append(sources, chain)
+		}
+	}
+	if len(chains) > 0 {
+		sources = append(sources, chains)
+	}
+	return WindowExplanation{Window: window.String(), Definition: window, Contained: contained, Intervals: sourceIntervals(sources, from, count)}, nil
+}
+
+// Intervals returns the next count intervals, from the given time, in which the window is open
+func (w *Window) Intervals(from time.Time, count int) []Interval {
+	return sourceIntervals(w, from, count)
+}
+
+// An intervalSource generates the first interval, at or after t, in which it is open.  If t falls within an interval
+// the interval returned starts at t.
+type intervalSource interface {
+	nextInterval(t time.Time) (time.Time, time.Time)
+}
+
+// allOf is open when all of its sources are open
+type allOf []intervalSource
+
+// anyOf is open when any of its sources is open
+type anyOf []intervalSource
+
+// sourceIntervals returns the next count intervals of the source
+func sourceIntervals(source intervalSource, from time.Time, count int) []Interval {
+	intervals := []Interval{}
+	t := from
+	for len(intervals) < count {
+		start, end := source.nextInterval(t)
+		if !start.Before(farFuture) {
+			break
+		}
+		intervals = append(intervals, Interval{Start: start, End: end})
+		t = end
+	}
+	return intervals
+}
+
+func (sources allOf) nextInterval(t time.Time) (time.Time, time.Time) {
+	for i := 0; i < maxIntervalSearch; i++ {
+		start := t
+		end := farFuture
+		moved := false
+		for _, source := range sources {
+			sourceStart, sourceEnd := source.nextInterval(start)
+			if sourceStart.After(start) {
+				// this source opens later; everything must be re-checked from that point
+				t = sourceStart
+				moved = true
+				break
+			}
+			if sourceEnd.Before(end) {
+				end = sourceEnd
+			}
+		}
+		if !moved {
+			return start, end
+		}
+		if !t.Before(farFuture) {
+			break
+		}
+	}
+	return farFuture, farFuture.AddDate(1, 0, 0)
+}
+
+func (sources anyOf) nextInterval(t time.Time) (time.Time, time.Time) {
+	start, end := farFuture, farFuture.AddDate(1, 0, 0)
+	for _, source := range sources {
+		sourceStart, sourceEnd := source.nextInterval(t)
+		if sourceStart.Before(start) || (sourceStart.Equal(start) && sourceEnd.After(end)) {
+			start, end = sourceStart, sourceEnd
+		}
+	}
+	if !start.Before(farFuture) {
+		return start, end
+	}
+	// extend the interval for as long as any source remains open
+	for i := 0; i < maxIntervalSearch && end.Before(farFuture); i++ {
+		extended := false
+		for _, source := range sources {
+			sourceStart, sourceEnd := source.nextInterval(end)
+			if !sourceStart.After(end) && sourceEnd.After(end) {
+				end = sourceEnd
+				extended = true
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+	return start, end
+}
+
+// String returns the canonical form of the window, which may itself be parsed
+func (w Window) String() string {
+	periods := []string{}
+	for _, period := range w.Periods {
+		periods = append(periods, period.String())
+	}
+	output := strings.Join(periods, " and ")
+	if len(w.Exceptions) > 0 {
+		exceptions := []string{}
+		for _, exception := range w.Exceptions {
+			exceptions = append(exceptions, exception.String())
+		}
+		output += " except " + strings.Join(exceptions, " and ")
+	}
+	if w.Timezone != "" {
+		output += " where timezone = " + w.Timezone
+	}
+	return output
+}
+
+func (p Period) String() string {
+	switch {
+	case p.AlwaysOn:
+		return "always"
+	case p.AlwaysOff:
+		return "never"
+	case p.Interval > 0:
+		output := "for " + describeMinutes(p.Duration) + " every " + describeMinutes(p.Interval)
+		if p.Start != "" {
+			output += " from " + p.Start
+		}
+		if p.Recurrence != "" {
+			output += " on " + p.Recurrence
+		}
+		return output
+	}
+	when := ""
+	if p.Calendar != "" {
+		when = "calendar " + p.Calendar
+	} else if p.OnDate != "" {
+		when = p.OnDate
+	} else {
+		when = describeRecurrence(p.Recurrence)
+	}
+	if p.Start == "" || p.End == "" {
+		// a whole day.  only dates and calendars (rather than days of the week) may be given without a time
+		return when
+	}
+	if p.OnDate != "" {
+		return p.Start + " - " + p.End + " on " + when
+	}
+	return p.Start + " - " + p.End + " every " + when
+}
+
+func describeMinutes(minutes int) string {
+	switch {
+	case minutes == 60:
+		return "1 hour"
+	case minutes%60 == 0:
+		return fmt.Sprintf("%d hours", minutes/60)
+	case minutes == 1:
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+func describeRecurrence(recurrence string) string {
+	elements := strings.Split(recurrence, " ")
+	if len(elements) < 2 {
+		return recurrence
+	}
+	if isOrdinal(elements[0]) && len(elements) == 3 {
+		if isMonth(elements[2]) {
+			return elements[0] + " " + elements[1] + " of " + elements[2]
+		}
+		return elements[0] + " " + elements[1] + " of the month"
+	}
+	switch {
+	case elements[1] == "month" || elements[1] == "monthly":
+		return withOrdinalSuffix(elements[0]) + " of the month"
+	case isMonth(elements[1]):
+		return withOrdinalSuffix(elements[0]) + " of " + elements[1]
+	case elements[1] == "year" || elements[1] == "yearly":
+		return elements[0] + " yearly"
+	}
+	return recurrence
+}
+
+func withOrdinalSuffix(day string) string {
+	switch {
+	case strings.HasSuffix(day, "11") || strings.HasSuffix(day, "12") || strings.HasSuffix(day, "13"):
+		return day + "th"
+	case strings.HasSuffix(day, "1"):
+		return day + "st"
+	case strings.HasSuffix(day, "2"):
+		return day + "nd"
+	case strings.HasSuffix(day, "3"):
+		return day + "rd"
+	}
+	return day + "th"
+}
@@ -0,0 +1,100 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindowStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		definition string
+		canonical  string
+	}{
+		{"always", "always"},
+		{"always on", "always"},
+		{"never", "never"},
+		{"always on except 2 - 4am every sunday", "always except 02:00 - 04:00 every sunday"},
+		{"4.34am - 17:00 every day", "04:34 - 17:00 every day"},
+		{"1am to 11pm every thursday", "01:00 - 23:00 every thursday"},
+		{"9am - 5pm every weekday", "09:00 - 17:00 every weekday"},
+		{"10am - 4pm every weekend", "10:00 - 16:00 every weekend"},
+		{"1am to 2am every 1st of the month", "01:00 - 02:00 every 1st of the month"},
+		{"4am to 6am every 01/01 yearly", "04:00 - 06:00 every 01/01 yearly"},
+		{"1am - 2am on 01/01/2027", "01:00 - 02:00 on 01/01/2027"},
+		{"1am - 3am every second tuesday of the month", "01:00 - 03:00 every second tuesday of the month"},
+		{"2am - 4am every 2nd sunday of the month", "02:00 - 04:00 every second sunday of the month"},
+		{"6pm - 11pm every last friday of the month", "18:00 - 23:00 every last friday of the month"},
+		{"always except last day of the month", "always except last day of the month"},
+		{"12am - 12am every friday", "00:00 - 00:00 every friday"},
+		{"10pm to 4am every saturday where timezone = GMT", "22:00 - 04:00 every saturday where timezone = GMT"},
+		{"9am - 5pm every weekday where timezone = Europe/London", "09:00 - 17:00 every weekday where timezone = Europe/London"},
+		{"9am - 5pm every weekday and 10am - 2pm every saturday", "09:00 - 17:00 every weekday and 10:00 - 14:00 every saturday"},
+		{"always except 2-4am every sunday and except 1st of the month", "always except 02:00 - 04:00 every sunday and 1st of the month"},
+		{"9am - 5pm every weekday except 25/12 yearly and 12pm - 1pm every weekday", "09:00 - 17:00 every weekday except 25/12 yearly and 12:00 - 13:00 every weekday"},
+		{"for 5 minutes every hour", "for 5 minutes every 1 hour"},
+		{"for 15 minutes every 2 hours from 9am on weekday", "for 15 minutes every 2 hours from 09:00 on weekday"},
+		{"for 1 hour every 90 minutes", "for 1 hour every 90 minutes"},
+		{"9am - 5pm every weekday except calendar uk-holidays", "09:00 - 17:00 every weekday except calendar uk-holidays"},
+		{"10pm - 2am every calendar patch-days", "22:00 - 02:00 every calendar patch-days"},
+	}
+	for _, test := range tests {
+		window, err := Parse(test.definition)
+		if err != nil {
+			t.Errorf("%q: %v", test.definition, err)
+			continue
+		}
+		canonical := window.String()
+		if canonical != test.canonical {
+			t.Errorf("%q: expected the canonical form %q but was %q", test.definition, test.canonical, canonical)
+		}
+		reparsed, err := Parse(canonical)
+		if err != nil {
+			t.Errorf("%q: the canonical form %q does not parse: %v", test.definition, canonical, err)
+			continue
+		}
+		if !reflect.DeepEqual(reparsed.Periods, window.Periods) || !reflect.DeepEqual(reparsed.Exceptions, window.Exceptions) || reparsed.Timezone != window.Timezone {
+			t.Errorf("%q: expected %q to parse as %+v but was %+v", test.definition, canonical, window, reparsed)
+		}
+		if reparsed.String() != canonical {
+			t.Errorf("%q: expected the canonical form %q to be stable but was %q", test.definition, canonical, reparsed.String())
+		}
+	}
+}
+
+func TestExplainWindow(t *testing.T) {
+	from := time.Date(2026, time.October, 12, 12, 0, 0, 0, time.UTC)
+	explanation, err := ExplainWindow("9am to 5pm every weekday except 12pm - 1pm every friday", from, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Window != "09:00 - 17:00 every weekday except 12:00 - 13:00 every friday" {
+		t.Errorf("unexpected canonical form %q", explanation.Window)
+	}
+	if len(explanation.Definition.Periods) != 1 || len(explanation.Definition.Exceptions) != 1 {
+		t.Errorf("unexpected definition %+v", explanation.Definition)
+	}
+	at := func(day int, hour int) time.Time {
+		return time.Date(2026, time.October, day, hour, 0, 0, 0, time.UTC)
+	}
+	expected := []Interval{{at(12, 12), at(12, 17)}, {at(13, 9), at(13, 17)}, {at(14, 9), at(14, 17)}}
+	if !reflect.DeepEqual(explanation.Intervals, expected) {
+		t.Errorf("expected the intervals %v but was %v", expected, explanation.Intervals)
+	}
+
+	// the exception splits friday in two
+	explanation, _ = ExplainWindow("9am to 5pm every weekday except 12pm - 1pm every friday", at(16, 0), 3)
+	expected = []Interval{{at(16, 9), at(16, 12)}, {at(16, 13), at(16, 17)}, {at(19, 9), at(19, 17)}}
+	if !reflect.DeepEqual(explanation.Intervals, expected) {
+		t.Errorf("expected the intervals %v but was %v", expected, explanation.Intervals)
+	}
+
+	// a window which never opens has no intervals
+	if explanation, err = ExplainWindow("never", from, 3); err != nil || len(explanation.Intervals) != 0 {
+		t.Errorf("expected no intervals for a window which never opens but was %v (%v)", explanation.Intervals, err)
+	}
+
+	if _, err := ExplainWindow("9am to 5pm every blursday", from, 3); err == nil {
+		t.Error("expected an invalid window not to be explained")
+	}
+}
@@ -0,0 +1,294 @@
+package types
+
+import (
+	"errors"
+	"github.com/gocql/gocql"
+	"strings"
+)
+
+// Tags are key/value labels: a tag of the form key=value has that key and value and any other tag is a key with an
+// empty value.  Objects are selected by a Selector, a comma separated list of requirements all of which must be met:
+//
+//	env=prod           (or env==prod) the object has the key with the value
+//	env!=prod          the object does not have the key with the value (including objects without the key)
+//	team in (a,b)      the object has the key with one of the values
+//	team notin (a,b)   the object does not have the key with any of the values
+//	deprecated         the object has the key
+//	!deprecated        the object does not have the key
+const (
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorIn        = "in"
+	selectorNotIn     = "notin"
+	selectorExists    = "exists"
+	selectorNotExists = "!"
+)
+
+// A Selector selects objects by their tags (see ParseSelector).  The empty selector selects every object.
+type Selector struct {
+	requirements []selectorRequirement
+}
+
+type selectorRequirement struct {
+	key      string
+	operator string
+	values   []string
+}
+
+// splitTag returns the key and value of a tag
+func splitTag(tag string) (string, string) {
+	if idx := strings.Index(tag, "="); idx >= 0 {
+		return tag[:idx], tag[idx+1:]
+	}
+	return tag, ""
+}
+
+// TagSelector returns the selector of the objects with exactly the tag.  The tag is taken literally, so it may contain
+// characters (e.g. spaces, commas or further =) which a parsed selector may not.
+func TagSelector(tag string) Selector {
+	key, value := splitTag(tag)
+	return Selector{requirements: []selectorRequirement{{key: key, operator: selectorEquals, values: []string{value}}}}
+}
+
+// And returns the selector of the objects selected by both selectors
+func (s Selector) And(other Selector) Selector {
+	requirements := append([]selectorRequirement{}, s.requirements...)
+	return Selector{requirements: append(requirements, other.requirements...)}
+}
+
+// ParseSelector parses a selector such as "env=prod,team in (payments,ledger),!deprecated"
+func ParseSelector(selector string) (Selector, error) {
+	p := selectorParser{input: selector}
+	parsed := Selector{}
+	if strings.TrimSpace(selector) == "" {
+		return parsed, nil
+	}
+	for {
+		requirement, err := p.requirement()
+		if err != nil {
+			return Selector{}, err
+		}
+		parsed.requirements = append(parsed.requirements, requirement)
+		token := p.next()
+		if token == "" {
+			return parsed, nil
+		} else if token != "," {
+			return Selector{}, errors.New("Invalid selector: expected , but found " + describeToken(token))
+		}
+	}
+}
+
+// Empty determines if the selector selects every object
+func (s Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+// Matches determines if an object with the tags is selected
+func (s Selector) Matches(tags []string) bool {
+	labels := map[string][]string{}
+	for _, tag := range tags {
+		key, value := splitTag(tag)
+		labels[key] = append(labels[key], value)
+	}
+	for _, requirement := range s.requirements {
+		values, has := labels[requirement.key]
+		if !requirement.matches(values, has) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r selectorRequirement) matches(values []string, has bool) bool {
+	found := false
+	for _, value := range values {
+		if isStringInSlice(value, r.values) {
+			found = true
+		}
+	}
+	switch r.operator {
+	case selectorEquals, selectorIn:
+		return found
+	case selectorNotEquals, selectorNotIn:
+		return !found
+	case selectorExists:
+		return has
+	}
+	return !has
+}
+
+// candidates returns the objects of the type which meet one positive requirement of the selector (=, in or the key
+// exists), read from the tag index, so only those objects need be read and filtered (see filter).  A requirement
+// with values is preferred as only the rows of those values are read.  It returns false if the selector has no
+// positive requirement.
+func (s Selector) candidates(object string) ([]gocql.UUID, bool, error) {
+	requirement, ok := s.indexedRequirement()
+	if !ok {
+		return nil, false, nil
+	}
+	query := session.Query("select object_uuid from tag_index where type = ? and key = ?", object, requirement.key)
+	if requirement.operator != selectorExists {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(requirement.values)), ", ")
+		values := []interface{}{object, requirement.key}
+		for _, value := range requirement.values {
+			values = append(values, value)
+		}
+		query = session.Query("select object_uuid from tag_index where type = ? and key = ? and value in ("+placeholders+")", values...)
+	}
+	uuids := []gocql.UUID{}
+	seen := map[gocql.UUID]bool{}
+	var id gocql.UUID
+	iteration := query.Iter()
+	for iteration.Scan(&id) {
+		// an object with several values of the key is indexed under each
+		if !seen[id] {
+			seen[id] = true
+			uuids = append(uuids, id)
+		}
+	}
+	if err := iteration.Close(); err != nil {
+		return nil, true, err
+	}
+	return uuids, true, nil
+}
+
+// indexed determines if the objects selected are read from the tag index (see candidates)
+func (s Selector) indexed() bool {
+	_, ok := s.indexedRequirement()
+	return ok
+}
+
+// indexedRequirement returns the requirement by which candidates are read from the tag index
+func (s Selector) indexedRequirement() (selectorRequirement, bool) {
+	chosen := -1
+	for idx, requirement := range s.requirements {
+		switch requirement.operator {
+		case selectorEquals, selectorIn:
+			if chosen < 0 || s.requirements[chosen].operator == selectorExists {
+				chosen = idx
+			}
+		case selectorExists:
+			if chosen < 0 {
+				chosen = idx
+			}
+		}
+	}
+	if chosen < 0 {
+		return selectorRequirement{}, false
+	}
+	return s.requirements[chosen], true
+}
+
+// filter returns the objects, of those given, whose tags are selected.  The tags are read for the objects themselves
+// (a query per maxInClause objects) rather than from the index, so a negative requirement such as !deprecated does
+// not read every object with the key.
+func (s Selector) filter(uuids []gocql.UUID) (map[gocql.UUID]bool, error) {
+	selected := map[gocql.UUID]bool{}
+	tags, err := loadTags(uuids)
+	if err != nil {
+		return nil, err
+	}
+	for _, uuid := range uuids {
+		if s.Matches(tags[uuid]) {
+			selected[uuid] = true
+		}
+	}
+	return selected, nil
+}
+
+// a selectorParser reads the tokens of a selector: words (keys, values and the in and notin operators) and the
+// punctuation = == != ! , ( and )
+type selectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *selectorParser) next() string {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		return ""
+	}
+	start := p.pos
+	switch p.input[p.pos] {
+	case '=', '!':
+		p.pos++
+		if p.pos < len(p.input) && p.input[p.pos] == '=' {
+			p.pos++
+		}
+		return p.input[start:p.pos]
+	case ',', '(', ')':
+		p.pos++
+		return p.input[start:p.pos]
+	}
+	for p.pos < len(p.input) && !strings.ContainsRune(" =!,()", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *selectorParser) peek() string {
+	pos := p.pos
+	token := p.next()
+	p.pos = pos
+	return token
+}
+
+func isSelectorWord(token string) bool {
+	return token != "" && !strings.ContainsAny(token, " =!,()")
+}
+
+func (p *selectorParser) requirement() (selectorRequirement, error) {
+	token := p.next()
+	if token == "!" {
+		key := p.next()
+		if !isSelectorWord(key) {
+			return selectorRequirement{}, errors.New("Invalid selector: expected a key after !")
+		}
+		return selectorRequirement{key: key, operator: selectorNotExists}, nil
+	} else if !isSelectorWord(token) {
+		return selectorRequirement{}, errors.New("Invalid selector: expected a key but found " + describeToken(token))
+	}
+	requirement := selectorRequirement{key: token, operator: selectorExists}
+	switch operator := p.peek(); operator {
+	case "=", "==", "!=":
+		p.next()
+		requirement.operator = selectorEquals
+		if operator == "!=" {
+			requirement.operator = selectorNotEquals
+		}
+		// an empty value selects the tag without a value
+		value := ""
+		if isSelectorWord(p.peek()) {
+			value = p.next()
+		}
+		requirement.values = []string{value}
+	case selectorIn, selectorNotIn:
+		p.next()
+		requirement.operator = operator
+		if token := p.next(); token != "(" {
+			return selectorRequirement{}, errors.New("Invalid selector: expected ( after " + operator)
+		}
+		for {
+			value := p.next()
+			if !isSelectorWord(value) {
+				return selectorRequirement{}, errors.New("Invalid selector: expected a value but found " + describeToken(value))
+			}
+			requirement.values = append(requirement.values, value)
+			if token := p.next(); token == ")" {
+				break
+			} else if token != "," {
+				return selectorRequirement{}, errors.New("Invalid selector: expected , or ) but found " + describeToken(token))
+			}
+		}
+	}
+	return requirement, nil
+}
+
+func describeToken(token string) string {
+	if token == "" {
+		return "the end of the selector"
+	}
+	return token
+}
@@ -0,0 +1,154 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector     string
+		requirements []selectorRequirement
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"env=prod", []selectorRequirement{{"env", selectorEquals, []string{"prod"}}}},
+		{"env==prod", []selectorRequirement{{"env", selectorEquals, []string{"prod"}}}},
+		{"env != prod", []selectorRequirement{{"env", selectorNotEquals, []string{"prod"}}}},
+		{"env=", []selectorRequirement{{"env", selectorEquals, []string{""}}}},
+		{"team in (payments, ledger)", []selectorRequirement{{"team", selectorIn, []string{"payments", "ledger"}}}},
+		{"team notin (payments)", []selectorRequirement{{"team", selectorNotIn, []string{"payments"}}}},
+		{"deprecated", []selectorRequirement{{"deprecated", selectorExists, nil}}},
+		{"!deprecated", []selectorRequirement{{"deprecated", selectorNotExists, nil}}},
+		{"env=prod,team in (payments,ledger),!deprecated", []selectorRequirement{
+			{"env", selectorEquals, []string{"prod"}},
+			{"team", selectorIn, []string{"payments", "ledger"}},
+			{"deprecated", selectorNotExists, nil},
+		}},
+	}
+	for _, test := range tests {
+		selector, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Errorf("%q: %v", test.selector, err)
+			continue
+		}
+		if !reflect.DeepEqual(selector.requirements, test.requirements) {
+			t.Errorf("%q: expected %v but was %v", test.selector, test.requirements, selector.requirements)
+		}
+	}
+}
+
+func TestParseInvalidSelector(t *testing.T) {
+	for _, selector := range []string{"=prod", "!", "!=prod", "env=prod,", "env=prod team=a", "team in payments", "team in (payments", "team in ()", "team in (a,,b)", "env=(prod)", ","} {
+		if _, err := ParseSelector(selector); err == nil {
+			t.Errorf("%q: expected an error", selector)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	tags := []string{"env=prod", "team=payments", "deprecated", "region=eu", "region=us"}
+	tests := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env=dev", false},
+		{"env!=dev", true},
+		{"env!=prod", false},
+		{"owner!=alice", true},
+		{"team in (payments,ledger)", true},
+		{"team in (ledger)", false},
+		{"team notin (ledger)", true},
+		{"team notin (payments,ledger)", false},
+		{"owner notin (alice)", true},
+		{"deprecated", true},
+		{"deprecated=", true},
+		{"!deprecated", false},
+		{"!owner", true},
+		{"owner", false},
+		{"region=us", true},
+		{"region!=us", false},
+		{"env=prod,team in (payments),deprecated", true},
+		{"env=prod,!deprecated", false},
+	}
+	for _, test := range tests {
+		selector, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Errorf("%q: %v", test.selector, err)
+			continue
+		}
+		if selector.Matches(tags) != test.matches {
+			t.Errorf("%q: expected match to be %v", test.selector, test.matches)
+		}
+	}
+}
+
+func TestTagSelector(t *testing.T) {
+	tests := []struct {
+		tag   string
+		key   string
+		value string
+	}{
+		{"env=prod", "env", "prod"},
+		{"deprecated", "deprecated", ""},
+		{"dc2 west", "dc2 west", ""},
+		{"a=b=c", "a", "b=c"},
+		{"url=http://a/b?c=d", "url", "http://a/b?c=d"},
+		{"team=(payments, ledger)", "team", "(payments, ledger)"},
+		{"!important", "!important", ""},
+	}
+	for _, test := range tests {
+		selector := TagSelector(test.tag)
+		expected := []selectorRequirement{{test.key, selectorEquals, []string{test.value}}}
+		if !reflect.DeepEqual(selector.requirements, expected) {
+			t.Errorf("%q: expected %v but was %v", test.tag, expected, selector.requirements)
+		}
+		if !selector.Matches([]string{"other", test.tag}) {
+			t.Errorf("%q: expected the tag to be selected", test.tag)
+		}
+		if selector.Matches([]string{"other"}) {
+			t.Errorf("%q: expected an object without the tag not to be selected", test.tag)
+		}
+	}
+}
+
+func TestSelectorAnd(t *testing.T) {
+	selector, _ := ParseSelector("env=prod")
+	combined := selector.And(TagSelector("dc2 west"))
+	if !combined.Matches([]string{"env=prod", "dc2 west"}) {
+		t.Error("expected both requirements to be met")
+	}
+	if combined.Matches([]string{"env=prod"}) || combined.Matches([]string{"dc2 west"}) {
+		t.Error("expected both requirements to be required")
+	}
+	if len(selector.requirements) != 1 {
+		t.Error("expected And not to change the selector")
+	}
+}
+
+func TestSelectorIndexedRequirement(t *testing.T) {
+	tests := []struct {
+		selector string
+		key      string
+		indexed  bool
+	}{
+		{"", "", false},
+		{"env=prod", "env", true},
+		{"!deprecated,env!=prod,team notin (a)", "", false},
+		{"deprecated,team in (a,b)", "team", true},
+		{"!deprecated,deprecated", "deprecated", true},
+		{"env!=prod,team=a,env=prod", "team", true},
+	}
+	for _, test := range tests {
+		selector, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requirement, indexed := selector.indexedRequirement()
+		if indexed != test.indexed || requirement.key != test.key {
+			t.Errorf("%q: expected %q (%v) to be read from the index but was %q (%v)", test.selector, test.key, test.indexed, requirement.key, indexed)
+		}
+	}
+}
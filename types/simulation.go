@@ -0,0 +1,70 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+	"time"
+)
+
+const (
+	DefaultSimulationRange = 7 * 24 * time.Hour
+	MaxSimulationRange     = 92 * 24 * time.Hour
+
+	SimulationQueueOpen  = "QueueOpen"
+	SimulationQueueClose = "QueueClose"
+	SimulationTaskFires  = "TaskFires"
+	SimulationTaskMissed = "TaskMissed"
+
+	// the outcome of a pending task within the simulated range
+	SimulationFires   = "Fires"
+	SimulationMissed  = "Missed"
+	SimulationWaiting = "Waiting"
+)
+
+type SimulationRequest struct {
+	From      time.Time        `json:"from,omitempty" description:"The start of the simulation. Defaults to now"`
+	To        time.Time        `json:"to,omitempty" description:"The end of the simulation. Defaults to 7 days after the start, maximum of 92 days"`
+	Overrides []WindowOverride `json:"overrides,omitempty" description:"Windows of operation to use in place of those stored, e.g. a proposed downtime for /apps"`
+}
+
+// A WindowOverride replaces the window of operation of the queue with the given UUID, or of the queues at the given path
+type WindowOverride struct {
+	Queue  string `json:"queue,omitempty" description:"The UUID of the queue to override"`
+	Path   string `json:"path,omitempty" description:"The path of the queues to override"`
+	Window string `json:"window,required" description:"The window of operation to simulate"`
+}
+
+type Simulation struct {
+	From      time.Time         `json:"from,required" description:"The start of the simulation"`
+	To        time.Time         `json:"to,required" description:"The end of the simulation"`
+	Overrides []WindowOverride  `json:"overrides,omitempty" description:"The windows of operation which were overridden"`
+	Queues    []SimulatedQueue  `json:"queues,required" description:"The periods in which each queue would be open, taking containment into account"`
+	Tasks     []SimulatedTask   `json:"tasks,required" description:"When each pending task would fire"`
+	Timeline  []SimulationEvent `json:"timeline,required" description:"The queue and task events in time order"`
+}
+
+type SimulatedQueue struct {
+	UUID      gocql.UUID `json:"uuid,required" description:"The unique identifier of the queue"`
+	Name      string     `json:"name,omitempty" description:"The name of the queue"`
+	Paths     []string   `json:"paths,omitempty" description:"The paths of the queue"`
+	Window    string     `json:"window,required" description:"The window of operation used by the simulation"`
+	Intervals []Interval `json:"intervals,required" description:"The periods in which the queue would be open"`
+}
+
+type SimulatedTask struct {
+	UUID           gocql.UUID `json:"uuid,required" description:"The unique identifier of the task"`
+	Name           string     `json:"name,omitempty" description:"The name of the task"`
+	Queue          gocql.UUID `json:"queue,required" description:"The UUID of the hosting queue"`
+	When           time.Time  `json:"when,omitempty" description:"For async queues, the requested execution time"`
+	Outcome        string     `json:"outcome,required" description:"Fires, Missed (an async task whose queue is closed at its execution time) or Waiting (a sync task whose queue does not open)"`
+	FireAt         *time.Time `json:"fireAt,omitempty" description:"When the task would fire.  Sync tasks fire, in priority order, from this time"`
+	BaselineFireAt *time.Time `json:"baselineFireAt,omitempty" description:"When overrides are given, when the task would fire without them"`
+	Delayed        bool       `json:"delayed,omitempty" description:"True if the overrides delay (or prevent) the task"`
+}
+
+type SimulationEvent struct {
+	Time        time.Time   `json:"time,required" description:"The time of the event"`
+	Type        string      `json:"type,required" description:"QueueOpen, QueueClose, TaskFires or TaskMissed"`
+	Queue       gocql.UUID  `json:"queue,required" description:"The UUID of the queue"`
+	Task        *gocql.UUID `json:"task,omitempty" description:"The UUID of the task"`
+	Description string      `json:"description,omitempty" description:"A description of the event"`
+}
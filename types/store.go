@@ -0,0 +1,145 @@
+package types
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/relops/cqlr"
+	"strings"
+	"time"
+)
+
+// store wraps the Cassandra session so every query is timed and its failures counted (see MetricCassandraDuration).
+// Queries are created via session.Query and structs bound via session.Bind or Binding rather than cqlr directly.  A
+// query made Within a span is also traced as a child of that span.
+type store struct {
+	*gocql.Session
+	keyspace string
+}
+
+type storeQuery struct {
+	*gocql.Query
+	stmt   string
+	parent SpanContext
+}
+
+type storeBinding struct {
+	*cqlr.Binding
+	stmt    string
+	parent  SpanContext
+	scanned bool
+}
+
+func (s *store) Query(stmt string, values ...interface{}) *storeQuery {
+	return &storeQuery{Query: s.Session.Query(stmt, values...), stmt: stmt}
+}
+
+// Bind binds the fields of v to the statement, as cqlr.Bind
+func (s *store) Bind(stmt string, v interface{}) *storeBinding {
+	return &storeBinding{Binding: cqlr.Bind(stmt, v), stmt: stmt}
+}
+
+// Within traces the query as a child of the span (if it is valid)
+func (q *storeQuery) Within(parent SpanContext) *storeQuery {
+	q.parent = parent
+	return q
+}
+
+// Within traces the statement as a child of the span (if it is valid)
+func (b *storeBinding) Within(parent SpanContext) *storeBinding {
+	b.parent = parent
+	return b
+}
+
+func (q *storeQuery) Exec() error {
+	start := time.Now()
+	err := q.Query.Exec()
+	observeQuery(q.stmt, q.parent, start, err)
+	return err
+}
+
+func (q *storeQuery) Scan(dest ...interface{}) error {
+	start := time.Now()
+	err := q.Query.Scan(dest...)
+	observeQuery(q.stmt, q.parent, start, err)
+	return err
+}
+
+func (q *storeQuery) ScanCAS(dest ...interface{}) (bool, error) {
+	start := time.Now()
+	applied, err := q.Query.ScanCAS(dest...)
+	observeQuery(q.stmt, q.parent, start, err)
+	return applied, err
+}
+
+// Iter executes the query.  Only the first page of results is timed.
+func (q *storeQuery) Iter() *gocql.Iter {
+	start := time.Now()
+	iter := q.Query.Iter()
+	// Close only reports the error of the iterator; it may be called again by the caller
+	observeQuery(q.stmt, q.parent, start, iter.Close())
+	return iter
+}
+
+// Binding scans the rows of the query into structs, as cqlr.BindQuery
+func (q *storeQuery) Binding() *storeBinding {
+	return &storeBinding{Binding: cqlr.BindQuery(q.Query), stmt: q.stmt, parent: q.parent}
+}
+
+func (b *storeBinding) Exec() error {
+	start := time.Now()
+	err := b.Binding.Exec(session.Session)
+	observeQuery(b.stmt, b.parent, start, err)
+	return err
+}
+
+// Scan scans the next row into dest.  The query is executed (and timed) by the first scan.
+func (b *storeBinding) Scan(dest interface{}) bool {
+	if b.scanned {
+		return b.Binding.Scan(dest)
+	}
+	b.scanned = true
+	start := time.Now()
+	found := b.Binding.Scan(dest)
+	observeQuery(b.stmt, b.parent, start, b.Binding.Close())
+	return found
+}
+
+func observeQuery(stmt string, parent SpanContext, start time.Time, err error) {
+	operation, table := describeStatement(stmt)
+	MetricCassandraDuration.ObserveSince(start, operation, table)
+	failed := err != nil && err != gocql.ErrNotFound
+	if failed {
+		MetricCassandraErrors.Inc(operation, table)
+	}
+	if parent.Valid() {
+		span := StartSpan("cassandra "+operation+" "+table, SpanClient, parent)
+		span.Start = start
+		span.SetAttribute("db.system", "cassandra")
+		span.SetAttribute("db.operation", operation)
+		span.SetAttribute("db.cassandra.table", table)
+		span.SetAttribute("db.statement", stmt)
+		if failed {
+			span.SetError(err.Error())
+		}
+		span.Finish()
+	}
+}
+
+// describeStatement returns the operation (e.g. select) and the table of a CQL statement
+func describeStatement(stmt string) (string, string) {
+	words := strings.Fields(strings.ToLower(stmt))
+	if len(words) == 0 {
+		return "", ""
+	}
+	from := "from"
+	if words[0] == "insert" {
+		from = "into"
+	} else if words[0] == "update" {
+		from = "update"
+	}
+	for idx := 0; idx < len(words)-1; idx++ {
+		if words[idx] == from {
+			return words[0], strings.TrimSuffix(words[idx+1], ";")
+		}
+	}
+	return words[0], ""
+}
@@ -0,0 +1,315 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gocql/gocql"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DeliveryPending    = "Pending"
+	DeliveryDelivered  = "Delivered"
+	DeliveryDeadLetter = "DeadLetter"
+)
+
+// the delays between attempts to deliver an event.  once exhausted the delivery is dead-lettered
+var DeliveryBackoff = []time.Duration{10 * time.Second, 30 * time.Second, time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// successful deliveries are kept for this long (dead letters are kept until deleted)
+var DeliveredRetention = 7 * 24 * time.Hour
+
+// the subscriptions are cached so events are matched without reading every subscription (see RefreshSubscriptions)
+var subscriptionCache struct {
+	sync.Mutex
+	loaded        bool
+	subscriptions []Subscription
+}
+
+// A Subscription executes an action for every event matching its filter, e.g. every task failure beneath /apps
+type Subscription struct {
+	UUID       gocql.UUID  `cql:"subscription_uuid" json:"uuid,required" description:"The unique identifier of the subscription"`
+	Name       string      `cql:"name" json:"name,omitempty" description:"The name of the subscription"`
+	EventTypes []string    `cql:"event_types" json:"eventTypes,omitempty" description:"The types of event delivered, e.g. task.status.  Defaults to every type"`
+	Statuses   []string    `cql:"statuses" json:"statuses,omitempty" description:"Only deliver events with one of these statuses, e.g. Failure for failed tasks"`
+	PathPrefix string      `cql:"path_prefix" json:"pathPrefix,omitempty" description:"Only deliver events for queues at or beneath this path"`
+	Tags       []string    `cql:"tags" json:"tags,omitempty" description:"Only deliver events for tasks or queues with any of these tags"`
+	Action     *gocql.UUID `cql:"action_uuid" json:"action,required" description:"The unique identifier of the action executed for each event"`
+}
+
+// A Delivery records the delivery of a single event to a subscription.  Deliveries which fail are retried (see
+// DeliveryBackoff) and, once the retries are exhausted, kept as dead letters.
+type Delivery struct {
+	UUID         gocql.UUID `cql:"delivery_uuid" json:"uuid,required" description:"The unique identifier of the delivery"`
+	Subscription gocql.UUID `cql:"subscription_uuid" json:"subscription,required" description:"The subscription"`
+	Node         gocql.UUID `cql:"node_uuid" json:"node,required" description:"The node responsible for the delivery"`
+	Event        string     `cql:"event" json:"event,required" description:"The event (json)"`
+	Status       string     `cql:"status" json:"status,required" description:"Pending, Delivered or DeadLetter"`
+	Attempts     int        `cql:"attempts" json:"attempts" description:"The number of attempts made"`
+	NextAttempt  time.Time  `cql:"next_attempt" json:"nextAttempt,omitempty" description:"When the next attempt is due"`
+	LastError    string     `cql:"last_error" json:"lastError,omitempty" description:"The failure of the last attempt"`
+}
+
+// Query
+func GetSubscriptions() []Subscription {
+	query := session.Query("select * from subscriptions")
+	bind := query.Binding()
+	var subscription Subscription
+	subscriptions := []Subscription{}
+	for bind.Scan(&subscription) {
+		subscriptions = append(subscriptions, subscription)
+		subscription = Subscription{}
+	}
+	return subscriptions
+}
+
+// RefreshSubscriptions reloads the cached subscriptions.  Subscriptions changed on this node are refreshed immediately
+// and those changed on other nodes when dike next checks its pending deliveries.
+func RefreshSubscriptions() {
+	subscriptions := GetSubscriptions()
+	subscriptionCache.Lock()
+	defer subscriptionCache.Unlock()
+	subscriptionCache.subscriptions = subscriptions
+	subscriptionCache.loaded = true
+}
+
+// MatchingSubscriptions returns the cached subscriptions which match the event
+func MatchingSubscriptions(event Event) []Subscription {
+	subscriptionCache.Lock()
+	loaded := subscriptionCache.loaded
+	subscriptionCache.Unlock()
+	if !loaded {
+		RefreshSubscriptions()
+	}
+	subscriptionCache.Lock()
+	defer subscriptionCache.Unlock()
+	matching := []Subscription{}
+	for _, subscription := range subscriptionCache.subscriptions {
+		if subscription.Matches(event) {
+			matching = append(matching, subscription)
+		}
+	}
+	return matching
+}
+
+func GetSubscription(subscriptionUUID string) (Subscription, error) {
+	query := session.Query("select * from subscriptions where subscription_uuid = ?", subscriptionUUID)
+	bind := query.Binding()
+	var subscription Subscription
+	if !bind.Scan(&subscription) {
+		return Subscription{}, errors.New("Unknown subscription")
+	}
+	return subscription, nil
+}
+
+// CRUD
+func (subscription *Subscription) CreateOrUpdate() error {
+	if subscription.UUID.String() == "00000000-0000-0000-0000-000000000000" {
+		// subscription was generated from json with an unknown UUID.  Fix up
+		subscription.UUID = gocql.TimeUUID()
+	}
+	if subscription.Action == nil || subscription.Action.String() == "00000000-0000-0000-0000-000000000000" {
+		return errors.New("Unspecified action")
+	}
+	if _, err := GetAction(subscription.Action.String()); err != nil {
+		return errors.New("Unknown action")
+	}
+	for _, eventType := range subscription.EventTypes {
+		if !isStringInSlice(eventType, []string{EventTaskStatus, EventQueueOpened, EventQueuePaused, EventQueueClosed, EventQueueOwner, EventBackpressure}) {
+			return errors.New("Unknown event type: " + eventType)
+		}
+	}
+	if subscription.PathPrefix != "" && !strings.HasPrefix(subscription.PathPrefix, "/") {
+		return errors.New("The path prefix must begin with /")
+	}
+	bind := session.Bind(`insert into subscriptions (subscription_uuid, name, event_types, statuses, path_prefix, tags, action_uuid) values (?, ?, ?, ?, ?, ?, ?)`, subscription)
+	if err := bind.Exec(); err != nil {
+		return err
+	}
+	RefreshSubscriptions()
+	return nil
+}
+
+func (subscription Subscription) Delete() error {
+	if err := session.Query(`delete from subscriptions where subscription_uuid = ?`, subscription.UUID).Exec(); err != nil {
+		return err
+	}
+	RefreshSubscriptions()
+	return nil
+}
+
+// Matches determines if the event should be delivered to the subscription
+func (subscription Subscription) Matches(event Event) bool {
+	if len(subscription.EventTypes) > 0 && !isStringInSlice(event.Type, subscription.EventTypes) {
+		return false
+	}
+	if len(subscription.Statuses) > 0 && !isStringInSlice(event.Status, subscription.Statuses) {
+		return false
+	}
+	if len(subscription.Tags) > 0 {
+		tagged := false
+		for _, tag := range subscription.Tags {
+			if isStringInSlice(tag, event.Tags) {
+				tagged = true
+				break
+			}
+		}
+		if !tagged {
+			return false
+		}
+	}
+	return EventFilter{PathPrefix: subscription.PathPrefix}.Matches(event)
+}
+
+// Deliveries returns the deliveries of the subscription with the given status (or all deliveries)
+func (subscription Subscription) Deliveries(status string) []Delivery {
+	query := session.Query("select * from deliveries where subscription_uuid = ? allow filtering", subscription.UUID)
+	if status != "" {
+		query = session.Query("select * from deliveries where subscription_uuid = ? and status = ? allow filtering", subscription.UUID, status)
+	}
+	return scanDeliveries(query)
+}
+
+// NewDelivery records a pending delivery of the event to the subscription, to be attempted immediately by the node
+func NewDelivery(subscription Subscription, event Event, node gocql.UUID) (Delivery, error) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return Delivery{}, err
+	}
+	delivery := Delivery{UUID: gocql.TimeUUID(), Subscription: subscription.UUID, Node: node, Event: string(value), Status: DeliveryPending, NextAttempt: GetClock().Now()}
+	return delivery, delivery.create()
+}
+
+// GetPendingDeliveries returns the deliveries which have not yet succeeded or been dead-lettered.  They are found
+// through deliveries_by_status, which only holds pending deliveries, rather than by scanning every delivery.
+func GetPendingDeliveries() []Delivery {
+	uuids := []gocql.UUID{}
+	var id gocql.UUID
+	iteration := session.Query("select delivery_uuid from deliveries_by_status where status = ?", DeliveryPending).Iter()
+	for iteration.Scan(&id) {
+		uuids = append(uuids, id)
+	}
+	if err := iteration.Close(); err != nil {
+		return []Delivery{}
+	}
+	deliveries := []Delivery{}
+	for _, chunk := range inChunks(uuids) {
+		placeholders, values := inClause(chunk)
+		for _, delivery := range scanDeliveries(session.Query("select * from deliveries where delivery_uuid in ("+placeholders+")", values...)) {
+			if delivery.Status == DeliveryPending {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+	}
+	return deliveries
+}
+
+// Claim makes the node responsible for a delivery abandoned by another node (e.g. one which has stopped).  It
+// returns false if another node claimed it first.
+func (delivery *Delivery) Claim(node gocql.UUID) bool {
+	var current gocql.UUID
+	applied, err := session.Query(`update deliveries set node_uuid = ? where delivery_uuid = ? if node_uuid = ?`, node, delivery.UUID, delivery.Node).ScanCAS(&current)
+	if err != nil || !applied {
+		return false
+	}
+	delivery.Node = node
+	return true
+}
+
+// Attempt executes the action of the subscription for the event, recording the outcome.  A failed attempt is
+// rescheduled according to DeliveryBackoff or, once the retries are exhausted, dead-lettered.  lease is the time
+// allowed for the attempt before other checks may consider it due again.  Nothing is executed if another node has
+// claimed the delivery.
+func (delivery *Delivery) Attempt(lease time.Duration) bool {
+	delivery.NextAttempt = GetClock().Now().Add(lease)
+	if err := delivery.update(); err != nil {
+		log.WithFields(log.Fields{"delivery": delivery.UUID, "error": err}).Warn("Unable to attempt delivery")
+		return false
+	}
+	delivery.Attempts++
+	success := false
+	permanent := false
+	subscription, err := GetSubscription(delivery.Subscription.String())
+	if err != nil {
+		delivery.LastError = "Subscription deleted"
+		permanent = true
+	} else if action, err := GetAction(subscription.Action.String()); err != nil {
+		delivery.LastError = "Unknown action"
+		permanent = true
+	} else {
+		var event Event
+		json.Unmarshal([]byte(delivery.Event), &event)
+		success = action.ExecuteForEvent(event, delivery.Event)
+		delivery.LastError = action.Failure
+	}
+	switch {
+	case success:
+		delivery.Status = DeliveryDelivered
+	case permanent || delivery.Attempts > len(DeliveryBackoff):
+		delivery.Status = DeliveryDeadLetter
+	default:
+		delivery.NextAttempt = GetClock().Now().Add(DeliveryBackoff[delivery.Attempts-1])
+	}
+	if err := delivery.update(); err != nil {
+		// the delivery remains pending and is attempted again once its lease expires
+		log.WithFields(log.Fields{"delivery": delivery.UUID, "status": delivery.Status, "error": err}).Warn("Unable to record delivery attempt")
+	}
+	return success
+}
+
+// create records a new delivery.  Every write which sets the node of a delivery is a lightweight transaction, so an
+// attempt on one node never overwrites the claim of another.  The row is created by an update, rather than an insert,
+// so that no row marker remains once a delivered delivery has expired (see update).
+func (delivery Delivery) create() error {
+	var current gocql.UUID
+	applied, err := session.Query(`update deliveries set subscription_uuid = ?, node_uuid = ?, event = ?, status = ?, attempts = ?, next_attempt = ?, last_error = ? where delivery_uuid = ? if node_uuid = null`,
+		delivery.Subscription, delivery.Node, delivery.Event, delivery.Status, delivery.Attempts, delivery.NextAttempt, delivery.LastError, delivery.UUID).ScanCAS(&current)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errors.New("Delivery already recorded")
+	}
+	return delivery.index()
+}
+
+// update records the progress of a delivery, provided the node still owns it.  Every column is written so that, once
+// delivered, the whole delivery expires after DeliveredRetention.
+func (delivery Delivery) update() error {
+	ttl := 0
+	if delivery.Status == DeliveryDelivered {
+		ttl = int(DeliveredRetention.Seconds())
+	}
+	var current gocql.UUID
+	applied, err := session.Query(`update deliveries using ttl `+strconv.Itoa(ttl)+` set subscription_uuid = ?, node_uuid = ?, event = ?, status = ?, attempts = ?, next_attempt = ?, last_error = ? where delivery_uuid = ? if node_uuid = ?`,
+		delivery.Subscription, delivery.Node, delivery.Event, delivery.Status, delivery.Attempts, delivery.NextAttempt, delivery.LastError, delivery.UUID, delivery.Node).ScanCAS(&current)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errors.New("Delivery claimed by node " + current.String())
+	}
+	return delivery.index()
+}
+
+// index records whether the delivery is pending in deliveries_by_status
+func (delivery Delivery) index() error {
+	if delivery.Status == DeliveryPending {
+		return session.Query(`insert into deliveries_by_status (status, delivery_uuid) values (?, ?)`, DeliveryPending, delivery.UUID).Exec()
+	}
+	return session.Query(`delete from deliveries_by_status where status = ? and delivery_uuid = ?`, DeliveryPending, delivery.UUID).Exec()
+}
+
+func scanDeliveries(query *storeQuery) []Delivery {
+	bind := query.Binding()
+	var delivery Delivery
+	deliveries := []Delivery{}
+	for bind.Scan(&delivery) {
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries
+}
@@ -0,0 +1,43 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestSubscriptionMatches(t *testing.T) {
+	failure := Event{Type: EventTaskStatus, Status: "Failure", Paths: []string{"/apps/billing"}, Tags: []string{"team:payments", "critical"}}
+	opened := Event{Type: EventQueueOpened, Paths: []string{"/infra", "/apps/web"}}
+	untagged := Event{Type: EventTaskStatus, Status: "Success"}
+	tests := []struct {
+		name         string
+		subscription Subscription
+		event        Event
+		expected     bool
+	}{
+		{"every event", Subscription{}, failure, true},
+		{"every event without paths", Subscription{}, untagged, true},
+		{"matching type", Subscription{EventTypes: []string{EventQueueOpened, EventTaskStatus}}, failure, true},
+		{"other type", Subscription{EventTypes: []string{EventQueueOpened}}, failure, false},
+		{"matching status", Subscription{Statuses: []string{"Failure"}}, failure, true},
+		{"other status", Subscription{Statuses: []string{"Failure"}}, untagged, false},
+		{"type and status", Subscription{EventTypes: []string{EventTaskStatus}, Statuses: []string{"Success"}}, failure, false},
+		{"path itself", Subscription{PathPrefix: "/apps/billing"}, failure, true},
+		{"beneath the path", Subscription{PathPrefix: "/apps"}, failure, true},
+		{"beneath the path with a trailing slash", Subscription{PathPrefix: "/apps/"}, failure, true},
+		{"path which only shares a prefix", Subscription{PathPrefix: "/app"}, failure, false},
+		{"another path", Subscription{PathPrefix: "/infra"}, failure, false},
+		{"one of several paths", Subscription{PathPrefix: "/apps"}, opened, true},
+		{"root", Subscription{PathPrefix: "/"}, opened, true},
+		{"path prefix without paths", Subscription{PathPrefix: "/apps"}, untagged, false},
+		{"one of the tags", Subscription{Tags: []string{"other", "critical"}}, failure, true},
+		{"none of the tags", Subscription{Tags: []string{"other"}}, failure, false},
+		{"tags of an untagged event", Subscription{Tags: []string{"critical"}}, untagged, false},
+		{"every filter", Subscription{EventTypes: []string{EventTaskStatus}, Statuses: []string{"Failure"}, PathPrefix: "/apps", Tags: []string{"critical"}}, failure, true},
+		{"every filter but the tags", Subscription{EventTypes: []string{EventTaskStatus}, Statuses: []string{"Failure"}, PathPrefix: "/apps", Tags: []string{"other"}}, failure, false},
+	}
+	for _, test := range tests {
+		if matches := test.subscription.Matches(test.event); matches != test.expected {
+			t.Errorf("%s: expected matches to be %v", test.name, test.expected)
+		}
+	}
+}
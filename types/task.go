@@ -4,7 +4,8 @@ import (
 	"errors"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gocql/gocql"
-	"github.com/relops/cqlr"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -30,15 +31,18 @@ type Task struct {
 	PromiseAction   *gocql.UUID `cql:"promise_action" json:"promise,omitempty" description:"The unique identifier of the promise, executed on successful completion of the execution action"`
 	ExecutionAction *gocql.UUID `cql:"execution_action" json:"execution,required" description:"The unique identifier of the executing action"`
 	Status          string      `cql:"status" json:"status,required" description:"The status of the task (Pending/Running/Complete/Failed/Partially Failed)"`
+	Traceparent     string      `cql:"traceparent" json:"traceparent,omitempty" description:"The W3C trace context of the request which created the task.  Its execution is traced as part of the same trace"`
 	OurTags         []string    `json:"tags,omitempty" description:"Tags assigned to the task."`
 	Promise         Action      `json:"-"`
 	Execution       Action      `json:"-"`
 	previousStatus  string		`json:"-"`
+	span            SpanContext `json:"-"`
+	decision        SpanContext `json:"-"`
 }
 
 func GetTasks() []Task {
 	query := session.Query("select * from tasks")
-	bind := cqlr.BindQuery(query)
+	bind := query.Binding()
 	var task Task
 	tasks := []Task{}
 	for bind.Scan(&task) {
@@ -48,41 +52,83 @@ func GetTasks() []Task {
 	return tasks
 }
 
-func GetTasksByTag(tag string) []Task {
+
+var taskSource = listSource{
+	table:   "tasks",
+	key:     "task_uuid",
+	object:  "task",
+	columns: "task_uuid, queue_uuid, name, priority, when, status",
+	sorts:   []string{SortWhen, SortPriority, SortName},
+	timed:   true,
+	row:     func() interface{} { return &Task{} },
+	item: func(row interface{}) listItem {
+		task := row.(*Task)
+		return listItem{UUID: task.UUID, Status: task.Status, Queue: task.Queue, Name: task.Name, When: task.When, Priority: task.Priority}
+	},
+	partitions: queueTaskUUIDs,
+}
+
+// queueTaskUUIDs returns the UUIDs of the tasks of the queue with any of the statuses (all if none are given)
+func queueTaskUUIDs(queue gocql.UUID, statuses []string) ([]gocql.UUID, error) {
+	uuids := []gocql.UUID{}
+	q, err := GetQueue(queue.String())
+	if err != nil {
+		// an unknown queue has no tasks
+		return uuids, nil
+	}
+	table := "async_tasks"
+	if q.QueueType == QueueSync {
+		table = "sync_tasks"
+	}
+	if len(statuses) == 0 {
+		statuses = []string{TaskPending, TaskRunning, TaskComplete, TaskFailed, TaskPartiallyFailed, TaskDeleted}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")
+	values := []interface{}{queue}
+	for _, status := range statuses {
+		values = append(values, status)
+	}
 	var id gocql.UUID
-	var task Task
-	tasks := []Task{}
-	iteration := session.Query("select object_uuid from tags where type = 'task' and tag = ? allow filtering", tag).Iter()
+	iteration := session.Query("select task_uuid from "+table+" where queue_uuid = ? and status in ("+placeholders+")", values...).Iter()
 	for iteration.Scan(&id) {
-		q := session.Query("select * from tasks where task_uuid = ?", id)
-		b := cqlr.BindQuery(q)
-		b.Scan(&task)
-		task.LoadTags()
-		tasks = append(tasks, task)
+		uuids = append(uuids, id)
 	}
-	return tasks
+	if err := iteration.Close(); err != nil {
+		return nil, err
+	}
+	return uuids, nil
 }
 
-func GetTasksByQueue(queue string) []Task {
-	var id gocql.UUID
-	var task Task
+// ListTasks returns a page of the tasks matching the options
+func ListTasks(options ListOptions) ([]Task, ListPage, error) {
+	items, page, err := taskSource.list(options)
+	if err != nil {
+		return nil, page, err
+	}
+	loaded := map[gocql.UUID]Task{}
+	for _, chunk := range inChunks(itemUUIDs(items)) {
+		placeholders, values := inClause(chunk)
+		bind := session.Query("select * from tasks where task_uuid in ("+placeholders+")", values...).Binding()
+		var task Task
+		for bind.Scan(&task) {
+			loaded[task.UUID] = task
+		}
+		if err := bind.Close(); err != nil {
+			return nil, page, err
+		}
+	}
+	tags, err := loadTags(itemUUIDs(items))
+	if err != nil {
+		return nil, page, err
+	}
 	tasks := []Task{}
-	q, err := GetQueue(queue)
-	if err == nil {
-		table := "async_tasks"
-		if q.QueueType == QueueSync {
-			table = "sync_tasks"
-		}
-		iteration := session.Query("select task_uuid from ? where queue_uuid = ? and status in ('Pending', 'Running', 'Complete', 'Failure', 'Partially Failed', 'Deleted')", table, queue).Iter()
-		for iteration.Scan(&id) {
-			q := session.Query("select * from tasks where task_uuid = ?", id)
-			b := cqlr.BindQuery(q)
-			b.Scan(&task)
-			task.LoadTags()
+	for _, item := range items {
+		if task, ok := loaded[item.UUID]; ok {
+			task.OurTags = tags[task.UUID]
 			tasks = append(tasks, task)
 		}
 	}
-	return tasks
+	return tasks, page, nil
 }
 
 func GetTask(taskUUID string) (Task, error) {
@@ -90,8 +136,8 @@ func GetTask(taskUUID string) (Task, error) {
 	return bindActionsToTask(query)
 }
 
-func bindActionsToTask(query *gocql.Query) (Task, error) {
-	bind := cqlr.BindQuery(query)
+func bindActionsToTask(query *storeQuery) (Task, error) {
+	bind := query.Binding()
 	var task Task
 	if !bind.Scan(&task) {
 		return Task{}, errors.New("Unknown task")
@@ -138,8 +184,8 @@ func (task *Task) CreateOrUpdate() error {
 			task.When = time.Date(1975, time.January, 0, 0, 0, 0, 0, time.UTC)
 		}
 		task.CreateOrUpdateTags()
-		bind := cqlr.Bind(`insert into tasks (task_uuid, queue_uuid, execution_action, name, priority, promise_action, status, when) values (?, ?, ?, ?, ?, ?, ?, ?)`, task)
-		if err := bind.Exec(session); err != nil {
+		bind := session.Bind(`insert into tasks (task_uuid, queue_uuid, execution_action, name, priority, promise_action, status, when, traceparent) values (?, ?, ?, ?, ?, ?, ?, ?, ?)`, task)
+		if err := bind.Within(task.span).Exec(); err != nil {
 			return err
 		}
 		return task.createOrUpdateInSubTables()
@@ -158,12 +204,26 @@ func (task Task) createOrUpdateInSubTables() error {
 			dQuery = session.Query(`delete from sync_tasks where queue_uuid = ? and status = ? and priority = ? and task_uuid = ?`, task.Queue, task.previousStatus, task.Priority, task.UUID)
 			iQuery = session.Query(`insert into sync_tasks (queue_uuid, status, priority, task_uuid) values (?, ?, ?, ?)`, task.Queue, task.Status, task.Priority, task.UUID)
 		}
-		if err := iQuery.Exec(); err != nil {
+		if err := iQuery.Within(task.span).Exec(); err != nil {
 			return err
 		}
-		if err := dQuery.Exec(); err != nil {
+		if err := dQuery.Within(task.span).Exec(); err != nil {
 			return err
 		}
+		event := NewQueueEvent(EventTaskStatus, q)
+		taskUUID := task.UUID
+		event.Task = &taskUUID
+		event.Status = task.Status
+		event.Detail = task.previousStatus
+		for _, tag := range task.OurTags {
+			if !isStringInSlice(tag, event.Tags) {
+				event.Tags = append(event.Tags, tag)
+			}
+		}
+		PublishEvent(event)
+		if (task.previousStatus == TaskPending || task.previousStatus == TaskRunning) && (task.Status == TaskComplete || task.Status == TaskFailed || task.Status == TaskPartiallyFailed) {
+			MetricTaskExecutions.Inc(task.Queue.String(), task.Status)
+		}
 	}
 	return nil
 }
@@ -171,7 +231,7 @@ func (task Task) createOrUpdateInSubTables() error {
 func (task Task) Delete() error {
 	task.DeleteTags()
 	task.Status = TaskDeleted
-	if err := session.Query(`update tasks set status = ? where task_uuid = ?`, task.Status, task.UUID).Exec(); err != nil {
+	if err := session.Query(`update tasks set status = ? where task_uuid = ?`, task.Status, task.UUID).Within(task.span).Exec(); err != nil {
 		return err
 	}
 	return task.createOrUpdateInSubTables()
@@ -195,8 +255,35 @@ func (t Task) DeleteTags() {
 	DeleteTagsForObject(t.UUID)
 }
 
+// Trace records the span within which the task is created or updated; the store calls which follow are traced as its
+// children.  A new task keeps the span as its traceparent (unless one was given) so its execution joins the trace.
+func (t *Task) Trace(span SpanContext) {
+	t.span = span
+	if t.Traceparent == "" {
+		t.Traceparent = span.Traceparent()
+	}
+}
+
+// startSpan starts a span for the execution of the task within the trace of the request which created it, linked to
+// the queue transition (if known) which led to its execution
+func (t *Task) startSpan(name string) *Span {
+	span := StartSpan(name, SpanInternal, ParseTraceparent(t.Traceparent))
+	span.AddLink(t.decision)
+	span.SetAttribute("horae.task.uuid", t.UUID.String())
+	if t.Queue != nil {
+		span.SetAttribute("horae.queue.uuid", t.Queue.String())
+	}
+	t.span = span.Context
+	return span
+}
+
 func (t *Task) Execute(sync bool) bool {
+	startWork()
+	defer finishWork()
 	log.WithFields(log.Fields{"task": t.UUID}).Info("Executing Task Action")
+	span := t.startSpan("Task.Execute")
+	span.SetAttribute("horae.queue.sync", strconv.FormatBool(sync))
+	defer span.Finish()
 	success := false
 	if t.ExecutionAction != nil && t.ExecutionAction.String() != "00000000-0000-0000-0000-000000000000" {
 		t.previousStatus = t.Status
@@ -217,7 +304,9 @@ func (t *Task) Execute(sync bool) bool {
 	if !sync {
 		t.ExecutePromise()
 	}
+	span.SetAttribute("horae.task.status", t.Status)
 	if t.Status == TaskFailed {
+		span.SetError("Task failed")
 		return false
 	} else {
 		return true
@@ -225,11 +314,18 @@ func (t *Task) Execute(sync bool) bool {
 }
 
 func (t *Task) ExecutePromise() {
+	startWork()
+	defer finishWork()
 	success := false
 	if t.PromiseAction != nil && t.PromiseAction.String() != "00000000-0000-0000-0000-000000000000" {
 		t.previousStatus = t.Status
 		log.WithFields(log.Fields{"task": t.UUID}).Info("Executing Task Promise")
+		span := t.startSpan("Task.ExecutePromise")
+		defer span.Finish()
 		success = t.Promise.Execute(t)
+		if !success {
+			span.SetError("Promise failed")
+		}
 		if t.Status == TaskFailed && success {
 			t.Status = TaskPartiallyFailed
 		} else if t.Status == TaskComplete && !success {
@@ -0,0 +1,143 @@
+package types
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// the kinds of span, as defined by OpenTelemetry
+const (
+	SpanInternal = 1
+	SpanServer   = 2
+	SpanClient   = 3
+)
+
+// TraceparentHeader is the W3C trace context header propagated on API requests and outbound actions
+const TraceparentHeader = "traceparent"
+
+// A SpanContext identifies a span within a trace.  The zero value is not valid and identifies no span.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// A Span records a unit of work: an API request, a queue transition, the execution of a task or action or a store
+// call.  Spans are exported (see SetSpanExporter) once finished.
+type Span struct {
+	Name       string
+	Kind       int
+	Context    SpanContext
+	Parent     SpanContext
+	Links      []SpanContext
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Failed     bool
+	Message    string
+}
+
+// StartSpan starts a span.  If the parent is valid the span joins its trace, otherwise a new trace is started.
+func StartSpan(name string, kind int, parent SpanContext) *Span {
+	span := &Span{Name: name, Kind: kind, Parent: parent, Start: time.Now(), Attributes: map[string]string{}}
+	if parent.Valid() {
+		span.Context.TraceID = parent.TraceID
+		span.Context.Sampled = parent.Sampled
+	} else {
+		rand.Read(span.Context.TraceID[:])
+		span.Context.Sampled = true
+	}
+	rand.Read(span.Context.SpanID[:])
+	return span
+}
+
+func (s *Span) SetAttribute(key string, value string) {
+	s.Attributes[key] = value
+}
+
+// AddLink relates the span to another, e.g. the execution of a task to the queue transition which started it
+func (s *Span) AddLink(other SpanContext) {
+	if other.Valid() {
+		s.Links = append(s.Links, other)
+	}
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	s.Failed = true
+	s.Message = message
+}
+
+// Finish ends the span and passes it to the exporter
+func (s *Span) Finish() {
+	s.End = time.Now()
+	if s.Context.Sampled {
+		exportSpan(s)
+	}
+}
+
+func (c SpanContext) Valid() bool {
+	return c.TraceID != [16]byte{} && c.SpanID != [8]byte{}
+}
+
+// Traceparent returns the span context as a W3C traceparent, or an empty string if it is not valid
+func (c SpanContext) Traceparent() string {
+	if !c.Valid() {
+		return ""
+	}
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(c.TraceID[:]) + "-" + hex.EncodeToString(c.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent (version 00, or a later version which starts with the same fields).  The
+// span context is not valid if the traceparent is malformed.
+func ParseTraceparent(traceparent string) SpanContext {
+	var c SpanContext
+	elements := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(elements) < 4 || len(elements[0]) != 2 || elements[0] == "ff" || (elements[0] == "00" && len(elements) != 4) {
+		return SpanContext{}
+	}
+	for _, element := range elements[:4] {
+		if !isLowerHex(element) {
+			// the fields are lower case hex only
+			return SpanContext{}
+		}
+	}
+	version, err := hex.DecodeString(elements[0])
+	if err != nil || len(version) != 1 {
+		return SpanContext{}
+	}
+	traceID, err := hex.DecodeString(elements[1])
+	if err != nil || len(traceID) != 16 {
+		return SpanContext{}
+	}
+	spanID, err := hex.DecodeString(elements[2])
+	if err != nil || len(spanID) != 8 {
+		return SpanContext{}
+	}
+	flags, err := hex.DecodeString(elements[3])
+	if err != nil || len(flags) != 1 {
+		return SpanContext{}
+	}
+	copy(c.TraceID[:], traceID)
+	copy(c.SpanID[:], spanID)
+	c.Sampled = flags[0]&1 == 1
+	if !c.Valid() {
+		return SpanContext{}
+	}
+	return c
+}
+
+func isLowerHex(value string) bool {
+	for _, r := range value {
+		if !(r >= '0' && r <= '9') && !(r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,241 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterOTLP   = "otlp"
+
+	// finished spans are exported in batches of up to spanBatchSize, at least every spanBatchInterval
+	spanBatchSize     = 100
+	spanBatchInterval = 5 * time.Second
+	// the number of spans which may wait to be exported before further spans are dropped
+	spanBacklog = 1000
+)
+
+// A SpanExporter sends finished spans to a collector
+type SpanExporter interface {
+	ExportSpans(spans []*Span) error
+}
+
+var spanCh chan *Span
+
+// InitTracing starts exporting spans as configured (-trace-exporter).  Until it is called spans are dropped, although
+// trace context is still propagated.
+func InitTracing(node Node) error {
+	resource := map[string]string{"service.name": "horae", "service.instance.id": node.UUID.String(), "horae.cluster": node.Cluster}
+	switch Configuration.TraceExporter {
+	case "", TraceExporterNone:
+		return nil
+	case TraceExporterStdout:
+		SetSpanExporter(&StdoutExporter{Writer: os.Stdout})
+	case TraceExporterOTLP:
+		SetSpanExporter(&OTLPExporter{Endpoint: Configuration.TraceEndpoint, Resource: resource})
+	default:
+		return errors.New("Unknown trace exporter " + Configuration.TraceExporter + " (expected none, stdout or otlp)")
+	}
+	log.WithFields(log.Fields{"exporter": Configuration.TraceExporter}).Info("Exporting traces")
+	return nil
+}
+
+// SetSpanExporter exports every finished span with the exporter
+func SetSpanExporter(exporter SpanExporter) {
+	ch := make(chan *Span, spanBacklog)
+	go exportSpans(exporter, ch)
+	spanCh = ch
+}
+
+func exportSpan(span *Span) {
+	if spanCh == nil {
+		return
+	}
+	select {
+	case spanCh <- span:
+	default:
+		// the exporter has fallen behind
+	}
+}
+
+func exportSpans(exporter SpanExporter, ch chan *Span) {
+	ticker := time.NewTicker(spanBatchInterval)
+	batch := []*Span{}
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := exporter.ExportSpans(batch); err != nil {
+			log.WithFields(log.Fields{"spans": len(batch), "error": err}).Warn("Unable to export spans")
+		}
+		batch = []*Span{}
+	}
+	for {
+		select {
+		case span := <-ch:
+			batch = append(batch, span)
+			if len(batch) >= spanBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// StdoutExporter writes each span as a line of json
+type StdoutExporter struct {
+	Writer io.Writer
+}
+
+type stdoutSpan struct {
+	TraceID    string            `json:"traceId"`
+	SpanID     string            `json:"spanId"`
+	ParentID   string            `json:"parentSpanId,omitempty"`
+	Links      []string          `json:"links,omitempty"`
+	Name       string            `json:"name"`
+	Kind       int               `json:"kind"`
+	Start      time.Time         `json:"start"`
+	Duration   string            `json:"duration"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+func (e *StdoutExporter) ExportSpans(spans []*Span) error {
+	encoder := json.NewEncoder(e.Writer)
+	for _, span := range spans {
+		line := stdoutSpan{TraceID: hex.EncodeToString(span.Context.TraceID[:]), SpanID: hex.EncodeToString(span.Context.SpanID[:]), Name: span.Name, Kind: span.Kind, Start: span.Start, Duration: span.End.Sub(span.Start).String(), Attributes: span.Attributes}
+		if span.Parent.Valid() {
+			line.ParentID = hex.EncodeToString(span.Parent.SpanID[:])
+		}
+		for _, link := range span.Links {
+			line.Links = append(line.Links, link.Traceparent())
+		}
+		if span.Failed {
+			line.Error = span.Message
+			if line.Error == "" {
+				line.Error = "failed"
+			}
+		}
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OTLPExporter posts spans to an OpenTelemetry collector using OTLP/HTTP with json encoding, e.g. to
+// http://127.0.0.1:4318/v1/traces
+type OTLPExporter struct {
+	Endpoint string
+	Resource map[string]string
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value otlpAttrString `json:"value"`
+}
+
+type otlpAttrString struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *OTLPExporter) ExportSpans(spans []*Span) error {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/kieranbroadfoot/horae"}}
+	for _, span := range spans {
+		converted := otlpSpan{TraceID: hex.EncodeToString(span.Context.TraceID[:]), SpanID: hex.EncodeToString(span.Context.SpanID[:]), Name: span.Name, Kind: span.Kind, StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10), EndTimeUnixNano: strconv.FormatInt(span.End.UnixNano(), 10), Attributes: otlpAttributes(span.Attributes)}
+		if span.Parent.Valid() {
+			converted.ParentSpanID = hex.EncodeToString(span.Parent.SpanID[:])
+		}
+		for _, link := range span.Links {
+			converted.Links = append(converted.Links, otlpLink{TraceID: hex.EncodeToString(link.TraceID[:]), SpanID: hex.EncodeToString(link.SpanID[:])})
+		}
+		if span.Failed {
+			// STATUS_CODE_ERROR
+			converted.Status = otlpStatus{Code: 2, Message: span.Message}
+		}
+		scope.Spans = append(scope.Spans, converted)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{Resource: otlpResource{Attributes: otlpAttributes(e.Resource)}, ScopeSpans: []otlpScopeSpans{scope}}}})
+	if err != nil {
+		return err
+	}
+	response, err := http.Post(e.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return errors.New("collector returned " + response.Status)
+	}
+	return nil
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := []string{}
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	converted := []otlpAttribute{}
+	for _, key := range keys {
+		converted = append(converted, otlpAttribute{Key: key, Value: otlpAttrString{StringValue: attributes[key]}})
+	}
+	return converted
+}
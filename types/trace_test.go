@@ -0,0 +1,152 @@
+package types
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// spanContext builds a span context from its hex trace and span ids
+func spanContext(t *testing.T, traceID string, spanID string, sampled bool) SpanContext {
+	c := SpanContext{Sampled: sampled}
+	trace, err := hex.DecodeString(traceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	span, err := hex.DecodeString(spanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(c.TraceID[:], trace)
+	copy(c.SpanID[:], span)
+	return c
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		valid       bool
+		sampled     bool
+	}{
+		{"sampled", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true, true},
+		{"not sampled", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00", true, false},
+		{"other flags", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-03", true, true},
+		{"surrounding whitespace", " 00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01 ", true, true},
+		{"later version", "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true, true},
+		{"later version with further fields", "cc-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-what-the-future-holds", true, true},
+		{"version ff", "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", false, false},
+		{"version 00 with further fields", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra", false, false},
+		{"upper case version", "0A-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", false, false},
+		{"upper case trace id", "00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01", false, false},
+		{"upper case span id", "00-0af7651916cd43dd8448eb211c80319c-B7AD6B7169203331-01", false, false},
+		{"upper case flags", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-0F", false, false},
+		{"all zero trace id", "00-00000000000000000000000000000000-b7ad6b7169203331-01", false, false},
+		{"all zero span id", "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", false, false},
+		{"short trace id", "00-0af7651916cd43dd8448eb211c8031-b7ad6b7169203331-01", false, false},
+		{"long span id", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b716920333100-01", false, false},
+		{"not hex", "00-0af7651916cd43dd8448eb211c80319g-b7ad6b7169203331-01", false, false},
+		{"short version", "0-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", false, false},
+		{"missing flags", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331", false, false},
+		{"empty", "", false, false},
+	}
+	for _, test := range tests {
+		c := ParseTraceparent(test.traceparent)
+		if c.Valid() != test.valid || c.Sampled != test.sampled {
+			t.Errorf("%s: expected valid %v and sampled %v but was %+v", test.name, test.valid, test.sampled, c)
+			continue
+		}
+		if test.valid {
+			expected := spanContext(t, "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331", test.sampled)
+			if c != expected {
+				t.Errorf("%s: expected %+v but was %+v", test.name, expected, c)
+			}
+		}
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		c := spanContext(t, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", sampled)
+		if parsed := ParseTraceparent(c.Traceparent()); parsed != c {
+			t.Errorf("expected %q to parse as %+v but was %+v", c.Traceparent(), c, parsed)
+		}
+	}
+	if traceparent := (SpanContext{}).Traceparent(); traceparent != "" {
+		t.Errorf("expected no traceparent for an invalid span context but was %q", traceparent)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body string
+	var contentType string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := ioutil.ReadAll(r.Body)
+		body = string(received)
+		contentType = r.Header.Get("Content-Type")
+	}))
+	defer collector.Close()
+
+	start := time.Date(2026, time.October, 12, 9, 0, 0, 0, time.UTC)
+	request := &Span{
+		Name:       "GET /v1/queue",
+		Kind:       SpanServer,
+		Context:    spanContext(t, "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331", true),
+		Start:      start,
+		End:        start.Add(1500 * time.Millisecond),
+		Attributes: map[string]string{"http.route": "/v1/queue", "http.method": "GET"},
+	}
+	execution := &Span{
+		Name:       "execute task",
+		Kind:       SpanInternal,
+		Context:    spanContext(t, "0af7651916cd43dd8448eb211c80319c", "00f067aa0ba902b7", true),
+		Parent:     request.Context,
+		Links:      []SpanContext{spanContext(t, "4bf92f3577b34da6a3ce929d0e0e4736", "53995c3f42cd8ad8", true)},
+		Start:      start.Add(250 * time.Millisecond),
+		End:        start.Add(1250 * time.Millisecond),
+		Attributes: map[string]string{},
+		Failed:     true,
+		Message:    "exit status 1",
+	}
+	exporter := &OTLPExporter{Endpoint: collector.URL + "/v1/traces", Resource: map[string]string{"service.name": "horae", "service.instance.id": "node"}}
+	if err := exporter.ExportSpans([]*Span{request, execution}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		`{"resourceSpans":[{`,
+		`"resource":{"attributes":[{"key":"service.instance.id","value":{"stringValue":"node"}},{"key":"service.name","value":{"stringValue":"horae"}}]},`,
+		`"scopeSpans":[{"scope":{"name":"github.com/kieranbroadfoot/horae"},"spans":[`,
+		`{"traceId":"0af7651916cd43dd8448eb211c80319c","spanId":"b7ad6b7169203331","name":"GET /v1/queue","kind":2,`,
+		`"startTimeUnixNano":"1791795600000000000","endTimeUnixNano":"1791795601500000000",`,
+		`"attributes":[{"key":"http.method","value":{"stringValue":"GET"}},{"key":"http.route","value":{"stringValue":"/v1/queue"}}],`,
+		`"status":{}},`,
+		`{"traceId":"0af7651916cd43dd8448eb211c80319c","spanId":"00f067aa0ba902b7","parentSpanId":"b7ad6b7169203331","name":"execute task","kind":1,`,
+		`"startTimeUnixNano":"1791795600250000000","endTimeUnixNano":"1791795601250000000",`,
+		`"links":[{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"53995c3f42cd8ad8"}],`,
+		`"status":{"code":2,"message":"exit status 1"}}`,
+		`]}]}]}`,
+	}, "")
+	if body != expected {
+		t.Errorf("expected the payload:\n%s\nbut was:\n%s", expected, body)
+	}
+	if contentType != "application/json" {
+		t.Errorf("expected a json payload but was %q", contentType)
+	}
+}
+
+func TestOTLPExporterCollectorFailure(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+	exporter := &OTLPExporter{Endpoint: collector.URL}
+	span := &Span{Name: "span", Context: spanContext(t, "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331", true)}
+	if err := exporter.ExportSpans([]*Span{span}); err == nil {
+		t.Error("expected a failure of the collector to be returned")
+	}
+}
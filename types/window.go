@@ -9,29 +9,64 @@ import (
 
 var months map[string]time.Month
 var days map[string]time.Weekday
+var ordinals map[string]int
+
+// farFuture is used as the start/end of windows which will never (again) open or close
+var farFuture = time.Date(2500, time.January, 0, 0, 0, 0, 0, time.UTC)
+
+const (
+	// an occurrence is found by walking forward a day at a time.  the rarest recurrence is a yearly 29/02
+	maxDaysSearched = (366 * 8) + 2
+	// bound the number of times periods/exceptions are merged when looking for the next interval
+	maxIntervalSearch = 1000
+)
 
 // A Window type represents a known window of operation for a queue.  It is generated through the NLP parser as follows:
 // window, err := parse(input_string)
 //
+// A window is a set of periods, e.g. "9am - 5pm every weekday and 10am - 2pm every saturday", which are combined as a
+// union and a set of exceptions, e.g. "always except 2 - 4am every sunday and except 1st of the month", which are
+// subtracted from it.  Once "except" has been seen every following "and" clause is another exception.
+//
 // GetNextStartTime will return the correct starting point for the queue which the queueManager should use to initiate
 // task execution.  When this start time is reached it is recommended that GetNextEndTime should be called to inform
-// the system when to disable the queue again.
-//
-// All timezones are set to UTC unless specified in the window definition, e.g. "where timezone = GMT"
+// the system when to disable the queue again.  Overlapping or adjoining periods are merged so the end time is the
+// point at which the window actually closes.
 //
-// BUG(kieranbroadfoot): If GetNextEndTime is called on a window which is "always on" and currently in the exception window
-// the code will return a zero value.  It is recommended GetNextEndTime is called when the queueManager starts.
+// All timezones are set to UTC unless specified in the window definition, e.g. "where timezone = GMT" or
+// "where timezone = Europe/London".  Start and end times are calculated on the wall clock of that timezone so a window
+// of "9am - 5pm every weekday where timezone = Europe/London" opens at 9am local time on either side of a daylight
+// saving transition.  See timeInLocation for the handling of local times which are skipped or repeated.
 type Window struct {
 	start_     time.Time
 	end_       time.Time
-	Start      string
-	End        string
-	Recurrence string
-	OnDate     string
-	Timezone   string
-	AlwaysOn   bool
-	AlwaysOff  bool
-	Error      string
+	location_  *time.Location
+	Periods    []Period `json:"periods,omitempty" description:"The periods which are combined to define when the window is open"`
+	Exceptions []Period `json:"exceptions,omitempty" description:"The periods which are removed from the window"`
+	Timezone   string   `json:"timezone,omitempty" description:"The timezone in which the window is defined. Defaults to UTC"`
+	Error      string   `json:"-"`
+}
+
+// A Period is a single clause of a window, e.g. "always" or "1am to 2am every 1st of the month".  A period without a
+// start and end time (e.g. "except 25/12 yearly") covers the whole day.
+//
+// A Calendar period, e.g. "except calendar uk-holidays", occurs on the days of the named calendar (see Calendar).  The
+// dates are loaded from the store the first time the window is evaluated.
+//
+// Interval recurrences, e.g. "for 5 minutes every hour from 9am on weekday", set Duration and Interval (in minutes).
+// Start then anchors the first occurrence of each day (midnight if not given) and Recurrence optionally restricts the
+// days on which they occur.
+type Period struct {
+	Start      string `json:"start,omitempty" description:"The time (HH:MM) at which the period opens"`
+	End        string `json:"end,omitempty" description:"The time (HH:MM) at which the period closes"`
+	Recurrence string `json:"recurrence,omitempty" description:"The days on which the period occurs, e.g. weekday or second tuesday month"`
+	OnDate     string `json:"onDate,omitempty" description:"The specific date (DD/MM/YYYY) on which the period occurs"`
+	AlwaysOn   bool   `json:"alwaysOn,omitempty" description:"The period is always open"`
+	AlwaysOff  bool   `json:"alwaysOff,omitempty" description:"The period is never open"`
+	Duration   int    `json:"duration,omitempty" description:"For interval recurrences, the number of minutes the period is open"`
+	Interval   int    `json:"interval,omitempty" description:"For interval recurrences, the number of minutes between each opening"`
+	Calendar   string `json:"calendar,omitempty" description:"The name of the calendar whose dates the period occurs on"`
+	dates_     *calendarDates
 }
 
 type date struct {
@@ -66,6 +101,13 @@ func init() {
 		"november":  time.November,
 		"december":  time.December,
 	}
+	ordinals = map[string]int{
+		"first":  1,
+		"second": 2,
+		"third":  3,
+		"fourth": 4,
+		"last":   -1,
+	}
 	days = map[string]time.Weekday{
 		"sunday":    time.Sunday,
 		"monday":    time.Monday,
@@ -92,237 +134,260 @@ func (w *Window) GetNextEndTime() time.Time {
 	return w.returnTime("end")
 }
 
+// Opens determines if the window is open or will open in future
+func (w *Window) Opens() bool {
+	return w.GetNextStartTime().Before(farFuture)
+}
+
 func (w *Window) returnTime(returntype string) time.Time {
-	now := time.Now()
-	if w.start_.IsZero() || w.end_.IsZero() || now.After(w.start_) {
-		w.generateRecurringWindow()
-	}
-	if w.AlwaysOn == true && w.Recurrence != "" {
-		// if the window is always open we should invert start/end
-		if returntype == "start" {
-			// hack: special case where we find ourselves in the window already.
-			// the recurrence logic would have set start_ to now() because in
-			// normal cases the queue should immediately start.  We need to invert
-			// this because we do not want to be operating during the window
-			now = now.Add(time.Second)
-			if now.After(w.start_) && now.Before(w.end_) {
-				// inside the exception window.  start when the exception window closes
-				return w.end_
-			} else {
-				// else return now.  we are not in the window so should be running
-				return time.Now()
-			}
-		} else {
-			// See bug definition at the top of this file for details.
-			now = now.Add(time.Second)
-			if now.After(w.start_) && now.Before(w.end_) {
-				// inside the exception window.  we cannot know the next end timestamp, return zero
-				return time.Time{}
-			} else {
-				// not in the window, return start timestamp as exception window ending
-				return w.start_
-			}
+	now := GetClock().Now()
+	if w.end_.IsZero() || !now.Before(w.end_) {
+		// the cached interval has closed (or was never generated)
+		w.start_, w.end_ = w.nextInterval(now)
+	}
+	if returntype == "start" {
+		if now.After(w.start_) {
+			// we are inside the window so the queue should start immediately
+			return now
 		}
+		return w.start_
 	} else {
-		// standard case.
-		if returntype == "start" {
-			return w.start_
-		} else {
-			return w.end_
-		}
+		return w.end_
 	}
 }
 
-func (w *Window) generateRecurringWindow() {
-	// return next available date based on recurring string
-	now := time.Now()
-	if w.AlwaysOn == true && w.Recurrence == "" {
-		// simplest case.  we know this window is always open and there is no exceptions.
-		// return now and far future
-		w.start_ = now
-		w.end_ = time.Date(2500, time.January, 0, 0, 0, 0, 0, time.UTC)
-		return
-	}
-
-	if w.AlwaysOff == true {
-		// a queue which is always off is easy.. set start and end to some far future date
-		w.start_ = time.Date(2500, time.January, 0, 0, 0, 0, 0, time.UTC)
-		w.end_ = time.Date(2501, time.January, 0, 0, 0, 0, 0, time.UTC)
-	}
-
-	if w.AlwaysOn == false && w.OnDate != "" {
-		// the window has a very specific time/date combination set.  Simply determine if we are in/out of window and return
-		w.start_, _ = generateTimeStamp(generatedateFromString(w.OnDate), w.Start, w.Timezone)
-		w.end_, _ = generateTimeStamp(generatedateFromString(w.OnDate), w.End, w.Timezone)
-		// code receiving output from this function should check the dates are future/past in order to determine if it should open the window of operation
-		return
+func (w *Window) location() *time.Location {
+	if w.location_ == nil {
+		location, err := loadLocation(w.Timezone)
+		if err != nil {
+			// Parse will have rejected the window so we should never reach this point
+			location = time.UTC
+		}
+		w.location_ = location
 	}
+	return w.location_
+}
 
-	thisdate := date{day: now.Day(), month: now.Month(), year: now.Year()}
-
-	currentTime := (now.Hour() * 60) + now.Minute()
-	startTime := getStringTimeAsInt(w.Start)
-	endTime := getStringTimeAsInt(w.End)
-
-	startdate := thisdate
-	enddate := thisdate
-
-	elements := strings.Split(w.Recurrence, " ")
-	if elements[0] == "day" {
-		if endTime < startTime {
-			// the end time is the next day
-			enddate = addDaysTodate(enddate, 1)
+// nextInterval returns the first interval, at or after t, in which the window is open.  If the window is open at t the
+// interval starts at t.
+func (w *Window) nextInterval(t time.Time) (time.Time, time.Time) {
+	location := w.location()
+	w.loadCalendars()
+	for i := 0; i < maxIntervalSearch; i++ {
+		start, end := nextOccurrence(w.Periods, t, location)
+		if start.IsZero() {
+			break
 		}
-		// case: recurring daily event
-		w.deriveWindowsForToday(currentTime, startTime, endTime, startdate, enddate)
-		return
+		if start.Before(t) {
+			start = t
+		}
+		exceptionStart, exceptionEnd := nextOccurrence(w.Exceptions, start, location)
+		if !exceptionStart.IsZero() && !exceptionStart.After(start) {
+			// an exception covers the start of this period.  try again once it has finished
+			t = exceptionEnd
+			continue
+		}
+		end = extendOccurrence(w.Periods, end, location)
+		if !exceptionStart.IsZero() && exceptionStart.Before(end) {
+			end = exceptionStart
+		}
+		return start, end
 	}
+	// the window never opens
+	return farFuture, farFuture.AddDate(1, 0, 0)
+}
 
-	if isDay(elements[0]) {
-		// this is a specific day request
-		requestedDay := whichDay(elements[0])
-		today := now.Weekday()
-		if endTime < startTime {
-			enddate = addDaysTodate(enddate, 1)
-		}
-		if today == requestedDay {
-			if endTime < currentTime && startdate.day == enddate.day {
-				// found a window which ended today prior to "now".  Fix up for next week
-				w.start_, _ = generateTimeStamp(addDaysTodate(startdate, 7), w.Start, w.Timezone)
-				w.end_, _ = generateTimeStamp(addDaysTodate(enddate, 7), w.End, w.Timezone)
-			} else {
-				w.deriveWindowsForToday(currentTime, startTime, endTime, startdate, enddate)
+// loadCalendars fetches the dates of any calendars used by the window which have not yet been loaded
+func (w *Window) loadCalendars() {
+	for _, periods := range [][]Period{w.Periods, w.Exceptions} {
+		for idx := range periods {
+			if periods[idx].Calendar != "" && periods[idx].dates_ == nil {
+				periods[idx].dates_ = loadCalendarDates(periods[idx].Calendar)
 			}
 		}
-		if today < requestedDay {
-			w.start_, _ = generateTimeStamp(addDaysTodate(startdate, int(requestedDay-today)), w.Start, w.Timezone)
-			w.end_, _ = generateTimeStamp(addDaysTodate(enddate, int(requestedDay-today)), w.End, w.Timezone)
-		}
-		if today > requestedDay {
-			w.start_, _ = generateTimeStamp(addDaysTodate(startdate, int((6-today)+requestedDay+1)), w.Start, w.Timezone)
-			w.end_, _ = generateTimeStamp(addDaysTodate(enddate, int((6-today)+requestedDay+1)), w.End, w.Timezone)
+	}
+}
+
+// Calendars returns the names of the calendars used by the window
+func (w Window) Calendars() []string {
+	names := []string{}
+	for _, period := range append(append([]Period{}, w.Periods...), w.Exceptions...) {
+		if period.Calendar != "" && !isStringInSlice(period.Calendar, names) {
+			names = append(names, period.Calendar)
 		}
-		return
 	}
+	return names
+}
 
-	if elements[0] == "weekday" || elements[0] == "weekend" {
-		today := now.Weekday()
-		if endTime < startTime {
-			enddate = addDaysTodate(enddate, 1)
+// nextOccurrence returns the earliest occurrence of any of the periods which is open at, or starts after, t.  A zero
+// start is returned if none of the periods occur again.
+func nextOccurrence(periods []Period, t time.Time, location *time.Location) (time.Time, time.Time) {
+	var start, end time.Time
+	for _, period := range periods {
+		periodStart, periodEnd := period.next(t, location)
+		if !periodStart.IsZero() && (start.IsZero() || periodStart.Before(start)) {
+			start = periodStart
+			end = periodEnd
 		}
+	}
+	return start, end
+}
 
-		if elements[0] == "weekday" && !isTodayAWeekend(today) {
-			w.deriveWindowsForToday(currentTime, startTime, endTime, startdate, enddate)
-		} else if elements[0] == "weekday" && isTodayAWeekend(today) {
-			// need to set for next available weekday which is monday.  so if today is saturday + 2, if sunday + 1
-			daysToAdd := 2
-			if today == time.Sunday {
-				daysToAdd = 1
-			}
-			w.start_, _ = generateTimeStamp(addDaysTodate(startdate, daysToAdd), w.Start, w.Timezone)
-			w.end_, _ = generateTimeStamp(addDaysTodate(enddate, daysToAdd), w.End, w.Timezone)
-		} else if elements[0] == "weekend" && isTodayAWeekend(today) {
-			w.deriveWindowsForToday(currentTime, startTime, endTime, startdate, enddate)
-		} else {
-			// today is a weekday and we want a weekend.  we are looking for saturday
-			// so 6 - today = number of days to add
-			w.start_, _ = generateTimeStamp(addDaysTodate(startdate, int(6-today)), w.Start, w.Timezone)
-			w.end_, _ = generateTimeStamp(addDaysTodate(enddate, int(6-today)), w.End, w.Timezone)
+// extendOccurrence returns the end of the union of any periods which overlap or adjoin an occurrence ending at end
+func extendOccurrence(periods []Period, end time.Time, location *time.Location) time.Time {
+	for i := 0; i < maxIntervalSearch && end.Before(farFuture); i++ {
+		start, next := nextOccurrence(periods, end, location)
+		if start.IsZero() || start.After(end) || !next.After(end) {
+			break
 		}
-		return
+		end = next
 	}
+	return end
+}
 
-	if elements[1] == "month" || elements[1] == "monthly" {
-		elementZero, err := strconv.Atoi(elements[0])
-		if err == nil {
-			startdate.day = elementZero
-			enddate.day = elementZero
-			if endTime < startTime {
-				// the end time is the next day
-				enddate = addDaysTodate(enddate, 1)
-			}
-			if elementZero < thisdate.day {
-				// we need next month
-				w.start_, _ = generateTimeStamp(addMonthTodate(startdate), w.Start, w.Timezone)
-				w.end_, _ = generateTimeStamp(addMonthTodate(enddate), w.End, w.Timezone)
-			}
-			if elementZero > thisdate.day {
-				// this month upcoming...
-				w.start_, _ = generateTimeStamp(startdate, w.Start, w.Timezone)
-				w.end_, _ = generateTimeStamp(enddate, w.End, w.Timezone)
-			}
-			if elementZero == thisdate.day {
-				// its happening today
-				w.deriveWindowsForToday(currentTime, startTime, endTime, startdate, enddate)
-			}
+// next returns the occurrence of the period which is open at, or starts after, t.  A zero start is returned if the
+// period does not occur again.
+func (p Period) next(t time.Time, location *time.Location) (time.Time, time.Time) {
+	if p.AlwaysOff {
+		return time.Time{}, time.Time{}
+	}
+	if p.AlwaysOn {
+		return t, farFuture
+	}
+	if p.Interval > 0 {
+		return p.nextRepetition(t, location)
+	}
+	if p.OnDate != "" {
+		// the period has a very specific date so there is only one occurrence
+		start, end := p.occurrence(generatedateFromString(p.OnDate), location)
+		if end.After(t) {
+			return start, end
 		}
-		return
-	}
-
-	if isMonth(elements[1]) {
-		startdate.month = whichMonth(elements[1])
-		enddate.month = whichMonth(elements[1])
-		elementZero, err := strconv.Atoi(elements[0])
-		if err == nil {
-			startdate.day = elementZero
-			enddate.day = elementZero
-			if endTime < startTime {
-				enddate = addDaysTodate(enddate, 1)
+		return time.Time{}, time.Time{}
+	}
+	local := t.In(location)
+	// start a day early; an occurrence which began yesterday may still be open
+	day := addDaysTodate(date{day: local.Day(), month: local.Month(), year: local.Year()}, -1)
+	for i := 0; i < maxDaysSearched; i++ {
+		if p.occursOn(day) {
+			start, end := p.occurrence(day, location)
+			if end.After(t) {
+				return start, end
 			}
-			w.deriveWindowsForYear(thisdate, startdate, enddate, currentTime, startTime, endTime)
 		}
-		return
+		day = addDaysTodate(day, 1)
 	}
+	return time.Time{}, time.Time{}
+}
 
-	if elements[1] == "year" || elements[1] == "yearly" {
-		for idx, item := range strings.Split(elements[0], "/") {
-			item_, err := strconv.Atoi(item)
-			if err == nil {
-				if idx == 0 {
-					startdate.day = item_
-				} else if idx == 1 {
-					startdate.month = time.Month(item_)
+// nextRepetition returns the occurrence of an interval recurrence which is open at, or starts after, t.  Occurrences
+// start at the anchor time of each (permitted) day and repeat every Interval minutes until midnight.
+func (p Period) nextRepetition(t time.Time, location *time.Location) (time.Time, time.Time) {
+	anchorTime := p.Start
+	if anchorTime == "" {
+		anchorTime = "00:00"
+	}
+	duration := time.Duration(p.Duration) * time.Minute
+	interval := time.Duration(p.Interval) * time.Minute
+	local := t.In(location)
+	// start a day early; the last occurrence from yesterday may still be open
+	day := addDaysTodate(date{day: local.Day(), month: local.Month(), year: local.Year()}, -1)
+	for i := 0; i < 9; i++ {
+		if p.Recurrence == "" || p.occursOn(day) {
+			anchor, _ := generateTimeStamp(day, anchorTime, location)
+			midnight, _ := generateTimeStamp(addDaysTodate(day, 1), "00:00", location)
+			start := anchor
+			if !t.Before(anchor.Add(duration)) {
+				// skip forward to the first repetition which has not yet finished
+				start = anchor.Add(((t.Sub(anchor) - duration) / interval) * interval)
+				if !start.Add(duration).After(t) {
+					start = start.Add(interval)
 				}
 			}
+			if start.Before(midnight) {
+				return start, start.Add(duration)
+			}
 		}
-		enddate = startdate
-		if endTime < startTime {
-			enddate = addDaysTodate(enddate, 1)
-		}
-		w.deriveWindowsForYear(thisdate, startdate, enddate, currentTime, startTime, endTime)
-		return
+		day = addDaysTodate(day, 1)
 	}
-	return
+	return time.Time{}, time.Time{}
 }
 
-func (w *Window) deriveWindowsForToday(currentTime int, startTime int, endTime int, startdate date, enddate date) {
-	if startTime <= currentTime && endTime > currentTime {
-		// currently in the window
-		w.start_ = time.Now()
-		w.end_, _ = generateTimeStamp(enddate, w.End, w.Timezone)
-	} else if startTime > currentTime {
-		// happens today in the future
-		w.start_, _ = generateTimeStamp(startdate, w.Start, w.Timezone)
-		w.end_, _ = generateTimeStamp(enddate, w.End, w.Timezone)
-	} else if endTime < currentTime {
-		// missed window for today, set to tomorrow
-		w.start_, _ = generateTimeStamp(addDaysTodate(startdate, 1), w.Start, w.Timezone)
-		w.end_, _ = generateTimeStamp(addDaysTodate(enddate, 1), w.End, w.Timezone)
+// occurrence returns the start and end of the period if it starts on the given day
+func (p Period) occurrence(day date, location *time.Location) (time.Time, time.Time) {
+	startTime := p.Start
+	endTime := p.End
+	if startTime == "" || endTime == "" {
+		// no times given.  the period covers the whole day
+		startTime = "00:00"
+		endTime = "00:00"
+	}
+	endday := day
+	if getStringTimeAsInt(endTime) <= getStringTimeAsInt(startTime) {
+		// the end time is the next day
+		endday = addDaysTodate(endday, 1)
 	}
+	start, _ := generateTimeStamp(day, startTime, location)
+	end, _ := generateTimeStamp(endday, endTime, location)
+	return start, end
 }
 
-func (w *Window) deriveWindowsForYear(currentdate date, startdate date, enddate date, currentTime int, startTime int, endTime int) {
-	if startdate.month < currentdate.month || startdate.month == currentdate.month && startdate.day < currentdate.day {
-		// next year
-		w.start_, _ = generateTimeStamp(addYearTodate(startdate), w.Start, w.Timezone)
-		w.end_, _ = generateTimeStamp(addYearTodate(enddate), w.End, w.Timezone)
-	} else if startdate.month > currentdate.month || startdate.month == currentdate.month && startdate.day > currentdate.day {
-		w.start_, _ = generateTimeStamp(startdate, w.Start, w.Timezone)
-		w.end_, _ = generateTimeStamp(enddate, w.End, w.Timezone)
-	} else if startdate.month == currentdate.month && startdate.day == currentdate.day {
-		// today
-		w.deriveWindowsForToday(currentTime, startTime, endTime, startdate, enddate)
+// occursOn determines if the recurrence of the period includes the given day
+func (p Period) occursOn(day date) bool {
+	if p.Calendar != "" {
+		return p.dates_ != nil && (*p.dates_)[day]
+	}
+	weekday := time.Date(day.year, day.month, day.day, 0, 0, 0, 0, time.UTC).Weekday()
+	elements := strings.Split(p.Recurrence, " ")
+	switch {
+	case elements[0] == "day":
+		return true
+	case elements[0] == "weekday":
+		return !isTodayAWeekend(weekday)
+	case elements[0] == "weekend":
+		return isTodayAWeekend(weekday)
+	case isDay(elements[0]):
+		return weekday == whichDay(elements[0])
+	case isOrdinal(elements[0]) && len(elements) == 3:
+		return occursOnOrdinal(day, weekday, elements)
+	case len(elements) < 2:
+		return false
+	case elements[1] == "month" || elements[1] == "monthly":
+		dayOfMonth, err := strconv.Atoi(elements[0])
+		return err == nil && day.day == dayOfMonth
+	case isMonth(elements[1]):
+		dayOfMonth, err := strconv.Atoi(elements[0])
+		return err == nil && day.day == dayOfMonth && day.month == whichMonth(elements[1])
+	case elements[1] == "year" || elements[1] == "yearly":
+		dayAndMonth := strings.Split(elements[0], "/")
+		if len(dayAndMonth) != 2 {
+			return false
+		}
+		dayOfMonth, derr := strconv.Atoi(dayAndMonth[0])
+		month, merr := strconv.Atoi(dayAndMonth[1])
+		return derr == nil && merr == nil && day.day == dayOfMonth && day.month == time.Month(month)
 	}
+	return false
+}
+
+// occursOnOrdinal handles recurrences of the form "<ordinal> <day> <month|monthly|month name>", e.g. "second tuesday
+// month", "last friday monthly", "last day month" or "first monday january"
+func occursOnOrdinal(day date, weekday time.Weekday, elements []string) bool {
+	if isMonth(elements[2]) && day.month != whichMonth(elements[2]) {
+		return false
+	}
+	numberOfDaysInMonth := time.Date(day.year, day.month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if elements[1] == "day" {
+		return ordinals[elements[0]] == -1 && day.day == numberOfDaysInMonth
+	}
+	if !isDay(elements[1]) || weekday != whichDay(elements[1]) {
+		return false
+	}
+	if ordinals[elements[0]] == -1 {
+		// the last occurrence of this weekday in the month
+		return day.day+7 > numberOfDaysInMonth
+	}
+	return (day.day-1)/7+1 == ordinals[elements[0]]
 }
 
 func getStringTimeAsInt(input string) int {
@@ -338,40 +403,10 @@ func getStringTimeAsInt(input string) int {
 }
 
 func addDaysTodate(inputdate date, addition int) date {
-	// return a date which is X days in the future.  expect addition < 7
-	returndate := date{day: inputdate.day, month: inputdate.month, year: inputdate.year}
-	numberOfDaysInMonth := time.Date(inputdate.year, inputdate.month+1, 0, 0, 0, 0, 0, time.UTC).Day()
-	if inputdate.day+addition <= numberOfDaysInMonth {
-		// easiest case.
-		returndate.day = inputdate.day + addition
-		return returndate
-	} else {
-		// we are increasing the month (and potentially the year)
-		returndate.day = inputdate.day + addition - numberOfDaysInMonth
-		if inputdate.month == 12 {
-			returndate.year = returndate.year + addition
-			returndate.month = time.January
-		} else {
-			returndate.month++
-		}
-		return returndate
-	}
-}
-
-func addMonthTodate(inputdate date) date {
-	returndate := date{day: inputdate.day, month: inputdate.month, year: inputdate.year}
-	if returndate.month == 12 {
-		returndate.month = time.January
-		returndate.year = returndate.year + 1
-	} else {
-		returndate.month++
-	}
-	return returndate
-}
-
-func addYearTodate(inputdate date) date {
-	returndate := date{day: inputdate.day, month: inputdate.month, year: inputdate.year + 1}
-	return returndate
+	// return a date which is X days in the future.  time.Date normalises any overflow of the month/year for us
+	// and, because this is a calendar date, the calculation is done in UTC to avoid any daylight saving shifts
+	returndate := time.Date(inputdate.year, inputdate.month, inputdate.day+addition, 0, 0, 0, 0, time.UTC)
+	return date{day: returndate.Day(), month: returndate.Month(), year: returndate.Year()}
 }
 
 func isTodayAWeekend(day time.Weekday) bool {
@@ -399,6 +434,21 @@ func whichDay(input string) time.Weekday {
 	return time.Sunday
 }
 
+func isOrdinal(input string) bool {
+	_, ok := ordinals[input]
+	return ok
+}
+
+// ordinalFor returns the ordinal for a number, e.g. "second" for "2", or "" if there is none
+func ordinalFor(number string) string {
+	for key, value := range ordinals {
+		if strconv.Itoa(value) == number {
+			return key
+		}
+	}
+	return ""
+}
+
 func isMonth(input string) bool {
 	for key, _ := range months {
 		if input == key {
@@ -425,15 +475,10 @@ func generatedateFromString(input string) date {
 	return date{day: day, month: time.Month(month), year: year}
 }
 
-func generateTimeStamp(date date, time_ string, timezone string) (time.Time, error) {
-	if len(timezone) == 0 {
-		timezone = "UTC"
-	}
-	format := "02/01/2006 15:04 MST"
-	input := fmt.Sprintf("%02d/%02d/%04d %s %s", date.day, int(date.month), date.year, time_, timezone)
-	newTime, err := time.Parse(format, input)
-	if err == nil {
-		return newTime, nil
+func generateTimeStamp(date date, time_ string, location *time.Location) (time.Time, error) {
+	minutes := getStringTimeAsInt(time_)
+	if minutes < 0 {
+		return GetClock().Now(), fmt.Errorf("Invalid time: \"%s\"", time_)
 	}
-	return time.Now(), err
+	return timeInLocation(date, minutes/60, minutes%60, location), nil
 }
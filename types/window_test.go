@@ -0,0 +1,387 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFakeClock replaces the clock for the duration of a test, restoring the previous clock once the test completes
+func useFakeClock(t *testing.T, now time.Time) *FakeClock {
+	clock := NewFakeClock(now)
+	previous := GetClock()
+	SetClock(clock)
+	t.Cleanup(func() { SetClock(previous) })
+	return clock
+}
+
+// walkWindows advances the clock from one opening of the window to the next until the given time, returning the
+// start and end of every interval seen
+func walkWindows(t *testing.T, clock *FakeClock, window Window, until time.Time) [][2]time.Time {
+	intervals := [][2]time.Time{}
+	for {
+		start := window.GetNextStartTime()
+		if !start.Before(until) {
+			return intervals
+		}
+		clock.AdvanceTo(start)
+		if !window.Opens() {
+			t.Fatalf("window not open at its start time %v", start)
+		}
+		end := window.GetNextEndTime()
+		if !end.After(start) {
+			t.Fatalf("window closes at %v before it opens at %v", end, start)
+		}
+		clock.AdvanceTo(end)
+		intervals = append(intervals, [2]time.Time{start, end})
+	}
+}
+
+func TestWindowOverWeeks(t *testing.T) {
+	// monday 12/10/2026 to monday 02/11/2026: the clocks in london go back on 25/10/2026
+	from := time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, time.November, 2, 0, 0, 0, 0, time.UTC)
+	clock := useFakeClock(t, from)
+
+	window, err := Parse("9am - 5pm every weekday where timezone = Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	london, _ := time.LoadLocation("Europe/London")
+	intervals := walkWindows(t, clock, window, until)
+	if len(intervals) != 15 {
+		t.Fatalf("expected 15 windows in three weeks but found %d", len(intervals))
+	}
+	for _, interval := range intervals {
+		start, end := interval[0].In(london), interval[1].In(london)
+		if start.Weekday() == time.Saturday || start.Weekday() == time.Sunday {
+			t.Errorf("window opened at the weekend on %v", start)
+		}
+		if start.Hour() != 9 || start.Minute() != 0 || end.Hour() != 17 || end.Minute() != 0 || start.YearDay() != end.YearDay() {
+			t.Errorf("expected window from 9am to 5pm but was %v to %v", start, end)
+		}
+	}
+	// the same local time is an hour later in UTC once daylight saving ends
+	if first, last := intervals[0][0].UTC(), intervals[len(intervals)-1][0].UTC(); first.Hour() != 8 || last.Hour() != 9 {
+		t.Errorf("expected windows to open at 08:00 UTC in BST and 09:00 UTC in GMT but was %v and %v", first, last)
+	}
+}
+
+func TestRepeatingWindowOverWeeks(t *testing.T) {
+	from := time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, time.October, 26, 0, 0, 0, 0, time.UTC)
+	clock := useFakeClock(t, from)
+
+	window, err := Parse("for 15 minutes every 2 hours from 9am on weekday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	intervals := walkWindows(t, clock, window, until)
+	perDay := map[int]int{}
+	for _, interval := range intervals {
+		start, end := interval[0], interval[1]
+		if end.Sub(start) != 15*time.Minute {
+			t.Errorf("expected a 15 minute window but was %v to %v", start, end)
+		}
+		if start.Hour() < 9 || (start.Hour()-9)%2 != 0 || start.Minute() != 0 {
+			t.Errorf("expected the window to open every 2 hours from 9am but opened at %v", start)
+		}
+		if start.Weekday() == time.Saturday || start.Weekday() == time.Sunday {
+			t.Errorf("window opened at the weekend on %v", start)
+		}
+		perDay[start.YearDay()]++
+	}
+	if len(perDay) != 10 {
+		t.Errorf("expected windows on 10 weekdays but found %d", len(perDay))
+	}
+	for day, count := range perDay {
+		if count != 8 {
+			t.Errorf("expected 8 windows on day %d but found %d", day, count)
+		}
+	}
+}
+
+func TestAlwaysAndNeverWindows(t *testing.T) {
+	clock := useFakeClock(t, time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC))
+
+	always, _ := Parse("always")
+	never, _ := Parse("never")
+	for day := 0; day < 14; day++ {
+		if !always.Opens() {
+			t.Errorf("always window closed at %v", clock.Now())
+		}
+		if never.Opens() {
+			t.Errorf("never window open at %v", clock.Now())
+		}
+		clock.Advance(24 * time.Hour)
+	}
+}
+
+// intervalLayout is the layout of the times of the intervals expected by checkIntervals, in UTC unless the window
+// has a timezone
+const intervalLayout = "Mon 02/01/2006 15:04"
+
+// checkIntervals parses the window and compares its next intervals from the given time with those expected
+func checkIntervals(t *testing.T, definition string, from string, expected [][2]string) {
+	window, err := Parse(definition)
+	if err != nil {
+		t.Errorf("%q: %v", definition, err)
+		return
+	}
+	location := window.location()
+	start, err := time.ParseInLocation(intervalLayout, from, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intervals := window.Intervals(start, len(expected))
+	if len(intervals) != len(expected) {
+		t.Errorf("%q: expected %d intervals but found %d", definition, len(expected), len(intervals))
+		return
+	}
+	for idx, interval := range intervals {
+		actual := [2]string{interval.Start.In(location).Format(intervalLayout), interval.End.In(location).Format(intervalLayout)}
+		if actual != expected[idx] {
+			t.Errorf("%q: expected interval %d to be %v but was %v", definition, idx, expected[idx], actual)
+		}
+	}
+}
+
+func TestWindowUnions(t *testing.T) {
+	// monday 12/10/2026
+	checkIntervals(t, "9am - 11am every weekday and 2pm - 4pm every weekday", "Mon 12/10/2026 00:00", [][2]string{
+		{"Mon 12/10/2026 09:00", "Mon 12/10/2026 11:00"},
+		{"Mon 12/10/2026 14:00", "Mon 12/10/2026 16:00"},
+		{"Tue 13/10/2026 09:00", "Tue 13/10/2026 11:00"},
+	})
+	checkIntervals(t, "9am - 5pm every monday and 10am - 2pm every saturday", "Mon 12/10/2026 12:00", [][2]string{
+		{"Mon 12/10/2026 12:00", "Mon 12/10/2026 17:00"},
+		{"Sat 17/10/2026 10:00", "Sat 17/10/2026 14:00"},
+		{"Mon 19/10/2026 09:00", "Mon 19/10/2026 17:00"},
+	})
+	checkIntervals(t, "10am - 2pm every saturday and 25/12 yearly and 1am - 2am on 01/01/2027", "Wed 23/12/2026 00:00", [][2]string{
+		{"Fri 25/12/2026 00:00", "Sat 26/12/2026 00:00"},
+		{"Sat 26/12/2026 10:00", "Sat 26/12/2026 14:00"},
+		{"Fri 01/01/2027 01:00", "Fri 01/01/2027 02:00"},
+		{"Sat 02/01/2027 10:00", "Sat 02/01/2027 14:00"},
+	})
+}
+
+func TestWindowOverlappingPeriods(t *testing.T) {
+	// overlapping periods are merged
+	checkIntervals(t, "9am - 1pm every weekday and 11am - 5pm every weekday", "Mon 12/10/2026 00:00", [][2]string{
+		{"Mon 12/10/2026 09:00", "Mon 12/10/2026 17:00"},
+		{"Tue 13/10/2026 09:00", "Tue 13/10/2026 17:00"},
+	})
+	// as are adjoining periods
+	checkIntervals(t, "9am - 12pm every day and 12pm - 3pm every day", "Mon 12/10/2026 00:00", [][2]string{
+		{"Mon 12/10/2026 09:00", "Mon 12/10/2026 15:00"},
+	})
+	// a chain of periods, each overlapping the next
+	checkIntervals(t, "9am - 11am every day and 10am - 1pm every day and 12pm - 2pm every day", "Mon 12/10/2026 00:00", [][2]string{
+		{"Mon 12/10/2026 09:00", "Mon 12/10/2026 14:00"},
+	})
+	// a period within another changes nothing
+	checkIntervals(t, "9am - 5pm every day and 10am - 11am every day", "Mon 12/10/2026 00:00", [][2]string{
+		{"Mon 12/10/2026 09:00", "Mon 12/10/2026 17:00"},
+		{"Tue 13/10/2026 09:00", "Tue 13/10/2026 17:00"},
+	})
+	// periods overlapping across midnight
+	checkIntervals(t, "10pm - 2am every day and 1am - 3am every day", "Mon 12/10/2026 12:00", [][2]string{
+		{"Mon 12/10/2026 22:00", "Tue 13/10/2026 03:00"},
+		{"Tue 13/10/2026 22:00", "Wed 14/10/2026 03:00"},
+	})
+	// the periods of consecutive days join into a single interval
+	checkIntervals(t, "12am - 12am every friday and 12am - 12am every saturday and 10pm - 9am every sunday", "Tue 13/10/2026 00:00", [][2]string{
+		{"Fri 16/10/2026 00:00", "Sun 18/10/2026 00:00"},
+		{"Sun 18/10/2026 22:00", "Mon 19/10/2026 09:00"},
+	})
+}
+
+func TestWindowExceptions(t *testing.T) {
+	// every clause after except is an exception
+	checkIntervals(t, "9am - 5pm every weekday except 12pm - 1pm every weekday and 3pm - 4pm every friday", "Fri 16/10/2026 00:00", [][2]string{
+		{"Fri 16/10/2026 09:00", "Fri 16/10/2026 12:00"},
+		{"Fri 16/10/2026 13:00", "Fri 16/10/2026 15:00"},
+		{"Fri 16/10/2026 16:00", "Fri 16/10/2026 17:00"},
+		{"Mon 19/10/2026 09:00", "Mon 19/10/2026 12:00"},
+		{"Mon 19/10/2026 13:00", "Mon 19/10/2026 17:00"},
+	})
+	// "and except" is the same as "and"
+	checkIntervals(t, "9am - 5pm every weekday except 14/10/2026 and except 12pm - 1pm every weekday", "Tue 13/10/2026 13:00", [][2]string{
+		{"Tue 13/10/2026 13:00", "Tue 13/10/2026 17:00"},
+		{"Thu 15/10/2026 09:00", "Thu 15/10/2026 12:00"},
+	})
+	// overlapping exceptions: sunday 01/11/2026 is the 1st of the month
+	checkIntervals(t, "always except 2am - 4am every sunday and except 1st of the month", "Thu 29/10/2026 00:00", [][2]string{
+		{"Thu 29/10/2026 00:00", "Sun 01/11/2026 00:00"},
+		{"Mon 02/11/2026 00:00", "Sun 08/11/2026 02:00"},
+		{"Sun 08/11/2026 04:00", "Sun 15/11/2026 02:00"},
+	})
+	// an exception covering every period leaves the window closed
+	checkIntervals(t, "9am - 5pm every weekday except 12am - 12am every weekday", "Mon 12/10/2026 00:00", [][2]string{})
+}
+
+func TestExtendOccurrence(t *testing.T) {
+	monday := date{day: 12, month: time.October, year: 2026}
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2026, time.October, 12, hour, minute, 0, 0, time.UTC)
+	}
+	periods := []Period{
+		{Start: "09:00", End: "11:00", Recurrence: "day"},
+		{Start: "10:30", End: "12:00", Recurrence: "day"},
+		{Start: "12:00", End: "13:00", Recurrence: "day"},
+		{Start: "14:00", End: "15:00", Recurrence: "day"},
+	}
+	tests := []struct {
+		end      time.Time
+		expected time.Time
+	}{
+		// overlapping and then adjoining periods are merged, but not the period after the gap
+		{at(11, 0), at(13, 0)},
+		{at(12, 0), at(13, 0)},
+		{at(13, 0), at(13, 0)},
+		{at(15, 0), at(15, 0)},
+		{at(10, 0), at(13, 0)},
+	}
+	for _, test := range tests {
+		if end := extendOccurrence(periods, test.end, time.UTC); !end.Equal(test.expected) {
+			t.Errorf("expected an occurrence ending at %v to be extended to %v but was %v", test.end, test.expected, end)
+		}
+	}
+	if start, end := periods[0].occurrence(monday, time.UTC); !start.Equal(at(9, 0)) || !end.Equal(at(11, 0)) {
+		t.Errorf("expected the first period to occur from 09:00 to 11:00 but was %v to %v", start, end)
+	}
+	// an always period never ends
+	if end := extendOccurrence([]Period{{AlwaysOn: true}}, at(9, 0), time.UTC); !end.Equal(farFuture) {
+		t.Errorf("expected an always period to extend to the far future but was %v", end)
+	}
+}
+
+func TestWindowOrdinals(t *testing.T) {
+	// the nth day of the week, with the ordinal given as a word or a number
+	for _, definition := range []string{"9am - 5pm every second tuesday of the month", "9am - 5pm every 2nd tuesday of the month"} {
+		checkIntervals(t, definition, "Mon 12/10/2026 00:00", [][2]string{
+			{"Tue 13/10/2026 09:00", "Tue 13/10/2026 17:00"},
+			{"Tue 10/11/2026 09:00", "Tue 10/11/2026 17:00"},
+			{"Tue 08/12/2026 09:00", "Tue 08/12/2026 17:00"},
+		})
+	}
+	checkIntervals(t, "10pm - 2am every fourth sunday of the month", "Thu 01/10/2026 00:00", [][2]string{
+		{"Sun 25/10/2026 22:00", "Mon 26/10/2026 02:00"},
+		{"Sun 22/11/2026 22:00", "Mon 23/11/2026 02:00"},
+	})
+	checkIntervals(t, "6pm - 11pm every last friday of the month", "Mon 12/10/2026 00:00", [][2]string{
+		{"Fri 30/10/2026 18:00", "Fri 30/10/2026 23:00"},
+		{"Fri 27/11/2026 18:00", "Fri 27/11/2026 23:00"},
+		{"Fri 25/12/2026 18:00", "Fri 25/12/2026 23:00"},
+	})
+	// the last day of months of 31, 29, 31 and 30 days in a leap year
+	checkIntervals(t, "9am - 5pm every last day of the month", "Sat 01/01/2028 00:00", [][2]string{
+		{"Mon 31/01/2028 09:00", "Mon 31/01/2028 17:00"},
+		{"Tue 29/02/2028 09:00", "Tue 29/02/2028 17:00"},
+		{"Fri 31/03/2028 09:00", "Fri 31/03/2028 17:00"},
+		{"Sun 30/04/2028 09:00", "Sun 30/04/2028 17:00"},
+	})
+	// and of a february of 28 days, as a whole day
+	checkIntervals(t, "12am - 12am every last day of the month", "Sun 01/02/2026 00:00", [][2]string{
+		{"Sat 28/02/2026 00:00", "Sun 01/03/2026 00:00"},
+		{"Tue 31/03/2026 00:00", "Wed 01/04/2026 00:00"},
+	})
+}
+
+func TestWindowOrdinalErrors(t *testing.T) {
+	tests := []struct {
+		definition string
+		expected   string
+	}{
+		{"9am - 5pm every second tuesday yearly", "Not a valid recurrence for: \"second tuesday yearly\" (expected \"of the month\")"},
+		{"9am - 5pm every last friday of the year", "Not a valid recurrence for: \"last friday year\" (expected \"of the month\")"},
+		{"9am - 5pm every 2nd tuesday yearly", "Not a valid recurrence for: \"second tuesday yearly\" (expected \"of the month\")"},
+		{"9am - 5pm every first day of the month", "Not a valid recurrence for: \"first day\""},
+		{"9am - 5pm every 5th tuesday of the month", "Not a valid recurrence for: \"5th tuesday\" (expected one of 1st to 4th, or last)"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.definition)
+		if err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+			t.Errorf("%q: expected the error %q but was %v", test.definition, test.expected, err)
+		}
+	}
+}
+
+func TestIntervalErrors(t *testing.T) {
+	tests := []struct {
+		definition string
+		expected   string
+	}{
+		{"for 5 minutes every 25 hours", "Not a valid interval: intervals longer than a day should use a daily recurrence"},
+		{"for 1 hour every 1441 minutes", "Not a valid interval: intervals longer than a day should use a daily recurrence"},
+		{"for 60 minutes every hour", "Not a valid interval: the window (60 minutes) must be shorter than the interval (60 minutes)"},
+		{"for 3 hours every 2 hours", "Not a valid interval: the window (180 minutes) must be shorter than the interval (120 minutes)"},
+	}
+	for _, test := range tests {
+		if _, err := Parse(test.definition); err == nil || err.Error() != test.expected {
+			t.Errorf("%q: expected the error %q but was %v", test.definition, test.expected, err)
+		}
+	}
+	// a whole day is the longest interval
+	if _, err := Parse("for 5 minutes every 24 hours"); err != nil {
+		t.Errorf("expected an interval of a day to be valid but was %v", err)
+	}
+}
+
+func TestNextRepetitionAcrossMidnight(t *testing.T) {
+	window, err := Parse("for 45 minutes every 90 minutes from 23:30 on weekday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	period := window.Periods[0]
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		t             time.Time
+		start, finish time.Time
+	}{
+		// friday's repetition is still open on saturday morning
+		{at(16, 12, 0), at(16, 23, 30), at(17, 0, 15)},
+		{at(17, 0, 5), at(16, 23, 30), at(17, 0, 15)},
+		// but the weekend has none of its own
+		{at(17, 0, 15), at(19, 23, 30), at(20, 0, 15)},
+		{at(20, 0, 14), at(19, 23, 30), at(20, 0, 15)},
+		{at(20, 0, 15), at(20, 23, 30), at(21, 0, 15)},
+	}
+	for _, test := range tests {
+		start, finish := period.nextRepetition(test.t, time.UTC)
+		if !start.Equal(test.start) || !finish.Equal(test.finish) {
+			t.Errorf("at %v expected %v to %v but was %v to %v", test.t, test.start, test.finish, start, finish)
+		}
+	}
+	// the repetitions of a day end at midnight and the next day starts again from its anchor
+	checkIntervals(t, "for 30 minutes every 5 hours", "Mon 12/10/2026 19:00", [][2]string{
+		{"Mon 12/10/2026 20:00", "Mon 12/10/2026 20:30"},
+		{"Tue 13/10/2026 00:00", "Tue 13/10/2026 00:30"},
+		{"Tue 13/10/2026 05:00", "Tue 13/10/2026 05:30"},
+	})
+}
+
+func TestNextRepetitionAcrossDaylightSaving(t *testing.T) {
+	// the clocks go forward at 1am on 29/03/2026, so the repetition after midnight is at 2am
+	checkIntervals(t, "for 15 minutes every hour where timezone = Europe/London", "Sun 29/03/2026 00:30", [][2]string{
+		{"Sun 29/03/2026 02:00", "Sun 29/03/2026 02:15"},
+		{"Sun 29/03/2026 03:00", "Sun 29/03/2026 03:15"},
+	})
+	// and the repetitions of the short day stop at local midnight
+	checkIntervals(t, "for 15 minutes every hour where timezone = Europe/London", "Sun 29/03/2026 23:30", [][2]string{
+		{"Mon 30/03/2026 00:00", "Mon 30/03/2026 00:15"},
+		{"Mon 30/03/2026 01:00", "Mon 30/03/2026 01:15"},
+	})
+	// the clocks go back at 2am on 25/10/2026, so 1am is repeated
+	checkIntervals(t, "for 15 minutes every hour where timezone = Europe/London", "Sun 25/10/2026 00:30", [][2]string{
+		{"Sun 25/10/2026 01:00", "Sun 25/10/2026 01:15"},
+		{"Sun 25/10/2026 01:00", "Sun 25/10/2026 01:15"},
+		{"Sun 25/10/2026 02:00", "Sun 25/10/2026 02:15"},
+	})
+	checkIntervals(t, "for 15 minutes every hour where timezone = Europe/London", "Sun 25/10/2026 23:30", [][2]string{
+		{"Mon 26/10/2026 00:00", "Mon 26/10/2026 00:15"},
+	})
+}